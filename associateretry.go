@@ -0,0 +1,104 @@
+package netdicom
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy configures AssociateWithRetry's retry loop for establishing an
+// association: how many attempts to make, how long to back off between
+// them, and which failures are worth retrying at all.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times to attempt the
+	// association, including the first. A value <= 1 means no retries.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the second attempt. Later
+	// attempts double it, up to MaxBackoff.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay computed from InitialBackoff.
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction (0.0-1.0) of the computed backoff to
+	// randomize: the actual delay is drawn uniformly from
+	// [backoff*(1-Jitter), backoff*(1+Jitter)]. Zero means no jitter.
+	Jitter float64
+
+	// IsRetryable decides whether a failed attempt's error is worth
+	// retrying. If nil, every error is considered retryable (subject to
+	// MaxAttempts) -- AssociateContext's current error surface doesn't
+	// distinguish a transient A-ASSOCIATE-RJ (ResultRejectedTransient)
+	// or a transport-level failure from a permanent rejection, so callers
+	// that need that distinction should supply their own predicate.
+	IsRetryable func(error) bool
+}
+
+// backoff returns the delay before attempt number n (1-based: the delay
+// before the 2nd attempt is n=1, before the 3rd is n=2, etc.), applying
+// p.Jitter.
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d := p.InitialBackoff
+	for i := 0; i < n-1; i++ {
+		d *= 2
+		if d > p.MaxBackoff {
+			d = p.MaxBackoff
+			break
+		}
+	}
+	if p.Jitter <= 0 {
+		return d
+	}
+	spread := float64(d) * p.Jitter
+	return d + time.Duration(spread*(2*rand.Float64()-1))
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.IsRetryable == nil {
+		return true
+	}
+	return p.IsRetryable(err)
+}
+
+// AssociateWithRetry repeatedly attempts to establish an association with
+// serverAddr, per policy, retrying a failed attempt (a dial failure, an
+// A-ASSOCIATE-RJ, or a handshake timeout -- anything AssociateContext
+// reports as an error) up to policy.MaxAttempts times with exponential
+// backoff between attempts. It returns the first ServiceUser whose
+// handshake completes, or the last attempt's error if every attempt fails
+// or policy.IsRetryable rejects one.
+//
+// This retry loop sits above the DICOM state machine entirely: each attempt
+// is a fresh ServiceUser/association (the DUL state table has no
+// transition that re-drives a failed handshake in place), so a retried
+// attempt is indistinguishable on the wire from an unrelated caller simply
+// trying again.
+func AssociateWithRetry(ctx context.Context, serverAddr string, params ServiceUserParams, policy RetryPolicy) (*ServiceUser, error) {
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	var lastErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		su, err := NewServiceUser(params)
+		if err != nil {
+			return nil, err
+		}
+		if err := su.AssociateContext(ctx, serverAddr); err == nil {
+			return su, nil
+		} else {
+			lastErr = err
+			su.Release()
+		}
+		if attempt == maxAttempts || !policy.retryable(lastErr) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(policy.backoff(attempt)):
+		}
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,60 @@
+package netdicom
+
+import "github.com/yasushi-saito/go-netdicom/pdu"
+
+// ProposedContext describes one presentation context as offered in an
+// A-ASSOCIATE-RQ, before negotiation -- for
+// AssociationEventCallbacks.OnAssociateRequest.
+type ProposedContext struct {
+	ContextID          byte
+	AbstractSyntaxUID  string
+	TransferSyntaxUIDs []string
+}
+
+// NegotiatedContext describes one presentation context's outcome after
+// negotiation -- for AssociationEventCallbacks.OnAssociateAccept.
+// TransferSyntaxUID is only set when Result ==
+// pdu.PresentationContextAccepted; a rejected context has none to report
+// (PS3.8 9.3.3.2).
+type NegotiatedContext struct {
+	ContextID         byte
+	AbstractSyntaxUID string
+	TransferSyntaxUID string
+	Result            pdu.PresentationContextResult
+}
+
+// AssociationEventCallbacks lets ServiceProviderParams hook into the
+// A-ASSOCIATE handshake and teardown for access control, audit logging
+// (e.g. HIPAA), or dynamic tuning -- narrower and more synchronous than
+// Observer (see observer.go), which only ever notifies after the fact and
+// has no way to veto an association or see per-context negotiation detail
+// or raw A-ABORT reason codes. Every field is optional; a nil field is
+// simply not called. Like Observer, callbacks run inline on the state
+// machine's goroutine and should return quickly.
+type AssociationEventCallbacks struct {
+	// OnAssociateRequest runs before onAssociateRequest negotiates any
+	// presentation context, given the requestor's calling AE title, its
+	// implementation class UID/version (for per-vendor workarounds), and
+	// its proposed, not-yet-negotiated contexts. A non-nil error rejects
+	// the association; PS3.8 has no free-text A-ASSOCIATE-RJ reason, so
+	// err is only logged locally, and the peer sees a generic
+	// "no-reason-given (service-user)" rejection.
+	OnAssociateRequest func(callingAETitle, peerImplementationClassUID, peerImplementationVersionName string, contexts []ProposedContext) error
+
+	// OnAssociateAccept runs once negotiation completes, with every
+	// proposed context's outcome -- including ones this association
+	// rejected individually even though the association overall went
+	// through.
+	OnAssociateAccept func(negotiated []NegotiatedContext)
+
+	// OnAssociateRelease runs when an established association tears down
+	// cleanly via A-RELEASE, as opposed to OnAssociateAbort.
+	OnAssociateRelease func()
+
+	// OnAssociateAbort runs when an established association tears down
+	// because the peer sent an A-ABORT PDU, with its PS3.8 9.3.8
+	// Source/Reason byte pair. It does not run for a locally-initiated
+	// abort (e.g. a transport error or ctx cancellation), since those
+	// have no peer-supplied Source/Reason to report.
+	OnAssociateAbort func(source, reason byte)
+}
@@ -0,0 +1,120 @@
+package netdicom
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+)
+
+// PDUChannel abstracts reading and writing whole PDUs, so the state machine
+// does not need to reach into a net.Conn directly. This is the seam
+// ServiceUserParams.ChannelFactory/ServiceProviderParams.ChannelFactory plug
+// into: ship a default TCP/TLS implementation (NewPDUChannel, which works
+// for both since a *tls.Conn satisfies net.Conn), or substitute a test
+// double -- e.g. a channel backed by a recorded byte stream for replay, or a
+// shim around a multiplexed connection -- without touching the dispatcher.
+type PDUChannel interface {
+	// ReadPDU blocks until a full PDU has been read, ctx's deadline passes,
+	// or the underlying transport errors. Implementations built on a
+	// net.Conn honor ctx's deadline via SetReadDeadline; NewPDUChannel's
+	// does not interrupt a read when ctx is canceled without a deadline.
+	ReadPDU(ctx context.Context) (PDU, error)
+
+	// WritePDU encodes and sends p in full, or returns an error. ctx is
+	// honored the same way as ReadPDU.
+	WritePDU(ctx context.Context, p PDU) error
+
+	// WriteRaw sends already-encoded PDU bytes as-is, without re-encoding
+	// from a PDU value. sendPDU uses this instead of WritePDU so that
+	// byte-level FaultInjector mutations (NewFuzzFaultInjector's onSend,
+	// FaultActionCorrupt) actually reach the wire.
+	WriteRaw(ctx context.Context, data []byte) error
+
+	// MaxPDUSize is the largest PDU this channel will read, in bytes
+	// (PS3.8 D.1, Maximum Length sub-item). SetMaxPDUSize updates it once
+	// the real value is known, e.g. after negotiation during the
+	// A-ASSOCIATE handshake.
+	MaxPDUSize() uint32
+	SetMaxPDUSize(size uint32)
+
+	// Close releases the underlying transport. Subsequent ReadPDU/WritePDU
+	// calls must fail.
+	Close() error
+}
+
+// PDUChannelFactory wraps an already-connected net.Conn (plaintext or TLS --
+// both satisfy net.Conn) in a PDUChannel. ServiceUserParams.ChannelFactory
+// and ServiceProviderParams.ChannelFactory default to NewPDUChannel.
+type PDUChannelFactory func(conn net.Conn) PDUChannel
+
+// netConnPDUChannel is the default PDUChannel, built directly on a net.Conn
+// using the package's existing ReadPDU/EncodePDU wire codec.
+type netConnPDUChannel struct {
+	conn       net.Conn
+	maxPDUSize uint32
+}
+
+// NewPDUChannel returns the default PDUChannel: PDU framing over conn using
+// ReadPDU/EncodePDU. It works identically for plaintext TCP and TLS
+// connections (see NewTLSPDUChannel), since framing is transport-agnostic
+// once conn's handshake, if any, has completed.
+func NewPDUChannel(conn net.Conn) PDUChannel {
+	return &netConnPDUChannel{conn: conn, maxPDUSize: DefaultMaximiumPDUSize}
+}
+
+// NewTLSPDUChannel is NewPDUChannel applied to a *tls.Conn, e.g. one
+// produced by tls.Dial/tls.Listener or ServiceUserParams.TLSConfig/
+// ServiceProviderParams.TLSConfig (including mTLS, via tls.Config.
+// ClientAuth/ClientCAs). It exists as a separate, explicitly-named entry
+// point so DICOM-TLS deployments (PS3.15 Secure Transport Connection
+// Profiles) can wire up the transport as a configuration choice rather than
+// a fork of the channel code; the framing itself is identical to the
+// plaintext case.
+func NewTLSPDUChannel(conn *tls.Conn) PDUChannel {
+	return NewPDUChannel(conn)
+}
+
+func (c *netConnPDUChannel) ReadPDU(ctx context.Context) (PDU, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetReadDeadline(deadline)
+		defer c.conn.SetReadDeadline(time.Time{})
+	}
+	return ReadPDU(c.conn, int(c.maxPDUSize))
+}
+
+func (c *netConnPDUChannel) WritePDU(ctx context.Context, p PDU) error {
+	data, err := EncodePDU(p)
+	if err != nil {
+		return err
+	}
+	return c.WriteRaw(ctx, data)
+}
+
+func (c *netConnPDUChannel) WriteRaw(ctx context.Context, data []byte) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetWriteDeadline(deadline)
+		defer c.conn.SetWriteDeadline(time.Time{})
+	}
+	n, err := c.conn.Write(data)
+	if err != nil {
+		return err
+	}
+	if n != len(data) {
+		return fmt.Errorf("netdicom: short write of PDU: wrote %d of %d bytes", n, len(data))
+	}
+	return nil
+}
+
+func (c *netConnPDUChannel) MaxPDUSize() uint32 {
+	return c.maxPDUSize
+}
+
+func (c *netConnPDUChannel) SetMaxPDUSize(size uint32) {
+	c.maxPDUSize = size
+}
+
+func (c *netConnPDUChannel) Close() error {
+	return c.conn.Close()
+}
@@ -35,12 +35,131 @@ type contextManager struct {
 	// Implementation version, virtually meaningless since its format isn't standardiszed.
 	peerImplementationVersionName string
 
+	// Roles negotiated per abstract syntax UID via SCP/SCU Role Selection
+	// (PS3.7 D.3.3.4). Populated from the peer's RoleSelectionSubItem
+	// answer (provider side) or request (user side).
+	peerRoles map[string]pdu.RoleSelectionSubItem
+
+	// authenticator, if non-nil, is consulted on the provider side when the
+	// requestor sends a UserIdentitySubItem. Set by the caller (see
+	// ServiceProviderParams.Authenticator) before onAssociateRequest runs.
+	authenticator Authenticator
+
+	// peerServerResponse holds the acceptor's UserIdentityACSubItem, set on
+	// the user (client) side when the association requested a positive
+	// response to User Identity Negotiation.
+	peerServerResponse []byte
+
+	// Extended Negotiation sub-items (PS3.7 D.3.3.5/6) the peer sent,
+	// keyed by SOP class UID.
+	peerExtendedNegotiation       map[string]pdu.SOPClassExtendedNegotiationSubItem
+	peerCommonExtendedNegotiation map[string]pdu.SOPClassCommonExtendedNegotiationSubItem
+
+	// peerTraceParent is the requestor's W3C traceparent string, set on the
+	// provider side from a pdu.TraceContextSubItem in the A-ASSOCIATE-RQ, so
+	// dicomTelemetry.startAssociation can make this association's span a
+	// child of the requestor's span rather than starting a disconnected
+	// trace.
+	peerTraceParent string
+
+	// Asynchronous Operations Window (PS3.7 D.3.3.3) negotiated with the
+	// peer. Zero means "unlimited" per the spec; the default of 1/1 below
+	// matches an association that never asked for async ops.
+	peerMaxOpsInvoked   uint16
+	peerMaxOpsPerformed uint16
+
 	// tmpRequests used only on the client (requestor) side. It holds the
 	// contextid->presentationcontext mapping generated from the
 	// A_ASSOCIATE_RQ PDU. Once an A_ASSOCIATE_AC PDU arrives, tmpRequests
 	// is matched against the response PDU and
 	// contextid->{abstractsyntax,transfersyntax} mappings are filled.
 	tmpRequests map[byte]*pdu.PresentationContextItem
+
+	// callingAETitle and calledAETitle are the AE titles negotiated for
+	// this association, set by the caller (see actionAe6 in
+	// statemachine.go) before onAssociateRequest runs. Used to tag
+	// OpenTelemetry spans/metrics with calling_ae/called_ae.
+	callingAETitle string
+	calledAETitle  string
+
+	// callerIP is the requestor's address (host only, no port), for
+	// acceptUnknownSOPClassesFilter below. Set by the caller (see
+	// runStateMachineForServiceProvider) before onAssociateRequest runs,
+	// same as callingAETitle above.
+	callerIP string
+
+	// acceptUnknownSOPClasses and acceptUnknownSOPClassesFilter control
+	// whether a proposed presentation context whose abstract syntax
+	// sopclass.LookupByUID doesn't recognize is still accepted (using the
+	// requestor's offered transfer syntax) rather than rejected with
+	// PresentationContextProviderRejectionAbstractSyntaxNotSupported. The
+	// filter, if non-nil, is consulted only when acceptUnknownSOPClasses
+	// is false, and lets the caller decide per calling-AE/source-IP; see
+	// ServiceProviderParams.AcceptUnknownSOPClasses and
+	// AcceptUnknownSOPClassesFilter. Set by the caller before
+	// onAssociateRequest runs, same as authenticator above.
+	acceptUnknownSOPClasses       bool
+	acceptUnknownSOPClassesFilter func(callingAE, callerIP string) bool
+
+	// localRoleSelection is the provider's view of SCP/SCU Role Selection
+	// (PS3.7 D.3.3.4), keyed by SOP class UID: what onAssociateRequest is
+	// willing to grant when the requestor asks for a role via a
+	// RoleSelectionSubItem (see grantedRole). Set by the caller (see
+	// ServiceProviderParams.RoleSelection) before onAssociateRequest runs,
+	// same as acceptUnknownSOPClasses above. The user (requestor) side has
+	// no equivalent field -- generateAssociateRequest's roles parameter,
+	// built from ServiceUserParams.RoleSelection via roleSelectionSubItems,
+	// is passed explicitly instead, the same as its other per-call
+	// negotiation parameters.
+	localRoleSelection map[string]Role
+
+	// negotiationPolicy, if non-nil, replaces onAssociateRequest's default
+	// accept-or-reject logic for each proposed presentation context with a
+	// caller-supplied NegotiationPolicy; see ServiceProviderParams.
+	// NegotiationPolicy. If nil, onAssociateRequest falls back to
+	// defaultNegotiationPolicy, which reproduces the behavior this package
+	// had before NegotiationPolicy existed: acceptUnknownSOPClasses /
+	// acceptUnknownSOPClassesFilter above decide whether an unrecognized
+	// abstract syntax is rejected, and transferSyntaxPolicy below picks the
+	// transfer syntax, never rejecting on transfer syntax grounds. Set by
+	// the caller before onAssociateRequest runs, same as
+	// acceptUnknownSOPClasses above.
+	negotiationPolicy NegotiationPolicy
+
+	// associationEvents, if any field is non-nil, is invoked by
+	// onAssociateRequest (OnAssociateRequest/OnAssociateAccept) and by the
+	// state machine's release/abort actions (OnAssociateRelease/
+	// OnAssociateAbort); see ServiceProviderParams.AssociationEvents. Zero
+	// value is fine -- every field defaults to nil and is simply skipped.
+	associationEvents AssociationEventCallbacks
+
+	// transferSyntaxPolicy decides which of several offered transfer
+	// syntaxes to accept for a given abstract syntax; see
+	// ServiceProviderParams.TransferSyntaxPolicy and the ServiceUserParams
+	// equivalent. Never nil; newContextManager defaults it to
+	// PreferOriginalTransferSyntaxPolicy, matching this package's
+	// pre-TransferSyntaxPolicy behavior of picking whichever syntax the
+	// proposer listed first.
+	transferSyntaxPolicy TransferSyntaxPolicy
+
+	// localWireCompression lists, in preference order, the wire
+	// compressors this side is willing to use for P-DATA-TF data-set
+	// payloads (see ServiceProviderParams.WireCompression / the
+	// ServiceUserParams equivalent). Set by the caller before
+	// generateAssociateRequest/onAssociateRequest runs, same as
+	// authenticator above. Empty means "don't offer wire compression".
+	localWireCompression []string
+
+	// wireCompressor is the compressor negotiated with the peer -- nil
+	// until negotiation completes (or if it never offered/accepted one),
+	// in which case P-DATA-TF payloads are sent/received uncompressed.
+	wireCompressor wireCompressor
+
+	// logger receives this association's diagnostic output (PDU assembly,
+	// request handlers); see ServiceProviderParams.Logger / the
+	// ServiceUserParams equivalent. Never nil; newContextManager defaults
+	// it to VLogLogger().
+	logger Logger
 }
 
 // Create an empty contextManager
@@ -50,6 +169,13 @@ func newContextManager() *contextManager {
 		abstractSyntaxNameToContextIDMap: make(map[string]*contextManagerEntry),
 		peerMaxPDUSize:                   16384, // The default value used by Osirix & pynetdicom.
 		tmpRequests:                      make(map[byte]*pdu.PresentationContextItem),
+		peerRoles:                        make(map[string]pdu.RoleSelectionSubItem),
+		peerExtendedNegotiation:          make(map[string]pdu.SOPClassExtendedNegotiationSubItem),
+		peerCommonExtendedNegotiation:    make(map[string]pdu.SOPClassCommonExtendedNegotiationSubItem),
+		peerMaxOpsInvoked:                1,
+		peerMaxOpsPerformed:              1,
+		transferSyntaxPolicy:             PreferOriginalTransferSyntaxPolicy(),
+		logger:                           VLogLogger(),
 	}
 	return c
 }
@@ -58,9 +184,37 @@ func newContextManager() *contextManager {
 // A_REQUEST_RQ.Items. The PDU is sent when running as a service user (client).
 // maxPDUSize is the maximum PDU size, in bytes, that the clients is willing to
 // receive. maxPDUSize is encoded in one of the items.
+//
+// roles, if non-nil, requests SCP/SCU Role Selection for the SOP class UIDs it
+// contains (e.g. so a C-GET SCU can also act as the C-STORE SCP for the
+// sub-operations); it is keyed by the SOP class UID being negotiated.
+//
+// identity, if non-nil, is embedded as a User Identity Negotiation sub-item
+// (PS3.7 D.3.3.7) so the acceptor can authenticate this association.
+//
+// extendedNegotiation, if non-nil, advertises service-class-specific
+// capabilities (PS3.7 D.3.3.5) per SOP class UID, e.g. the Q/R
+// relational-query bit or the Storage SCP level-of-support byte.
+//
+// maxOpsInvoked and maxOpsPerformed, if nonzero, request an Asynchronous
+// Operations Window (PS3.7 D.3.3.3); a zero value omits the sub-item, which
+// per spec means the default of one outstanding operation in each direction.
+//
+// If m.localWireCompression is non-empty, it's also offered as a
+// pdu.WireCompressionSubItem (see that field's doc comment, and
+// transferSyntaxPolicy for the analogous "set on m before calling" pattern).
+//
+// traceParent, if non-empty, is a W3C traceparent string (see
+// traceParentFromContext) offered as a pdu.TraceContextSubItem
+// so the acceptor's dicomTelemetry.startAssociation can join this
+// association's span into the requestor's trace instead of starting a new,
+// disconnected one.
 func (m *contextManager) generateAssociateRequest(
 	services []sopclass.SOPUID, transferSyntaxUIDs []string,
-	maxPDUSize int) []pdu.SubItem {
+	maxPDUSize int, roles map[string]pdu.RoleSelectionSubItem,
+	identity *pdu.UserIdentitySubItem,
+	extendedNegotiation map[string]pdu.SOPClassExtendedNegotiationSubItem,
+	maxOpsInvoked, maxOpsPerformed uint16, traceParent string) []pdu.SubItem {
 	items := []pdu.SubItem{
 		&pdu.ApplicationContextItem{
 			Name: pdu.DICOMApplicationContextItemName,
@@ -70,8 +224,16 @@ func (m *contextManager) generateAssociateRequest(
 		syntaxItems := []pdu.SubItem{
 			&pdu.AbstractSyntaxSubItem{Name: sop.UID},
 		}
+		// List m.transferSyntaxPolicy's pick first: some SCPs, like this
+		// package's own pre-TransferSyntaxPolicy provider side, just take
+		// whichever TransferSyntaxSubItem came first in the presentation
+		// context rather than truly choosing among them.
+		preferred := m.transferSyntaxPolicy.Select(sop.UID, transferSyntaxUIDs)
+		syntaxItems = append(syntaxItems, &pdu.TransferSyntaxSubItem{Name: preferred})
 		for _, syntaxUID := range transferSyntaxUIDs {
-			syntaxItems = append(syntaxItems, &pdu.TransferSyntaxSubItem{Name: syntaxUID})
+			if syntaxUID != preferred {
+				syntaxItems = append(syntaxItems, &pdu.TransferSyntaxSubItem{Name: syntaxUID})
+			}
 		}
 		item := &pdu.PresentationContextItem{
 			Type:      pdu.ItemTypePresentationContextRequest,
@@ -83,25 +245,122 @@ func (m *contextManager) generateAssociateRequest(
 		m.tmpRequests[contextID] = item
 		contextID += 2 // must be odd.
 	}
-	items = append(items,
-		&pdu.UserInformationItem{
-			Items: []pdu.SubItem{
-				&pdu.UserInformationMaximumLengthItem{uint32(maxPDUSize)},
-				&pdu.ImplementationClassUIDSubItem{dicom.DefaultImplementationClassUID},
-				&pdu.ImplementationVersionNameSubItem{dicom.DefaultImplementationVersionName}}})
-
+	userInformationItems := []pdu.SubItem{
+		&pdu.UserInformationMaximumLengthItem{uint32(maxPDUSize)},
+		&pdu.ImplementationClassUIDSubItem{dicom.DefaultImplementationClassUID},
+		&pdu.ImplementationVersionNameSubItem{dicom.DefaultImplementationVersionName},
+	}
+	for _, sop := range services {
+		if role, ok := roles[sop.UID]; ok {
+			role.SOPClassUID = sop.UID
+			userInformationItems = append(userInformationItems, &role)
+		}
+	}
+	if identity != nil {
+		userInformationItems = append(userInformationItems, identity)
+	}
+	for _, sop := range services {
+		if negotiation, ok := extendedNegotiation[sop.UID]; ok {
+			negotiation.SOPClassUID = sop.UID
+			userInformationItems = append(userInformationItems, &negotiation)
+		}
+	}
+	if maxOpsInvoked != 0 || maxOpsPerformed != 0 {
+		userInformationItems = append(userInformationItems, &pdu.AsynchronousOperationsWindowSubItem{
+			MaxOpsInvoked:   maxOpsInvoked,
+			MaxOpsPerformed: maxOpsPerformed,
+		})
+	}
+	if len(m.localWireCompression) > 0 {
+		userInformationItems = append(userInformationItems, &pdu.WireCompressionSubItem{Names: m.localWireCompression})
+	}
+	if traceParent != "" {
+		userInformationItems = append(userInformationItems, &pdu.TraceContextSubItem{TraceParent: traceParent})
+	}
+	items = append(items, &pdu.UserInformationItem{Items: userInformationItems})
 	return items
 }
 
+// Authenticator validates a User Identity Negotiation sub-item (PS3.7
+// D.3.3.7) sent by an association requestor. It returns the server response
+// token to embed in a UserIdentityACSubItem -- meaningful only when the
+// requestor set identity.PositiveResponseRequested -- and ok=false to reject
+// the association with an A-ASSOCIATE-RJ "no-reason-given (user)".
+type Authenticator func(identity *pdu.UserIdentitySubItem) (serverResponse []byte, ok bool)
+
+// proposedContextsIn, implementationClassUIDIn and implementationVersionNameIn
+// scan an A_ASSOCIATE_RQ's sub-items for AssociationEventCallbacks.
+// OnAssociateRequest, which must run before onAssociateRequest's main loop
+// negotiates anything -- so they can't just reuse that loop's state.
+func proposedContextsIn(requestItems []pdu.SubItem) []ProposedContext {
+	var contexts []ProposedContext
+	for _, requestItem := range requestItems {
+		ri, ok := requestItem.(*pdu.PresentationContextItem)
+		if !ok {
+			continue
+		}
+		c := ProposedContext{ContextID: ri.ContextID}
+		for _, subItem := range ri.Items {
+			switch s := subItem.(type) {
+			case *pdu.AbstractSyntaxSubItem:
+				c.AbstractSyntaxUID = s.Name
+			case *pdu.TransferSyntaxSubItem:
+				c.TransferSyntaxUIDs = append(c.TransferSyntaxUIDs, s.Name)
+			}
+		}
+		contexts = append(contexts, c)
+	}
+	return contexts
+}
+
+func implementationClassUIDIn(requestItems []pdu.SubItem) string {
+	for _, requestItem := range requestItems {
+		ui, ok := requestItem.(*pdu.UserInformationItem)
+		if !ok {
+			continue
+		}
+		for _, subItem := range ui.Items {
+			if c, ok := subItem.(*pdu.ImplementationClassUIDSubItem); ok {
+				return c.Name
+			}
+		}
+	}
+	return ""
+}
+
+func implementationVersionNameIn(requestItems []pdu.SubItem) string {
+	for _, requestItem := range requestItems {
+		ui, ok := requestItem.(*pdu.UserInformationItem)
+		if !ok {
+			continue
+		}
+		for _, subItem := range ui.Items {
+			if c, ok := subItem.(*pdu.ImplementationVersionNameSubItem); ok {
+				return c.Name
+			}
+		}
+	}
+	return ""
+}
+
 // Called when A_ASSOCIATE_RQ pdu arrives, on the provider side. Returns a list of items to be sent in
 // the A_ASSOCIATE_AC pdu.
 func (m *contextManager) onAssociateRequest(requestItems []pdu.SubItem, maxPDUSize int) ([]pdu.SubItem, error) {
+	if m.associationEvents.OnAssociateRequest != nil {
+		if err := m.associationEvents.OnAssociateRequest(
+			m.callingAETitle, implementationClassUIDIn(requestItems), implementationVersionNameIn(requestItems),
+			proposedContextsIn(requestItems)); err != nil {
+			return nil, err
+		}
+	}
 	//var responses []*PresentationContextItem
 	responses := []pdu.SubItem{
 		&pdu.ApplicationContextItem{
 			Name: pdu.DICOMApplicationContextItemName,
 		},
 	}
+	var identityResponse *pdu.UserIdentityACSubItem
+	var roleResponses []pdu.SubItem
 	for _, requestItem := range requestItems {
 		switch ri := requestItem.(type) {
 		case *pdu.ApplicationContextItem:
@@ -111,7 +370,7 @@ func (m *contextManager) onAssociateRequest(requestItems []pdu.SubItem, maxPDUSi
 			}
 		case *pdu.PresentationContextItem:
 			var sopUID string
-			var pickedTransferSyntaxUID string
+			var offeredTransferSyntaxUIDs []string
 			for _, subItem := range ri.Items {
 				switch c := subItem.(type) {
 				case *pdu.AbstractSyntaxSubItem:
@@ -121,23 +380,34 @@ func (m *contextManager) onAssociateRequest(requestItems []pdu.SubItem, maxPDUSi
 					}
 					sopUID = c.Name
 				case *pdu.TransferSyntaxSubItem:
-					// Just pick the first syntax UID proposed by the client.
-					if pickedTransferSyntaxUID == "" {
-						pickedTransferSyntaxUID = c.Name
-					}
+					offeredTransferSyntaxUIDs = append(offeredTransferSyntaxUIDs, c.Name)
 				default:
 					return nil, fmt.Errorf("Unknown subitem in PresentationContext: %s",
 						subItem.String())
 				}
 			}
-			if sopUID == "" || pickedTransferSyntaxUID == "" {
+			if sopUID == "" || len(offeredTransferSyntaxUIDs) == 0 {
 				return nil, fmt.Errorf("SOP or transfersyntax not found in PresentationContext: %v",
 					ri.String())
 			}
+			policy := m.negotiationPolicy
+			if policy == nil {
+				policy = defaultNegotiationPolicy{m: m}
+			}
+			pickedTransferSyntaxUID, reject := policy.Negotiate(sopUID, offeredTransferSyntaxUIDs)
+			if reject != pdu.PresentationContextAccepted {
+				vlog.Infof("Provider(%p): rejecting presentation context for %v: reason %v", m, sopUID, reject)
+				responses = append(responses, &pdu.PresentationContextItem{
+					Type:      pdu.ItemTypePresentationContextResponse,
+					ContextID: ri.ContextID,
+					Result:    reject,
+				})
+				continue
+			}
 			responses = append(responses, &pdu.PresentationContextItem{
 				Type:      pdu.ItemTypePresentationContextResponse,
 				ContextID: ri.ContextID,
-				Result:    0, // accepted
+				Result:    pdu.PresentationContextAccepted,
 				Items:     []pdu.SubItem{&pdu.TransferSyntaxSubItem{Name: pickedTransferSyntaxUID}}})
 			vlog.VI(1).Infof("Provider(%p): addmapping %v %v %v",
 				m, sopUID, pickedTransferSyntaxUID, ri.ContextID)
@@ -151,17 +421,78 @@ func (m *contextManager) onAssociateRequest(requestItems []pdu.SubItem, maxPDUSi
 					m.peerImplementationClassUID = c.Name
 				case *pdu.ImplementationVersionNameSubItem:
 					m.peerImplementationVersionName = c.Name
-
+				case *pdu.RoleSelectionSubItem:
+					m.peerRoles[c.SOPClassUID] = *c
+					granted := grantedRole(roleFromSubItem(*c), m.localRoleSelection[c.SOPClassUID])
+					roleResponses = append(roleResponses, &pdu.RoleSelectionSubItem{
+						SOPClassUID: c.SOPClassUID,
+						SCURole:     granted.scuSupported(),
+						SCPRole:     granted.scpSupported(),
+					})
+				case *pdu.UserIdentitySubItem:
+					if m.authenticator == nil {
+						continue
+					}
+					serverResponse, ok := m.authenticator(c)
+					if !ok {
+						return nil, fmt.Errorf("User identity negotiation rejected: %v", c.String())
+					}
+					if c.PositiveResponseRequested {
+						identityResponse = &pdu.UserIdentityACSubItem{ServerResponse: serverResponse}
+					}
+				case *pdu.SOPClassExtendedNegotiationSubItem:
+					m.peerExtendedNegotiation[c.SOPClassUID] = *c
+				case *pdu.SOPClassCommonExtendedNegotiationSubItem:
+					m.peerCommonExtendedNegotiation[c.SOPClassUID] = *c
+				case *pdu.AsynchronousOperationsWindowSubItem:
+					m.peerMaxOpsInvoked = c.MaxOpsInvoked
+					m.peerMaxOpsPerformed = c.MaxOpsPerformed
+				case *pdu.WireCompressionSubItem:
+					if compressor, ok := negotiateWireCompressor(m.localWireCompression, c.Names); ok {
+						m.wireCompressor = compressor
+					}
+				case *pdu.TraceContextSubItem:
+					m.peerTraceParent = c.TraceParent
 				}
 			}
 		}
 	}
-	responses = append(responses,
-		&pdu.UserInformationItem{
-			Items: []pdu.SubItem{&pdu.UserInformationMaximumLengthItem{MaximumLengthReceived: uint32(maxPDUSize)}}})
+	userInformationItems := []pdu.SubItem{&pdu.UserInformationMaximumLengthItem{MaximumLengthReceived: uint32(maxPDUSize)}}
+	if identityResponse != nil {
+		userInformationItems = append(userInformationItems, identityResponse)
+	}
+	userInformationItems = append(userInformationItems, roleResponses...)
+	if m.wireCompressor != nil {
+		userInformationItems = append(userInformationItems, &pdu.WireCompressionSubItem{Names: []string{m.wireCompressor.Name()}})
+	}
+	responses = append(responses, &pdu.UserInformationItem{Items: userInformationItems})
 	vlog.VI(1).Infof("Received associate request, #contexts:%v, maxPDU:%v, implclass:%v, version:%v",
 		len(m.contextIDToAbstractSyntaxNameMap),
 		m.peerMaxPDUSize, m.peerImplementationClassUID, m.peerImplementationVersionName)
+	if m.associationEvents.OnAssociateAccept != nil {
+		proposed := proposedContextsIn(requestItems)
+		var negotiated []NegotiatedContext
+		for _, responseItem := range responses {
+			ri, ok := responseItem.(*pdu.PresentationContextItem)
+			if !ok {
+				continue
+			}
+			nc := NegotiatedContext{ContextID: ri.ContextID, Result: ri.Result}
+			for _, p := range proposed {
+				if p.ContextID == ri.ContextID {
+					nc.AbstractSyntaxUID = p.AbstractSyntaxUID
+					break
+				}
+			}
+			if ri.Result == pdu.PresentationContextAccepted {
+				if e, err := m.lookupByContextID(ri.ContextID); err == nil {
+					nc.TransferSyntaxUID = e.transferSyntaxUID
+				}
+			}
+			negotiated = append(negotiated, nc)
+		}
+		m.associationEvents.OnAssociateAccept(negotiated)
+	}
 	return responses, nil
 }
 
@@ -170,6 +501,19 @@ func (m *contextManager) onAssociateResponse(responses []pdu.SubItem) error {
 	for _, responseItem := range responses {
 		switch ri := responseItem.(type) {
 		case *pdu.PresentationContextItem:
+			request, ok := m.tmpRequests[ri.ContextID]
+			if !ok {
+				return fmt.Errorf("Unknown context ID %d for A_ASSOCIATE_AC: %v",
+					ri.ContextID,
+					ri.String())
+			}
+			if ri.Result != pdu.PresentationContextAccepted {
+				// A rejected context has no TransferSyntaxSubItem (PS3.8
+				// 9.3.3.2): the acceptor had no transfer syntax to echo
+				// back, not a malformed acceptance.
+				vlog.Infof("Provider rejected presentation context %d: reason %v", ri.ContextID, ri.Result)
+				continue
+			}
 			var pickedTransferSyntaxUID string
 			for _, subItem := range ri.Items {
 				switch c := subItem.(type) {
@@ -184,12 +528,6 @@ func (m *contextManager) onAssociateResponse(responses []pdu.SubItem) error {
 					return fmt.Errorf("Unknown subitem %s in PresentationContext: %s", subItem.String(), ri.String())
 				}
 			}
-			request, ok := m.tmpRequests[ri.ContextID]
-			if !ok {
-				return fmt.Errorf("Unknown context ID %d for A_ASSOCIATE_AC: %v",
-					ri.ContextID,
-					ri.String())
-			}
 			found := false
 			var sopUID string
 			for _, subItem := range request.Items {
@@ -216,7 +554,25 @@ func (m *contextManager) onAssociateResponse(responses []pdu.SubItem) error {
 					m.peerImplementationClassUID = c.Name
 				case *pdu.ImplementationVersionNameSubItem:
 					m.peerImplementationVersionName = c.Name
-
+				case *pdu.RoleSelectionSubItem:
+					m.peerRoles[c.SOPClassUID] = *c
+				case *pdu.UserIdentityACSubItem:
+					m.peerServerResponse = c.ServerResponse
+				case *pdu.SOPClassExtendedNegotiationSubItem:
+					m.peerExtendedNegotiation[c.SOPClassUID] = *c
+				case *pdu.SOPClassCommonExtendedNegotiationSubItem:
+					m.peerCommonExtendedNegotiation[c.SOPClassUID] = *c
+				case *pdu.AsynchronousOperationsWindowSubItem:
+					m.peerMaxOpsInvoked = c.MaxOpsInvoked
+					m.peerMaxOpsPerformed = c.MaxOpsPerformed
+				case *pdu.WireCompressionSubItem:
+					// The acceptor only ever echoes back the one
+					// compressor it picked from what we offered.
+					if len(c.Names) > 0 {
+						if compressor, ok := lookupWireCompressor(c.Names[0]); ok {
+							m.wireCompressor = compressor
+						}
+					}
 				}
 			}
 		}
@@ -248,6 +604,44 @@ func addContextMapping(
 	m.abstractSyntaxNameToContextIDMap[abstractSyntaxUID] = e
 }
 
+// presentationContexts returns the presentation contexts negotiated so far,
+// for Observer.OnAssociationEstablished. Order is unspecified.
+func (m *contextManager) presentationContexts() []PresentationContext {
+	contexts := make([]PresentationContext, 0, len(m.contextIDToAbstractSyntaxNameMap))
+	for _, e := range m.contextIDToAbstractSyntaxNameMap {
+		contexts = append(contexts, PresentationContext{
+			ContextID:         e.contextID,
+			AbstractSyntaxUID: e.abstractSyntaxUID,
+			TransferSyntaxUID: e.transferSyntaxUID,
+		})
+	}
+	return contexts
+}
+
+// lookupRole returns the SCP/SCU Role Selection (sub-item 0x54, PS3.7
+// D.3.3.4) negotiated for the given SOP class UID, if any. ok is false if
+// the peer did not send a RoleSelectionSubItem for that UID, in which case
+// the default roles (SCU only) apply. ServiceUser callers should use the
+// public ServiceUser.PeerRole instead.
+func (m *contextManager) lookupRole(abstractSyntaxUID string) (role pdu.RoleSelectionSubItem, ok bool) {
+	role, ok = m.peerRoles[abstractSyntaxUID]
+	return role, ok
+}
+
+// lookupExtendedNegotiation returns the SOP Class Extended Negotiation
+// sub-item the peer sent for the given SOP class UID, if any.
+func (m *contextManager) lookupExtendedNegotiation(abstractSyntaxUID string) (negotiation pdu.SOPClassExtendedNegotiationSubItem, ok bool) {
+	negotiation, ok = m.peerExtendedNegotiation[abstractSyntaxUID]
+	return negotiation, ok
+}
+
+// lookupMaxOps returns the Asynchronous Operations Window (PS3.7 D.3.3.3)
+// negotiated with the peer. Absent negotiation, both values default to 1,
+// i.e. one outstanding operation at a time in each direction.
+func (m *contextManager) lookupMaxOps() (maxOpsInvoked, maxOpsPerformed uint16) {
+	return m.peerMaxOpsInvoked, m.peerMaxOpsPerformed
+}
+
 // Convert an UID to a context ID.
 func (m *contextManager) lookupByAbstractSyntaxUID(name string) (contextManagerEntry, error) {
 	e, ok := m.abstractSyntaxNameToContextIDMap[name]
@@ -0,0 +1,170 @@
+package netdicom
+
+// cstoreAssociationPool caches outbound C-STORE associations opened by
+// handleCMove, so that forwarding N images to the same C-MOVE destination
+// reuses existing associations instead of paying a new TCP connect +
+// A-ASSOCIATE negotiation per image. handleCGet's inner loop already gets
+// this for free by reusing the incoming association; this pool brings
+// handleCMove's outbound path to comparable throughput.
+
+import (
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"github.com/yasushi-saito/go-dicom"
+	"github.com/yasushi-saito/go-netdicom/sopclass"
+	"v.io/x/lib/vlog"
+)
+
+// cstoreAssociationPoolEntry is one pooled, currently-idle outbound
+// association.
+type cstoreAssociationPoolEntry struct {
+	su       *ServiceUser
+	lastUsed time.Time
+}
+
+// cstoreDestinationPool holds the associations pooled for a single
+// (myAETitle, remoteAETitle, remoteHostPort) destination.
+type cstoreDestinationPool struct {
+	mu      sync.Mutex
+	idle    []*cstoreAssociationPoolEntry
+	numOpen int
+
+	// sem bounds the number of associations concurrently open to this
+	// destination; nil means unbounded. Acquired in Get, released in the
+	// release func returned to the caller.
+	sem chan struct{}
+}
+
+// cstoreAssociationPool is a registry of cstoreDestinationPool, one per
+// distinct C-MOVE destination handleCMove has sent to.
+type cstoreAssociationPool struct {
+	mu           sync.Mutex
+	destinations map[string]*cstoreDestinationPool
+
+	// idleTimeout, if nonzero, closes a pooled association that's been
+	// idle this long instead of reusing it. See
+	// ServiceProviderParams.CMoveIdleTimeout.
+	idleTimeout time.Duration
+
+	// maxPerDestination caps the number of concurrent outbound
+	// associations kept open to a single destination; zero means
+	// unbounded. See ServiceProviderParams.CMoveMaxAssociationsPerDestination.
+	maxPerDestination int
+}
+
+func newCStoreAssociationPool(idleTimeout time.Duration, maxPerDestination int) *cstoreAssociationPool {
+	return &cstoreAssociationPool{
+		destinations:      make(map[string]*cstoreDestinationPool),
+		idleTimeout:       idleTimeout,
+		maxPerDestination: maxPerDestination,
+	}
+}
+
+func cstorePoolKey(myAETitle, remoteAETitle, remoteHostPort string) string {
+	return myAETitle + "\x00" + remoteAETitle + "\x00" + remoteHostPort
+}
+
+func (p *cstoreAssociationPool) destinationPool(key string) *cstoreDestinationPool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dp, ok := p.destinations[key]
+	if !ok {
+		dp = &cstoreDestinationPool{}
+		if p.maxPerDestination > 0 {
+			dp.sem = make(chan struct{}, p.maxPerDestination)
+		}
+		p.destinations[key] = dp
+	}
+	return dp
+}
+
+// Get returns a ServiceUser associated with remoteHostPort, reusing a
+// pooled idle association for (myAETitle, remoteAETitle, remoteHostPort) if
+// one is available, or opening a new one otherwise. The caller must call
+// the returned release func exactly once when done, passing healthy=false
+// if the association should be discarded (e.g., CStore failed) rather than
+// returned to the pool.
+func (p *cstoreAssociationPool) Get(myAETitle, remoteAETitle, remoteHostPort string, tlsConfig *tls.Config) (*ServiceUser, func(healthy bool), error) {
+	key := cstorePoolKey(myAETitle, remoteAETitle, remoteHostPort)
+	dp := p.destinationPool(key)
+	if dp.sem != nil {
+		dp.sem <- struct{}{}
+	}
+	dp.mu.Lock()
+	for len(dp.idle) > 0 {
+		n := len(dp.idle) - 1
+		entry := dp.idle[n]
+		dp.idle = dp.idle[:n]
+		if p.idleTimeout > 0 && time.Since(entry.lastUsed) > p.idleTimeout {
+			vlog.VI(1).Infof("C-MOVE pool: closing idle association to %v", remoteHostPort)
+			entry.su.Release()
+			dp.numOpen--
+			continue
+		}
+		dp.mu.Unlock()
+		return entry.su, p.releaseFunc(dp, entry.su), nil
+	}
+	dp.mu.Unlock()
+
+	su, err := NewServiceUser(ServiceUserParams{
+		CalledAETitle:  remoteAETitle,
+		CallingAETitle: myAETitle,
+		SOPClasses:     sopclass.StorageClasses,
+		TLSConfig:      tlsConfig,
+	})
+	if err != nil {
+		if dp.sem != nil {
+			<-dp.sem
+		}
+		return nil, nil, err
+	}
+	su.Connect(remoteHostPort)
+	dp.mu.Lock()
+	dp.numOpen++
+	dp.mu.Unlock()
+	return su, p.releaseFunc(dp, su), nil
+}
+
+func (p *cstoreAssociationPool) releaseFunc(dp *cstoreDestinationPool, su *ServiceUser) func(healthy bool) {
+	return func(healthy bool) {
+		if healthy {
+			dp.mu.Lock()
+			dp.idle = append(dp.idle, &cstoreAssociationPoolEntry{su: su, lastUsed: time.Now()})
+			dp.mu.Unlock()
+		} else {
+			su.Release()
+			dp.mu.Lock()
+			dp.numOpen--
+			dp.mu.Unlock()
+		}
+		if dp.sem != nil {
+			<-dp.sem
+		}
+	}
+}
+
+// cstoreViaPool sends ds to remoteHostPort using an association from pool,
+// retrying once if the first C-STORE fails (e.g., the peer aborted a pooled
+// association while it sat idle). The failed association is discarded; the
+// retry takes whatever pool.Get returns next, which is another idle pooled
+// association if one is available and a newly opened one otherwise.
+func cstoreViaPool(pool *cstoreAssociationPool, myAETitle, remoteAETitle, remoteHostPort string, tlsConfig *tls.Config, ds *dicom.DataSet) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		var su *ServiceUser
+		var release func(bool)
+		su, release, err = pool.Get(myAETitle, remoteAETitle, remoteHostPort, tlsConfig)
+		if err != nil {
+			return err
+		}
+		err = su.CStore(ds)
+		release(err == nil)
+		if err == nil {
+			return nil
+		}
+		vlog.Infof("C-MOVE pool: C-STORE to %v(%v) failed on attempt %d: %v", remoteAETitle, remoteHostPort, attempt, err)
+	}
+	return err
+}
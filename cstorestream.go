@@ -0,0 +1,38 @@
+// This file adds a streaming counterpart to CStoreCallback so that large
+// instances (multi-frame CT/MR, whole-slide pathology, video endoscopic
+// storage) don't have to be buffered whole in
+// dimseCommandAssembler.dataBytes before the application gets to see them.
+// See addPDataTF's streamDataSink parameter for the wire side of this, and
+// ServiceUser.CStoreStream/CStoreFromReader for the matching SCU-side API
+// that sends from an io.Reader instead of a fully-parsed *dicom.DataSet.
+
+package netdicom
+
+import (
+	"context"
+	"io"
+
+	"github.com/yasushi-saito/go-netdicom/dimse"
+)
+
+// CStoreMeta carries the per-instance metadata extracted from a C-STORE-RQ's
+// command set -- everything a CStoreStreamCallback needs to know before any
+// of the instance's data-set bytes have arrived on the wire.
+type CStoreMeta struct {
+	TransferSyntaxUID string
+	SOPClassUID       string
+	SOPInstanceUID    string
+}
+
+// CStoreStreamCallback is the streaming counterpart to CStoreCallback: it is
+// invoked as soon as meta is known, and r yields the instance's data-set
+// bytes incrementally, as P_DATA_TF fragments arrive on the wire, rather than
+// requiring the whole instance to be buffered first.
+//
+// The callback must fully drain r, or return promptly on ctx cancellation,
+// before returning: the network reader goroutine blocks on writes to the
+// other end of r's pipe until the callback reads them.
+//
+// If ServiceProviderParams.CStoreStream is set, it takes priority over
+// CStore for C-STORE requests.
+type CStoreStreamCallback func(ctx context.Context, meta CStoreMeta, r io.Reader) dimse.Status
@@ -0,0 +1,360 @@
+// Package dicomweb fronts an existing netdicom ServiceProvider backend
+// (the same CStoreCallback/CFindCallback/CMoveCallback a DIMSE
+// ServiceProvider would use) with a DICOMweb (PS3.18) HTTP+JSON/multipart
+// interface: STOW-RS to store, QIDO-RS to query, and WADO-RS to retrieve.
+// This lets browser and cloud clients that can't speak the DIMSE
+// association protocol talk to the same backend a ServiceProvider serves.
+package dicomweb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/yasushi-saito/go-dicom"
+	"github.com/yasushi-saito/go-dicom/dicomuid"
+	"github.com/yasushi-saito/go-netdicom"
+	"github.com/yasushi-saito/go-netdicom/dimse"
+)
+
+const (
+	mimeDICOM        = "application/dicom"
+	mimeDICOMJSON    = "application/dicom+json"
+	mimeMultipartDCM = "multipart/related"
+)
+
+// Server implements QIDO-RS, WADO-RS, and STOW-RS on top of the callbacks a
+// netdicom.ServiceProvider would otherwise invoke directly, so an
+// application can expose the same backend over DIMSE and HTTP at once.
+type Server struct {
+	// CStore, CFind, and CMove back STOW-RS, QIDO-RS, and WADO-RS
+	// respectively. CMove is used (rather than CGet) because, like
+	// WADO-RS, it only needs to stream matching datasets back to the
+	// caller over the same connection the request arrived on.
+	CStore netdicom.CStoreCallback
+	CFind  netdicom.CFindCallback
+	CMove  netdicom.CMoveCallback
+
+	// TransferSyntaxUID and SOPClassUID are passed to CFind/CMove, which
+	// (per the DIMSE protocol they were designed for) require them even
+	// though DICOMweb requests don't carry them. Defaults to Explicit VR
+	// Little Endian and the Patient Root Query/Retrieve SOP class.
+	TransferSyntaxUID string
+	SOPClassUID       string
+}
+
+// NewServer creates a Server with TransferSyntaxUID and SOPClassUID set to
+// the defaults described on Server.
+func NewServer(cstore netdicom.CStoreCallback, cfind netdicom.CFindCallback, cmove netdicom.CMoveCallback) *Server {
+	return &Server{
+		CStore:            cstore,
+		CFind:             cfind,
+		CMove:             cmove,
+		TransferSyntaxUID: dicomuid.ExplicitVRLittleEndian,
+		SOPClassUID:       dicomuid.PatientRootQRFind,
+	}
+}
+
+// Handler returns the http.Handler implementing QIDO-RS, WADO-RS, and
+// STOW-RS under the conventional "/studies..." routes (PS3.18 10.4, 10.5,
+// 10.6).
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/studies", s.handleStudies)
+	mux.HandleFunc("/studies/", s.handleStudyResource)
+	return mux
+}
+
+func (s *Server) handleStudies(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.handleSTOW(w, r)
+	case http.MethodGet:
+		s.handleQIDO(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSTOW implements STOW-RS (PS3.18 10.5): POST /studies with a
+// multipart/related body, one DICOM Part 10 file per part, translated into
+// one CStore call per part.
+func (s *Server) handleSTOW(w http.ResponseWriter, r *http.Request) {
+	if s.CStore == nil {
+		http.Error(w, "STOW-RS not supported by this server", http.StatusNotImplemented)
+		return
+	}
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, mimeMultipartDCM) {
+		http.Error(w, "expected multipart/related request body", http.StatusUnsupportedMediaType)
+		return
+	}
+	boundary, ok := params["boundary"]
+	if !ok {
+		http.Error(w, "missing multipart boundary", http.StatusBadRequest)
+		return
+	}
+	mr := multipart.NewReader(r.Body, boundary)
+	var stored []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("malformed multipart body: %v", err), http.StatusBadRequest)
+			return
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to read part: %v", err), http.StatusBadRequest)
+			return
+		}
+		transferSyntaxUID, sopClassUID, sopInstanceUID, pixelData, err := splitPart10(data)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to parse DICOM part: %v", err), http.StatusBadRequest)
+			return
+		}
+		status := s.CStore(r.Context(), transferSyntaxUID, sopClassUID, sopInstanceUID, pixelData)
+		if status.Status != dimse.StatusSuccess {
+			http.Error(w, fmt.Sprintf("C-STORE of %s failed: %v", sopInstanceUID, status), http.StatusInternalServerError)
+			return
+		}
+		stored = append(stored, sopInstanceUID)
+	}
+	w.Header().Set("Content-Type", mimeDICOMJSON)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string][]string{"stored": stored})
+}
+
+// splitPart10 parses a DICOM Part 10 file and returns the fields a
+// CStoreCallback expects: the transfer syntax and SOP class/instance UIDs
+// from the file meta header, and the remaining (post-header) bytes as the
+// dataset payload, matching what a C-STORE-RQ would have carried.
+func splitPart10(data []byte) (transferSyntaxUID, sopClassUID, sopInstanceUID string, payload []byte, err error) {
+	ds, err := dicom.ReadDataSetInBytes(data, dicom.ReadOptions{})
+	if err != nil {
+		return "", "", "", nil, err
+	}
+	transferSyntaxUIDElem, err := ds.FindElementByTag(dicom.TagTransferSyntaxUID)
+	if err != nil {
+		return "", "", "", nil, err
+	}
+	sopClassUIDElem, err := ds.FindElementByTag(dicom.TagMediaStorageSOPClassUID)
+	if err != nil {
+		return "", "", "", nil, err
+	}
+	sopInstanceUIDElem, err := ds.FindElementByTag(dicom.TagMediaStorageSOPInstanceUID)
+	if err != nil {
+		return "", "", "", nil, err
+	}
+	if transferSyntaxUID, err = transferSyntaxUIDElem.GetString(); err != nil {
+		return "", "", "", nil, err
+	}
+	if sopClassUID, err = sopClassUIDElem.GetString(); err != nil {
+		return "", "", "", nil, err
+	}
+	if sopInstanceUID, err = sopInstanceUIDElem.GetString(); err != nil {
+		return "", "", "", nil, err
+	}
+	// The file meta group follows the 128-byte preamble and "DICM" magic,
+	// and starts with FileMetaInformationGroupLength (0002,0000), an
+	// explicit-VR UL whose value is the byte length of the rest of the group.
+	const groupLengthValueOffset = 128 + 4 + 8
+	if len(data) < groupLengthValueOffset+4 {
+		return "", "", "", nil, fmt.Errorf("DICOM file too short: %d bytes", len(data))
+	}
+	metaEnd := groupLengthValueOffset + 4 + int(binary.LittleEndian.Uint32(data[groupLengthValueOffset:]))
+	if metaEnd > len(data) {
+		return "", "", "", nil, fmt.Errorf("file meta group ends at byte %d, past the end of the %d-byte file", metaEnd, len(data))
+	}
+	return transferSyntaxUID, sopClassUID, sopInstanceUID, data[metaEnd:], nil
+}
+
+// qidoTagsByKeyword maps the QIDO-RS query parameter keywords this gateway
+// understands to their DICOM tags (PS3.18 6.7.1.2.1). Only the handful of
+// attributes sampleserver's backends actually index are supported; unknown
+// parameters are rejected with 400, per the spec's requirement to reject
+// unsupported search parameters rather than silently ignore them.
+var qidoTagsByKeyword = map[string]dicom.Tag{
+	"PatientName":        dicom.TagPatientName,
+	"PatientID":          dicom.TagPatientID,
+	"StudyInstanceUID":   dicom.TagStudyInstanceUID,
+	"SeriesInstanceUID":  dicom.TagSeriesInstanceUID,
+	"SOPInstanceUID":     dicom.TagMediaStorageSOPInstanceUID,
+	"QueryRetrieveLevel": dicom.TagQueryRetrieveLevel,
+}
+
+// handleQIDO implements QIDO-RS (PS3.18 10.6): GET /studies?PatientName=...,
+// translating query parameters into dicom.Element filters and returning
+// matches as a JSON array, per the application/dicom+json media type.
+func (s *Server) handleQIDO(w http.ResponseWriter, r *http.Request) {
+	if s.CFind == nil {
+		http.Error(w, "QIDO-RS not supported by this server", http.StatusNotImplemented)
+		return
+	}
+	var filters []*dicom.Element
+	for keyword, values := range r.URL.Query() {
+		tag, ok := qidoTagsByKeyword[keyword]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unsupported query parameter %q", keyword), http.StatusBadRequest)
+			return
+		}
+		elem, err := dicom.NewElement(tag)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, v := range values {
+			elem.Value = append(elem.Value, v)
+		}
+		filters = append(filters, elem)
+	}
+	ch := make(chan netdicom.CFindResult, 128)
+	go s.CFind(r.Context(), s.TransferSyntaxUID, s.SOPClassUID, filters, ch)
+
+	var results []map[string]jsonElement
+	for result := range ch {
+		if result.Err != nil {
+			http.Error(w, result.Err.Error(), http.StatusInternalServerError)
+			return
+		}
+		obj := make(map[string]jsonElement)
+		for _, elem := range result.Elements {
+			obj[dicomJSONTag(elem.Tag)] = jsonElement{Value: elem.Value}
+		}
+		results = append(results, obj)
+	}
+	w.Header().Set("Content-Type", mimeDICOMJSON)
+	json.NewEncoder(w).Encode(results)
+}
+
+// jsonElement is a minimal rendering of a DICOM element in the
+// application/dicom+json representation (PS3.18 Annex F). The VR is
+// deliberately omitted: the Element type this gateway has available
+// doesn't carry it, so callers needing a fully spec-conformant payload
+// should post-process with a dictionary lookup keyed on the tag.
+type jsonElement struct {
+	Value []string `json:"Value,omitempty"`
+}
+
+// dicomJSONTag renders tag as the 8 hex digit group+element key the DICOM
+// JSON model uses (PS3.18 F.2.2), e.g. "00100010" for PatientName.
+func dicomJSONTag(tag dicom.Tag) string {
+	return fmt.Sprintf("%04X%04X", tag.Group, tag.Element)
+}
+
+// handleStudyResource routes WADO-RS retrieval requests of the form
+// /studies/{uid}/series/{uid}/instances/{uid}.
+func (s *Server) handleStudyResource(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	studyUID, seriesUID, instanceUID, ok := parseInstanceResourcePath(r.URL.Path)
+	if !ok {
+		http.Error(w, "expected /studies/{uid}/series/{uid}/instances/{uid}", http.StatusNotFound)
+		return
+	}
+	s.handleWADO(w, r, studyUID, seriesUID, instanceUID)
+}
+
+// parseInstanceResourcePath extracts the study/series/instance UIDs from a
+// WADO-RS instance-retrieval path.
+func parseInstanceResourcePath(path string) (studyUID, seriesUID, instanceUID string, ok bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 6 || parts[0] != "studies" || parts[2] != "series" || parts[4] != "instances" {
+		return "", "", "", false
+	}
+	return parts[1], parts[3], parts[5], true
+}
+
+// handleWADO implements WADO-RS instance retrieval (PS3.18 10.4):
+// GET /studies/{uid}/series/{uid}/instances/{uid}, streaming the matching
+// DICOM Part 10 file. Accept header negotiation supports application/dicom
+// (the raw Part 10 bytes) and multipart/related;type="application/dicom"
+// (the standard WADO-RS envelope); anything else is rejected with 406, per
+// PS3.18 10.4.1.1.2's content negotiation requirement.
+func (s *Server) handleWADO(w http.ResponseWriter, r *http.Request, studyUID, seriesUID, instanceUID string) {
+	if s.CMove == nil {
+		http.Error(w, "WADO-RS not supported by this server", http.StatusNotImplemented)
+		return
+	}
+	accept := r.Header.Get("Accept")
+	multipartWrap := accept == "" || strings.Contains(accept, mimeMultipartDCM) || accept == "*/*"
+	if !multipartWrap && !strings.Contains(accept, mimeDICOM) {
+		http.Error(w, fmt.Sprintf("unsupported Accept: %q", accept), http.StatusNotAcceptable)
+		return
+	}
+
+	filters := []*dicom.Element{
+		mustElement(dicom.TagStudyInstanceUID, studyUID),
+		mustElement(dicom.TagSeriesInstanceUID, seriesUID),
+		mustElement(dicom.TagMediaStorageSOPInstanceUID, instanceUID),
+	}
+	ch := make(chan netdicom.CMoveResult, 1)
+	go s.CMove(r.Context(), s.TransferSyntaxUID, s.SOPClassUID, filters, ch)
+
+	var found *netdicom.CMoveResult
+	for result := range ch {
+		if result.Err != nil {
+			http.Error(w, result.Err.Error(), http.StatusInternalServerError)
+			return
+		}
+		copied := result
+		found = &copied
+	}
+	if found == nil {
+		http.Error(w, "no matching instance", http.StatusNotFound)
+		return
+	}
+	// TODO(saito) found.Path is whatever StorageBackend.Put returned as a
+	// location; for the localfs backend that's a real file path holding
+	// the original Part 10 bytes, but for the memory and s3 backends it's
+	// an opaque key, not something ReadFile can open. Rework this once
+	// CMoveResult can carry the encoded bytes directly instead of a path.
+	part10, err := os.ReadFile(found.Path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read %s: %v", found.Path, err), http.StatusInternalServerError)
+		return
+	}
+	if !multipartWrap {
+		w.Header().Set("Content-Type", mimeDICOM)
+		w.Write(part10)
+		return
+	}
+	writeMultipartDICOM(w, part10)
+}
+
+// writeMultipartDICOM wraps part10 in a single-part multipart/related
+// response with type="application/dicom", the conventional WADO-RS
+// envelope (PS3.18 8.7.3).
+func writeMultipartDICOM(w http.ResponseWriter, part10 []byte) {
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", fmt.Sprintf(`multipart/related; type=%q; boundary=%s`, mimeDICOM, mw.Boundary()))
+	part, err := mw.CreatePart(map[string][]string{
+		"Content-Type":   {mimeDICOM},
+		"Content-Length": {strconv.Itoa(len(part10))},
+	})
+	if err != nil {
+		return
+	}
+	part.Write(part10)
+	mw.Close()
+}
+
+func mustElement(tag dicom.Tag, value string) *dicom.Element {
+	elem, err := dicom.NewElement(tag)
+	if err != nil {
+		panic(err)
+	}
+	elem.Value = append(elem.Value, value)
+	return elem
+}
@@ -7,6 +7,8 @@ package netdicom
 import (
 	"encoding/binary"
 	"fmt"
+	"io"
+
 	"github.com/yasushi-saito/go-dicom"
 	"v.io/x/lib/vlog"
 )
@@ -18,6 +20,45 @@ type DIMSEMessage interface {
 	String() string // Produce human-readable description.
 }
 
+// dimseMessageID returns msg's MessageID (if it's a request) or
+// MessageIDBeingRespondedTo (if it's a response), for matching an upcall
+// against the invocation it belongs to when several commands are in flight
+// on the same association at once (MaxOpsInvoked/MaxOpsPerformed > 1). ok
+// is false for message types ReadDIMSEMessage doesn't decode.
+func dimseMessageID(msg DIMSEMessage) (id uint16, ok bool) {
+	switch m := msg.(type) {
+	case *C_STORE_RQ:
+		return m.MessageID, true
+	case *C_STORE_RSP:
+		return m.MessageIDBeingRespondedTo, true
+	case *C_ECHO_RQ:
+		return m.MessageID, true
+	case *C_ECHO_RSP:
+		return m.MessageIDBeingRespondedTo, true
+	default:
+		return 0, false
+	}
+}
+
+// dimseCommandField returns msg's DIMSE command field value (P3.7 E.1,
+// Table E.1-1), for dispatching to the callback registered for that command
+// and for commandFieldName's telemetry span naming. ok is false for message
+// types ReadDIMSEMessage doesn't decode.
+func dimseCommandField(msg DIMSEMessage) (field int, ok bool) {
+	switch msg.(type) {
+	case *C_STORE_RQ:
+		return 0x0001, true
+	case *C_STORE_RSP:
+		return 0x8001, true
+	case *C_ECHO_RQ:
+		return 0x0030, true
+	case *C_ECHO_RSP:
+		return 0x8030, true
+	default:
+		return 0, false
+	}
+}
+
 // Helper class for extracting values from a list of DicomElement.
 type dimseDecoder struct {
 	elems []*dicom.DicomElement
@@ -319,6 +360,17 @@ func ReadDIMSEMessage(d *dicom.Decoder) DIMSEMessage {
 	return v
 }
 
+// dimsePendingStatus returns msg's DIMSE status code and whether msg is a
+// response type that can carry PS3.7 C.1.1's intermediate "pending" status
+// (0xFF00) -- C-FIND-RSP, C-MOVE-RSP, C-GET-RSP. actionDt2 consults it to
+// route such responses to upcallEventSubOpProgress instead of the terminal
+// upcallEventData. None of the legacy types ReadDIMSEMessage decodes today
+// (C_STORE_RQ/RSP, C_ECHO_RQ/RSP) are pending-capable, so this always
+// returns ok=false without inspecting msg.
+func dimsePendingStatus(msg DIMSEMessage) (status uint16, ok bool) {
+	return 0, false
+}
+
 func EncodeDIMSEMessage(e *dicom.Encoder, v DIMSEMessage) {
 	// DIMSE messages are always encoded Implicit+LE. See P3.7 6.3.1.
 	subEncoder := dicom.NewEncoder(binary.LittleEndian, dicom.ImplicitVR)
@@ -344,12 +396,33 @@ type dimseCommandAssembler struct {
 	readAllCommand bool
 
 	readAllData bool
-}
+
+	// dataSink, if non-nil, is where incoming data-item bytes are written
+	// instead of being buffered into dataBytes; see streamDataSink. It is
+	// closed as soon as the last data fragment arrives, and the write
+	// error (if any) is folded into addPDataTF's own return value.
+	dataSink io.WriteCloser
+	// sinkConsulted records that streamDataSink has been called for the
+	// current command, so it is not asked again.
+	sinkConsulted bool
+}
+
+// streamDataSink is consulted by addPDataTF exactly once per command, right
+// after the command is decoded and before the first data item (if any) is
+// processed. If it returns ok==true, the data-set bytes are streamed to sink
+// as P_DATA_TF data items arrive, instead of being buffered whole into
+// dimseCommandAssembler.dataBytes -- this is what lets a CStoreStreamCallback
+// (see ServiceProviderParams.CStoreStream) process a multi-gigabyte instance
+// without ever holding it entirely in memory. Returning ok==false preserves
+// the original buffer-the-whole-payload behavior.
+type streamDataSink func(command DIMSEMessage) (sink io.WriteCloser, ok bool)
 
 // Add a P_DATA_TF fragment. If the final fragment is received, returns <SOPUID,
 // TransferSyntaxUID, payload, nil>.  If it expects more fragments, it retutrns
 // <"", "", nil, nil>.  On error, the final return value is non-nil.
-func addPDataTF(a *dimseCommandAssembler, pdu *P_DATA_TF, contextManager *contextManager) (string, string, DIMSEMessage, []byte, error) {
+//
+// newDataSink may be nil; see streamDataSink's doc comment.
+func addPDataTF(a *dimseCommandAssembler, pdu *P_DATA_TF, contextManager *contextManager, newDataSink streamDataSink) (string, string, DIMSEMessage, []byte, error) {
 	for _, item := range pdu.Items {
 		if a.contextID == 0 {
 			a.contextID = item.ContextID
@@ -365,12 +438,36 @@ func addPDataTF(a *dimseCommandAssembler, pdu *P_DATA_TF, contextManager *contex
 				a.readAllCommand = true
 			}
 		} else {
-			a.dataBytes = append(a.dataBytes, item.Value...)
+			if a.command == nil && a.readAllCommand {
+				d := dicom.NewBytesDecoder(a.commandBytes, nil, dicom.UnknownVR)
+				a.command = ReadDIMSEMessage(d)
+				if err := d.Finish(); err != nil {
+					return "", "", nil, nil, err
+				}
+			}
+			if a.command != nil && !a.sinkConsulted && newDataSink != nil {
+				a.sinkConsulted = true
+				if sink, ok := newDataSink(a.command); ok {
+					a.dataSink = sink
+				}
+			}
+			if a.dataSink != nil {
+				if _, err := a.dataSink.Write(item.Value); err != nil {
+					return "", "", nil, nil, err
+				}
+			} else {
+				a.dataBytes = append(a.dataBytes, item.Value...)
+			}
 			if item.Last {
 				if a.readAllData {
 					return "", "", nil, nil, fmt.Errorf("P_DATA_TF: found >1 data chunks with the Last bit set")
 				}
 				a.readAllData = true
+				if a.dataSink != nil {
+					if err := a.dataSink.Close(); err != nil {
+						return "", "", nil, nil, err
+					}
+				}
 			}
 		}
 	}
@@ -394,9 +491,20 @@ func addPDataTF(a *dimseCommandAssembler, pdu *P_DATA_TF, contextManager *contex
 	}
 	command := a.command
 	dataBytes := a.dataBytes
-	vlog.VI(1).Infof("Read all data for syntax %s, command [%v], data %d bytes, err%v",
-		dicom.UIDString(context.abstractSyntaxUID),
-		command.String(), len(a.dataBytes), err)
+	// The command set is never compressed (see splitDataIntoPDUs); only the
+	// data-set payload is, and only on the buffered path -- a dataSink
+	// consumer (see newCStoreStreamDataSink) gets the compressed bytes
+	// as-is today. TODO(saito) teach streamDataSink to decompress too.
+	if len(dataBytes) > 0 && contextManager.wireCompressor != nil {
+		decompressed, err := contextManager.wireCompressor.Decompress(dataBytes)
+		if err != nil {
+			return "", "", nil, nil, err
+		}
+		dataBytes = decompressed
+	}
+	contextManager.logger.Info("Read all data for command",
+		"syntax", dicom.UIDString(context.abstractSyntaxUID),
+		"command", command.String(), "data_bytes", len(a.dataBytes), "err", err)
 	*a = dimseCommandAssembler{}
 	return context.abstractSyntaxUID, context.transferSyntaxUID, command, dataBytes, nil
 	// TODO(saito) Verify that there's no unread items after the last command&data.
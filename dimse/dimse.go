@@ -22,6 +22,22 @@ type Message interface {
 	HasData() bool // Do we expact data P_DATA_TF packets after the command packets?
 }
 
+// Tracer receives every DIMSE command this association sends or receives,
+// for structured (as opposed to String()'s ad-hoc debug format) audit
+// logging or deterministic replay of an SCP/SCU bug report. Every message
+// type's fields are exported, so json.Marshal(msg) alone is enough to get a
+// schema-stable JSON encoding of the command set without a dedicated
+// MarshalJSON per type; data is the command's associated data-set payload
+// (if HasData()), which callers will typically want to log as a digest
+// (e.g. sha256) rather than verbatim, per their own audit retention policy.
+//
+// OnSend/OnReceive run inline on the goroutine that's sending or dispatching
+// the message, so implementations should return quickly and not block.
+type Tracer interface {
+	OnSend(msg Message, data []byte)
+	OnReceive(msg Message, data []byte)
+}
+
 // Helper class for extracting values from a list of DicomElement.
 type dimseDecoder struct {
 	elems  []*dicom.Element
@@ -126,6 +142,29 @@ func encodeField(e *dicomio.Encoder, tag dicom.Tag, v interface{}) {
 
 const CommandDataSetTypeNull uint16 = 0x101
 
+// CommandFieldC_CANCEL_RQ is the CommandField value (PS3.7 E.1) of a
+// C-CANCEL-RQ, sent by a requestor to cancel an outstanding C-FIND, C-MOVE,
+// or C-GET operation it previously issued.
+const CommandFieldC_CANCEL_RQ uint16 = 0x0FFF
+
+// CommandField* constants for the Normalized (N-*) DIMSE services (PS3.7
+// E.1). Unlike the Composite (C-*) services, these operate on a single
+// named SOP instance rather than a query/retrieve model.
+const (
+	CommandFieldN_EVENT_REPORT_RQ  uint16 = 0x0100
+	CommandFieldN_EVENT_REPORT_RSP uint16 = 0x8100
+	CommandFieldN_GET_RQ           uint16 = 0x0110
+	CommandFieldN_GET_RSP          uint16 = 0x8110
+	CommandFieldN_SET_RQ           uint16 = 0x0120
+	CommandFieldN_SET_RSP          uint16 = 0x8120
+	CommandFieldN_ACTION_RQ        uint16 = 0x0130
+	CommandFieldN_ACTION_RSP       uint16 = 0x8130
+	CommandFieldN_CREATE_RQ        uint16 = 0x0140
+	CommandFieldN_CREATE_RSP       uint16 = 0x8140
+	CommandFieldN_DELETE_RQ        uint16 = 0x0150
+	CommandFieldN_DELETE_RSP       uint16 = 0x8150
+)
+
 // Result of a DIMSE call.
 // P3.7 C defines list of status codes and error payloads.
 type Status struct {
@@ -150,6 +189,9 @@ var Success = Status{Status: StatusSuccess}
 // P3.4 GG4-1
 const (
 	StatusSuccess               StatusCode = 0
+	// StatusCancel is "Sub-operations Terminated due to Cancel Indication"
+	// (PS3.7 C.4), the status a C-FIND/C-GET/C-MOVE responder sends in its
+	// final response after ctx was canceled by a matching C-CANCEL-RQ.
 	StatusCancel                StatusCode = 0xFE00
 	StatusSOPClassNotSupported  StatusCode = 0x0112
 	StatusInvalidArgumentValue  StatusCode = 0x0115
@@ -417,10 +417,513 @@ func decodeC_ECHO_RSP(d *messageDecoder) *C_ECHO_RSP {
 	v.Extra = d.unparsedElements()
 	return v
 }
+type C_CANCEL_RQ struct  {
+	MessageIDBeingRespondedTo uint16
+	CommandDataSetType uint16
+	Extra []*dicom.Element  // Unparsed elements
+}
+
+func (v* C_CANCEL_RQ) Encode(e *dicomio.Encoder) {
+	encodeField(e, dicom.TagCommandField, uint16(0x0FFF))
+	encodeField(e, dicom.TagMessageIDBeingRespondedTo, v.MessageIDBeingRespondedTo)
+	encodeField(e, dicom.TagCommandDataSetType, v.CommandDataSetType)
+	for _, elem := range v.Extra {
+		dicom.WriteElement(e, elem)
+	}
+}
+
+func (v* C_CANCEL_RQ) HasData() bool {
+	return v.CommandDataSetType != CommandDataSetTypeNull
+}
+
+func (v* C_CANCEL_RQ) String() string {
+	return fmt.Sprintf("C_CANCEL_RQ{MessageIDBeingRespondedTo:%v CommandDataSetType:%v", v.MessageIDBeingRespondedTo, v.CommandDataSetType)
+}
+
+func decodeC_CANCEL_RQ(d *messageDecoder) *C_CANCEL_RQ {
+	v := &C_CANCEL_RQ{}
+	v.MessageIDBeingRespondedTo = d.getUInt16(dicom.TagMessageIDBeingRespondedTo, RequiredElement)
+	v.CommandDataSetType = d.getUInt16(dicom.TagCommandDataSetType, RequiredElement)
+	v.Extra = d.unparsedElements()
+	return v
+}
+type N_EVENT_REPORT_RQ struct  {
+	AffectedSOPClassUID string
+	MessageID uint16
+	EventTypeID uint16
+	AffectedSOPInstanceUID string
+	CommandDataSetType uint16
+	Extra []*dicom.Element  // Unparsed elements
+}
+
+func (v* N_EVENT_REPORT_RQ) Encode(e *dicomio.Encoder) {
+	encodeField(e, dicom.TagCommandField, uint16(0x0100))
+	encodeField(e, dicom.TagAffectedSOPClassUID, v.AffectedSOPClassUID)
+	encodeField(e, dicom.TagMessageID, v.MessageID)
+	encodeField(e, dicom.TagEventTypeID, v.EventTypeID)
+	encodeField(e, dicom.TagAffectedSOPInstanceUID, v.AffectedSOPInstanceUID)
+	encodeField(e, dicom.TagCommandDataSetType, v.CommandDataSetType)
+	for _, elem := range v.Extra {
+		dicom.WriteElement(e, elem)
+	}
+}
+
+func (v* N_EVENT_REPORT_RQ) HasData() bool {
+	return v.CommandDataSetType != CommandDataSetTypeNull
+}
+
+func (v* N_EVENT_REPORT_RQ) String() string {
+	return fmt.Sprintf("N_EVENT_REPORT_RQ{AffectedSOPClassUID:%v MessageID:%v EventTypeID:%v AffectedSOPInstanceUID:%v CommandDataSetType:%v", v.AffectedSOPClassUID, v.MessageID, v.EventTypeID, v.AffectedSOPInstanceUID, v.CommandDataSetType)
+}
+
+func decodeN_EVENT_REPORT_RQ(d *messageDecoder) *N_EVENT_REPORT_RQ {
+	v := &N_EVENT_REPORT_RQ{}
+	v.AffectedSOPClassUID = d.getString(dicom.TagAffectedSOPClassUID, RequiredElement)
+	v.MessageID = d.getUInt16(dicom.TagMessageID, RequiredElement)
+	v.EventTypeID = d.getUInt16(dicom.TagEventTypeID, RequiredElement)
+	v.AffectedSOPInstanceUID = d.getString(dicom.TagAffectedSOPInstanceUID, RequiredElement)
+	v.CommandDataSetType = d.getUInt16(dicom.TagCommandDataSetType, RequiredElement)
+	v.Extra = d.unparsedElements()
+	return v
+}
+type N_EVENT_REPORT_RSP struct  {
+	AffectedSOPClassUID string
+	MessageIDBeingRespondedTo uint16
+	EventTypeID uint16
+	AffectedSOPInstanceUID string
+	CommandDataSetType uint16
+	Status Status
+	Extra []*dicom.Element  // Unparsed elements
+}
+
+func (v* N_EVENT_REPORT_RSP) Encode(e *dicomio.Encoder) {
+	encodeField(e, dicom.TagCommandField, uint16(0x8100))
+	encodeField(e, dicom.TagAffectedSOPClassUID, v.AffectedSOPClassUID)
+	encodeField(e, dicom.TagMessageIDBeingRespondedTo, v.MessageIDBeingRespondedTo)
+	if v.EventTypeID != 0 {
+		encodeField(e, dicom.TagEventTypeID, v.EventTypeID)
+	}
+	encodeField(e, dicom.TagAffectedSOPInstanceUID, v.AffectedSOPInstanceUID)
+	encodeField(e, dicom.TagCommandDataSetType, v.CommandDataSetType)
+	encodeStatus(e, v.Status)
+	for _, elem := range v.Extra {
+		dicom.WriteElement(e, elem)
+	}
+}
+
+func (v* N_EVENT_REPORT_RSP) HasData() bool {
+	return v.CommandDataSetType != CommandDataSetTypeNull
+}
+
+func (v* N_EVENT_REPORT_RSP) String() string {
+	return fmt.Sprintf("N_EVENT_REPORT_RSP{AffectedSOPClassUID:%v MessageIDBeingRespondedTo:%v EventTypeID:%v AffectedSOPInstanceUID:%v CommandDataSetType:%v Status:%v", v.AffectedSOPClassUID, v.MessageIDBeingRespondedTo, v.EventTypeID, v.AffectedSOPInstanceUID, v.CommandDataSetType, v.Status)
+}
+
+func decodeN_EVENT_REPORT_RSP(d *messageDecoder) *N_EVENT_REPORT_RSP {
+	v := &N_EVENT_REPORT_RSP{}
+	v.AffectedSOPClassUID = d.getString(dicom.TagAffectedSOPClassUID, RequiredElement)
+	v.MessageIDBeingRespondedTo = d.getUInt16(dicom.TagMessageIDBeingRespondedTo, RequiredElement)
+	v.EventTypeID = d.getUInt16(dicom.TagEventTypeID, OptionalElement)
+	v.AffectedSOPInstanceUID = d.getString(dicom.TagAffectedSOPInstanceUID, RequiredElement)
+	v.CommandDataSetType = d.getUInt16(dicom.TagCommandDataSetType, RequiredElement)
+	v.Status = d.getStatus()
+	v.Extra = d.unparsedElements()
+	return v
+}
+type N_ACTION_RQ struct  {
+	RequestedSOPClassUID string
+	MessageID uint16
+	ActionTypeID uint16
+	RequestedSOPInstanceUID string
+	CommandDataSetType uint16
+	Extra []*dicom.Element  // Unparsed elements
+}
+
+func (v* N_ACTION_RQ) Encode(e *dicomio.Encoder) {
+	encodeField(e, dicom.TagCommandField, uint16(0x0130))
+	encodeField(e, dicom.TagRequestedSOPClassUID, v.RequestedSOPClassUID)
+	encodeField(e, dicom.TagMessageID, v.MessageID)
+	encodeField(e, dicom.TagActionTypeID, v.ActionTypeID)
+	encodeField(e, dicom.TagRequestedSOPInstanceUID, v.RequestedSOPInstanceUID)
+	encodeField(e, dicom.TagCommandDataSetType, v.CommandDataSetType)
+	for _, elem := range v.Extra {
+		dicom.WriteElement(e, elem)
+	}
+}
+
+func (v* N_ACTION_RQ) HasData() bool {
+	return v.CommandDataSetType != CommandDataSetTypeNull
+}
+
+func (v* N_ACTION_RQ) String() string {
+	return fmt.Sprintf("N_ACTION_RQ{RequestedSOPClassUID:%v MessageID:%v ActionTypeID:%v RequestedSOPInstanceUID:%v CommandDataSetType:%v", v.RequestedSOPClassUID, v.MessageID, v.ActionTypeID, v.RequestedSOPInstanceUID, v.CommandDataSetType)
+}
+
+func decodeN_ACTION_RQ(d *messageDecoder) *N_ACTION_RQ {
+	v := &N_ACTION_RQ{}
+	v.RequestedSOPClassUID = d.getString(dicom.TagRequestedSOPClassUID, RequiredElement)
+	v.MessageID = d.getUInt16(dicom.TagMessageID, RequiredElement)
+	v.ActionTypeID = d.getUInt16(dicom.TagActionTypeID, RequiredElement)
+	v.RequestedSOPInstanceUID = d.getString(dicom.TagRequestedSOPInstanceUID, RequiredElement)
+	v.CommandDataSetType = d.getUInt16(dicom.TagCommandDataSetType, RequiredElement)
+	v.Extra = d.unparsedElements()
+	return v
+}
+type N_ACTION_RSP struct  {
+	AffectedSOPClassUID string
+	MessageIDBeingRespondedTo uint16
+	ActionTypeID uint16
+	AffectedSOPInstanceUID string
+	CommandDataSetType uint16
+	Status Status
+	Extra []*dicom.Element  // Unparsed elements
+}
+
+func (v* N_ACTION_RSP) Encode(e *dicomio.Encoder) {
+	encodeField(e, dicom.TagCommandField, uint16(0x8130))
+	encodeField(e, dicom.TagAffectedSOPClassUID, v.AffectedSOPClassUID)
+	encodeField(e, dicom.TagMessageIDBeingRespondedTo, v.MessageIDBeingRespondedTo)
+	if v.ActionTypeID != 0 {
+		encodeField(e, dicom.TagActionTypeID, v.ActionTypeID)
+	}
+	encodeField(e, dicom.TagAffectedSOPInstanceUID, v.AffectedSOPInstanceUID)
+	encodeField(e, dicom.TagCommandDataSetType, v.CommandDataSetType)
+	encodeStatus(e, v.Status)
+	for _, elem := range v.Extra {
+		dicom.WriteElement(e, elem)
+	}
+}
+
+func (v* N_ACTION_RSP) HasData() bool {
+	return v.CommandDataSetType != CommandDataSetTypeNull
+}
+
+func (v* N_ACTION_RSP) String() string {
+	return fmt.Sprintf("N_ACTION_RSP{AffectedSOPClassUID:%v MessageIDBeingRespondedTo:%v ActionTypeID:%v AffectedSOPInstanceUID:%v CommandDataSetType:%v Status:%v", v.AffectedSOPClassUID, v.MessageIDBeingRespondedTo, v.ActionTypeID, v.AffectedSOPInstanceUID, v.CommandDataSetType, v.Status)
+}
+
+func decodeN_ACTION_RSP(d *messageDecoder) *N_ACTION_RSP {
+	v := &N_ACTION_RSP{}
+	v.AffectedSOPClassUID = d.getString(dicom.TagAffectedSOPClassUID, RequiredElement)
+	v.MessageIDBeingRespondedTo = d.getUInt16(dicom.TagMessageIDBeingRespondedTo, RequiredElement)
+	v.ActionTypeID = d.getUInt16(dicom.TagActionTypeID, OptionalElement)
+	v.AffectedSOPInstanceUID = d.getString(dicom.TagAffectedSOPInstanceUID, RequiredElement)
+	v.CommandDataSetType = d.getUInt16(dicom.TagCommandDataSetType, RequiredElement)
+	v.Status = d.getStatus()
+	v.Extra = d.unparsedElements()
+	return v
+}
+type N_GET_RQ struct  {
+	RequestedSOPClassUID string
+	MessageID uint16
+	RequestedSOPInstanceUID string
+	CommandDataSetType uint16
+	// AttributeIdentifierList (0000,1005), PS3.7 E.2, has no dedicated field
+	// since it's an optional multi-valued AT: it arrives in Extra like any
+	// other element generate_dimse_messages.py hasn't special-cased.
+	Extra []*dicom.Element  // Unparsed elements
+}
+
+func (v* N_GET_RQ) Encode(e *dicomio.Encoder) {
+	encodeField(e, dicom.TagCommandField, uint16(0x0110))
+	encodeField(e, dicom.TagRequestedSOPClassUID, v.RequestedSOPClassUID)
+	encodeField(e, dicom.TagMessageID, v.MessageID)
+	encodeField(e, dicom.TagRequestedSOPInstanceUID, v.RequestedSOPInstanceUID)
+	encodeField(e, dicom.TagCommandDataSetType, v.CommandDataSetType)
+	for _, elem := range v.Extra {
+		dicom.WriteElement(e, elem)
+	}
+}
+
+func (v* N_GET_RQ) HasData() bool {
+	return v.CommandDataSetType != CommandDataSetTypeNull
+}
+
+func (v* N_GET_RQ) String() string {
+	return fmt.Sprintf("N_GET_RQ{RequestedSOPClassUID:%v MessageID:%v RequestedSOPInstanceUID:%v CommandDataSetType:%v", v.RequestedSOPClassUID, v.MessageID, v.RequestedSOPInstanceUID, v.CommandDataSetType)
+}
+
+func decodeN_GET_RQ(d *messageDecoder) *N_GET_RQ {
+	v := &N_GET_RQ{}
+	v.RequestedSOPClassUID = d.getString(dicom.TagRequestedSOPClassUID, RequiredElement)
+	v.MessageID = d.getUInt16(dicom.TagMessageID, RequiredElement)
+	v.RequestedSOPInstanceUID = d.getString(dicom.TagRequestedSOPInstanceUID, RequiredElement)
+	v.CommandDataSetType = d.getUInt16(dicom.TagCommandDataSetType, RequiredElement)
+	v.Extra = d.unparsedElements()
+	return v
+}
+type N_GET_RSP struct  {
+	AffectedSOPClassUID string
+	MessageIDBeingRespondedTo uint16
+	AffectedSOPInstanceUID string
+	CommandDataSetType uint16
+	Status Status
+	Extra []*dicom.Element  // Unparsed elements
+}
+
+func (v* N_GET_RSP) Encode(e *dicomio.Encoder) {
+	encodeField(e, dicom.TagCommandField, uint16(0x8110))
+	encodeField(e, dicom.TagAffectedSOPClassUID, v.AffectedSOPClassUID)
+	encodeField(e, dicom.TagMessageIDBeingRespondedTo, v.MessageIDBeingRespondedTo)
+	encodeField(e, dicom.TagAffectedSOPInstanceUID, v.AffectedSOPInstanceUID)
+	encodeField(e, dicom.TagCommandDataSetType, v.CommandDataSetType)
+	encodeStatus(e, v.Status)
+	for _, elem := range v.Extra {
+		dicom.WriteElement(e, elem)
+	}
+}
+
+func (v* N_GET_RSP) HasData() bool {
+	return v.CommandDataSetType != CommandDataSetTypeNull
+}
+
+func (v* N_GET_RSP) String() string {
+	return fmt.Sprintf("N_GET_RSP{AffectedSOPClassUID:%v MessageIDBeingRespondedTo:%v AffectedSOPInstanceUID:%v CommandDataSetType:%v Status:%v", v.AffectedSOPClassUID, v.MessageIDBeingRespondedTo, v.AffectedSOPInstanceUID, v.CommandDataSetType, v.Status)
+}
+
+func decodeN_GET_RSP(d *messageDecoder) *N_GET_RSP {
+	v := &N_GET_RSP{}
+	v.AffectedSOPClassUID = d.getString(dicom.TagAffectedSOPClassUID, RequiredElement)
+	v.MessageIDBeingRespondedTo = d.getUInt16(dicom.TagMessageIDBeingRespondedTo, RequiredElement)
+	v.AffectedSOPInstanceUID = d.getString(dicom.TagAffectedSOPInstanceUID, RequiredElement)
+	v.CommandDataSetType = d.getUInt16(dicom.TagCommandDataSetType, RequiredElement)
+	v.Status = d.getStatus()
+	v.Extra = d.unparsedElements()
+	return v
+}
+type N_SET_RQ struct  {
+	RequestedSOPClassUID string
+	MessageID uint16
+	RequestedSOPInstanceUID string
+	CommandDataSetType uint16
+	Extra []*dicom.Element  // Unparsed elements
+}
+
+func (v* N_SET_RQ) Encode(e *dicomio.Encoder) {
+	encodeField(e, dicom.TagCommandField, uint16(0x0120))
+	encodeField(e, dicom.TagRequestedSOPClassUID, v.RequestedSOPClassUID)
+	encodeField(e, dicom.TagMessageID, v.MessageID)
+	encodeField(e, dicom.TagRequestedSOPInstanceUID, v.RequestedSOPInstanceUID)
+	encodeField(e, dicom.TagCommandDataSetType, v.CommandDataSetType)
+	for _, elem := range v.Extra {
+		dicom.WriteElement(e, elem)
+	}
+}
+
+func (v* N_SET_RQ) HasData() bool {
+	return v.CommandDataSetType != CommandDataSetTypeNull
+}
+
+func (v* N_SET_RQ) String() string {
+	return fmt.Sprintf("N_SET_RQ{RequestedSOPClassUID:%v MessageID:%v RequestedSOPInstanceUID:%v CommandDataSetType:%v", v.RequestedSOPClassUID, v.MessageID, v.RequestedSOPInstanceUID, v.CommandDataSetType)
+}
+
+func decodeN_SET_RQ(d *messageDecoder) *N_SET_RQ {
+	v := &N_SET_RQ{}
+	v.RequestedSOPClassUID = d.getString(dicom.TagRequestedSOPClassUID, RequiredElement)
+	v.MessageID = d.getUInt16(dicom.TagMessageID, RequiredElement)
+	v.RequestedSOPInstanceUID = d.getString(dicom.TagRequestedSOPInstanceUID, RequiredElement)
+	v.CommandDataSetType = d.getUInt16(dicom.TagCommandDataSetType, RequiredElement)
+	v.Extra = d.unparsedElements()
+	return v
+}
+type N_SET_RSP struct  {
+	AffectedSOPClassUID string
+	MessageIDBeingRespondedTo uint16
+	AffectedSOPInstanceUID string
+	CommandDataSetType uint16
+	Status Status
+	Extra []*dicom.Element  // Unparsed elements
+}
+
+func (v* N_SET_RSP) Encode(e *dicomio.Encoder) {
+	encodeField(e, dicom.TagCommandField, uint16(0x8120))
+	encodeField(e, dicom.TagAffectedSOPClassUID, v.AffectedSOPClassUID)
+	encodeField(e, dicom.TagMessageIDBeingRespondedTo, v.MessageIDBeingRespondedTo)
+	encodeField(e, dicom.TagAffectedSOPInstanceUID, v.AffectedSOPInstanceUID)
+	encodeField(e, dicom.TagCommandDataSetType, v.CommandDataSetType)
+	encodeStatus(e, v.Status)
+	for _, elem := range v.Extra {
+		dicom.WriteElement(e, elem)
+	}
+}
+
+func (v* N_SET_RSP) HasData() bool {
+	return v.CommandDataSetType != CommandDataSetTypeNull
+}
+
+func (v* N_SET_RSP) String() string {
+	return fmt.Sprintf("N_SET_RSP{AffectedSOPClassUID:%v MessageIDBeingRespondedTo:%v AffectedSOPInstanceUID:%v CommandDataSetType:%v Status:%v", v.AffectedSOPClassUID, v.MessageIDBeingRespondedTo, v.AffectedSOPInstanceUID, v.CommandDataSetType, v.Status)
+}
+
+func decodeN_SET_RSP(d *messageDecoder) *N_SET_RSP {
+	v := &N_SET_RSP{}
+	v.AffectedSOPClassUID = d.getString(dicom.TagAffectedSOPClassUID, RequiredElement)
+	v.MessageIDBeingRespondedTo = d.getUInt16(dicom.TagMessageIDBeingRespondedTo, RequiredElement)
+	v.AffectedSOPInstanceUID = d.getString(dicom.TagAffectedSOPInstanceUID, RequiredElement)
+	v.CommandDataSetType = d.getUInt16(dicom.TagCommandDataSetType, RequiredElement)
+	v.Status = d.getStatus()
+	v.Extra = d.unparsedElements()
+	return v
+}
+type N_CREATE_RQ struct  {
+	AffectedSOPClassUID string
+	MessageID uint16
+	AffectedSOPInstanceUID string
+	CommandDataSetType uint16
+	Extra []*dicom.Element  // Unparsed elements
+}
+
+func (v* N_CREATE_RQ) Encode(e *dicomio.Encoder) {
+	encodeField(e, dicom.TagCommandField, uint16(0x0140))
+	encodeField(e, dicom.TagAffectedSOPClassUID, v.AffectedSOPClassUID)
+	encodeField(e, dicom.TagMessageID, v.MessageID)
+	if v.AffectedSOPInstanceUID != "" {
+		encodeField(e, dicom.TagAffectedSOPInstanceUID, v.AffectedSOPInstanceUID)
+	}
+	encodeField(e, dicom.TagCommandDataSetType, v.CommandDataSetType)
+	for _, elem := range v.Extra {
+		dicom.WriteElement(e, elem)
+	}
+}
+
+func (v* N_CREATE_RQ) HasData() bool {
+	return v.CommandDataSetType != CommandDataSetTypeNull
+}
+
+func (v* N_CREATE_RQ) String() string {
+	return fmt.Sprintf("N_CREATE_RQ{AffectedSOPClassUID:%v MessageID:%v AffectedSOPInstanceUID:%v CommandDataSetType:%v", v.AffectedSOPClassUID, v.MessageID, v.AffectedSOPInstanceUID, v.CommandDataSetType)
+}
+
+func decodeN_CREATE_RQ(d *messageDecoder) *N_CREATE_RQ {
+	v := &N_CREATE_RQ{}
+	v.AffectedSOPClassUID = d.getString(dicom.TagAffectedSOPClassUID, RequiredElement)
+	v.MessageID = d.getUInt16(dicom.TagMessageID, RequiredElement)
+	v.AffectedSOPInstanceUID = d.getString(dicom.TagAffectedSOPInstanceUID, OptionalElement)
+	v.CommandDataSetType = d.getUInt16(dicom.TagCommandDataSetType, RequiredElement)
+	v.Extra = d.unparsedElements()
+	return v
+}
+type N_CREATE_RSP struct  {
+	AffectedSOPClassUID string
+	MessageIDBeingRespondedTo uint16
+	AffectedSOPInstanceUID string
+	CommandDataSetType uint16
+	Status Status
+	Extra []*dicom.Element  // Unparsed elements
+}
+
+func (v* N_CREATE_RSP) Encode(e *dicomio.Encoder) {
+	encodeField(e, dicom.TagCommandField, uint16(0x8140))
+	encodeField(e, dicom.TagAffectedSOPClassUID, v.AffectedSOPClassUID)
+	encodeField(e, dicom.TagMessageIDBeingRespondedTo, v.MessageIDBeingRespondedTo)
+	encodeField(e, dicom.TagAffectedSOPInstanceUID, v.AffectedSOPInstanceUID)
+	encodeField(e, dicom.TagCommandDataSetType, v.CommandDataSetType)
+	encodeStatus(e, v.Status)
+	for _, elem := range v.Extra {
+		dicom.WriteElement(e, elem)
+	}
+}
+
+func (v* N_CREATE_RSP) HasData() bool {
+	return v.CommandDataSetType != CommandDataSetTypeNull
+}
+
+func (v* N_CREATE_RSP) String() string {
+	return fmt.Sprintf("N_CREATE_RSP{AffectedSOPClassUID:%v MessageIDBeingRespondedTo:%v AffectedSOPInstanceUID:%v CommandDataSetType:%v Status:%v", v.AffectedSOPClassUID, v.MessageIDBeingRespondedTo, v.AffectedSOPInstanceUID, v.CommandDataSetType, v.Status)
+}
+
+func decodeN_CREATE_RSP(d *messageDecoder) *N_CREATE_RSP {
+	v := &N_CREATE_RSP{}
+	v.AffectedSOPClassUID = d.getString(dicom.TagAffectedSOPClassUID, RequiredElement)
+	v.MessageIDBeingRespondedTo = d.getUInt16(dicom.TagMessageIDBeingRespondedTo, RequiredElement)
+	v.AffectedSOPInstanceUID = d.getString(dicom.TagAffectedSOPInstanceUID, RequiredElement)
+	v.CommandDataSetType = d.getUInt16(dicom.TagCommandDataSetType, RequiredElement)
+	v.Status = d.getStatus()
+	v.Extra = d.unparsedElements()
+	return v
+}
+type N_DELETE_RQ struct  {
+	RequestedSOPClassUID string
+	MessageID uint16
+	RequestedSOPInstanceUID string
+	CommandDataSetType uint16
+	Extra []*dicom.Element  // Unparsed elements
+}
+
+func (v* N_DELETE_RQ) Encode(e *dicomio.Encoder) {
+	encodeField(e, dicom.TagCommandField, uint16(0x0150))
+	encodeField(e, dicom.TagRequestedSOPClassUID, v.RequestedSOPClassUID)
+	encodeField(e, dicom.TagMessageID, v.MessageID)
+	encodeField(e, dicom.TagRequestedSOPInstanceUID, v.RequestedSOPInstanceUID)
+	encodeField(e, dicom.TagCommandDataSetType, v.CommandDataSetType)
+	for _, elem := range v.Extra {
+		dicom.WriteElement(e, elem)
+	}
+}
+
+func (v* N_DELETE_RQ) HasData() bool {
+	return v.CommandDataSetType != CommandDataSetTypeNull
+}
+
+func (v* N_DELETE_RQ) String() string {
+	return fmt.Sprintf("N_DELETE_RQ{RequestedSOPClassUID:%v MessageID:%v RequestedSOPInstanceUID:%v CommandDataSetType:%v", v.RequestedSOPClassUID, v.MessageID, v.RequestedSOPInstanceUID, v.CommandDataSetType)
+}
+
+func decodeN_DELETE_RQ(d *messageDecoder) *N_DELETE_RQ {
+	v := &N_DELETE_RQ{}
+	v.RequestedSOPClassUID = d.getString(dicom.TagRequestedSOPClassUID, RequiredElement)
+	v.MessageID = d.getUInt16(dicom.TagMessageID, RequiredElement)
+	v.RequestedSOPInstanceUID = d.getString(dicom.TagRequestedSOPInstanceUID, RequiredElement)
+	v.CommandDataSetType = d.getUInt16(dicom.TagCommandDataSetType, RequiredElement)
+	v.Extra = d.unparsedElements()
+	return v
+}
+type N_DELETE_RSP struct  {
+	AffectedSOPClassUID string
+	MessageIDBeingRespondedTo uint16
+	AffectedSOPInstanceUID string
+	CommandDataSetType uint16
+	Status Status
+	Extra []*dicom.Element  // Unparsed elements
+}
+
+func (v* N_DELETE_RSP) Encode(e *dicomio.Encoder) {
+	encodeField(e, dicom.TagCommandField, uint16(0x8150))
+	encodeField(e, dicom.TagAffectedSOPClassUID, v.AffectedSOPClassUID)
+	encodeField(e, dicom.TagMessageIDBeingRespondedTo, v.MessageIDBeingRespondedTo)
+	encodeField(e, dicom.TagAffectedSOPInstanceUID, v.AffectedSOPInstanceUID)
+	encodeField(e, dicom.TagCommandDataSetType, v.CommandDataSetType)
+	encodeStatus(e, v.Status)
+	for _, elem := range v.Extra {
+		dicom.WriteElement(e, elem)
+	}
+}
+
+func (v* N_DELETE_RSP) HasData() bool {
+	return v.CommandDataSetType != CommandDataSetTypeNull
+}
+
+func (v* N_DELETE_RSP) String() string {
+	return fmt.Sprintf("N_DELETE_RSP{AffectedSOPClassUID:%v MessageIDBeingRespondedTo:%v AffectedSOPInstanceUID:%v CommandDataSetType:%v Status:%v", v.AffectedSOPClassUID, v.MessageIDBeingRespondedTo, v.AffectedSOPInstanceUID, v.CommandDataSetType, v.Status)
+}
+
+func decodeN_DELETE_RSP(d *messageDecoder) *N_DELETE_RSP {
+	v := &N_DELETE_RSP{}
+	v.AffectedSOPClassUID = d.getString(dicom.TagAffectedSOPClassUID, RequiredElement)
+	v.MessageIDBeingRespondedTo = d.getUInt16(dicom.TagMessageIDBeingRespondedTo, RequiredElement)
+	v.AffectedSOPInstanceUID = d.getString(dicom.TagAffectedSOPInstanceUID, RequiredElement)
+	v.CommandDataSetType = d.getUInt16(dicom.TagCommandDataSetType, RequiredElement)
+	v.Status = d.getStatus()
+	v.Extra = d.unparsedElements()
+	return v
+}
 func decodeMessageForType(d* messageDecoder, commandField uint16) Message {
 	switch commandField {
 	case 0x1:
 		return decodeC_STORE_RQ(d)
+	case 0x0FFF:
+		return decodeC_CANCEL_RQ(d)
 	case 0x8001:
 		return decodeC_STORE_RSP(d)
 	case 0x20:
@@ -439,6 +942,30 @@ func decodeMessageForType(d* messageDecoder, commandField uint16) Message {
 		return decodeC_ECHO_RQ(d)
 	case 0x8030:
 		return decodeC_ECHO_RSP(d)
+	case 0x0100:
+		return decodeN_EVENT_REPORT_RQ(d)
+	case 0x8100:
+		return decodeN_EVENT_REPORT_RSP(d)
+	case 0x0110:
+		return decodeN_GET_RQ(d)
+	case 0x8110:
+		return decodeN_GET_RSP(d)
+	case 0x0120:
+		return decodeN_SET_RQ(d)
+	case 0x8120:
+		return decodeN_SET_RSP(d)
+	case 0x0130:
+		return decodeN_ACTION_RQ(d)
+	case 0x8130:
+		return decodeN_ACTION_RSP(d)
+	case 0x0140:
+		return decodeN_CREATE_RQ(d)
+	case 0x8140:
+		return decodeN_CREATE_RSP(d)
+	case 0x0150:
+		return decodeN_DELETE_RQ(d)
+	case 0x8150:
+		return decodeN_DELETE_RSP(d)
 	default:
 		d.setError(fmt.Errorf("Unknown DIMSE command 0x%x", commandField))
 		return nil
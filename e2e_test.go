@@ -1,6 +1,7 @@
 package netdicom_test
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"github.com/yasushi-saito/go-dicom"
@@ -45,6 +46,7 @@ func onCEchoRequest() dimse.Status {
 }
 
 func onCStoreRequest(
+	ctx context.Context,
 	transferSyntaxUID string,
 	sopClassUID string,
 	sopInstanceUID string,
@@ -67,6 +69,7 @@ func onCStoreRequest(
 }
 
 func onCFindRequest(
+	ctx context.Context,
 	transferSyntaxUID string,
 	sopClassUID string,
 	filters []*dicom.Element,
@@ -101,6 +104,7 @@ func onCFindRequest(
 }
 
 func onCGetRequest(
+	ctx context.Context,
 	transferSyntaxUID string,
 	sopClassUID string,
 	filters []*dicom.Element,
@@ -0,0 +1,242 @@
+package netdicom
+
+// This file extends FaultInjector with a coverage-guided mutation strategy
+// and an on-disk regression corpus, for use from `go test -fuzz` harnesses
+// such as fuzztest and fuzze2e. Coverage here means state-machine coverage:
+// an input is "interesting" if it drives the state machine through a
+// (state,event) transition sequence not already present in the corpus,
+// tracked via FaultInjector.stateHistory.
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// interestingDICOMTokens are byte sequences known to exercise PDU/DIMSE
+// parsing edge cases: well-known UIDs and tag values that the dictionary
+// injection mutator splices into a seed verbatim.
+var interestingDICOMTokens = [][]byte{
+	[]byte("1.2.840.10008.1.1"),        // Verification SOP Class
+	[]byte("1.2.840.10008.1.2"),        // Implicit VR Little Endian
+	[]byte("1.2.840.10008.1.2.1"),      // Explicit VR Little Endian
+	{0x00, 0x00, 0x00, 0x00},           // Tag (0000,0000)
+	{0xff, 0xfe, 0xe0, 0x00},           // Item tag
+	{0xff, 0xff, 0xff, 0xff},           // Undefined length
+	{0x01, 0x00, 0x00, 0x00, 0x00, 0x00},           // A-ASSOCIATE-RQ header w/ zero length
+}
+
+// StateTransitionHash returns a hash identifying the sequence of
+// (state,event) pairs the statemachine went through while f was in use. Two
+// runs that hash equal are considered to have exercised the same
+// state-machine coverage, regardless of the bytes that drove them.
+func (f *FaultInjector) StateTransitionHash() uint64 {
+	h := sha256.New()
+	for _, t := range f.stateHistory {
+		fmt.Fprintf(h, "%s|%s\x00", t.state.String(), t.event.String())
+	}
+	sum := h.Sum(nil)
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// Corpus is an on-disk set of fuzz inputs, deduplicated by the
+// state-transition-sequence hash they were observed to produce. It is safe
+// for concurrent use.
+type Corpus struct {
+	dir string
+
+	mu   sync.Mutex
+	seen map[uint64]bool
+}
+
+// OpenCorpus opens (creating if necessary) a corpus rooted at dir, and
+// preloads the hashes of the inputs already stored there so that repeated
+// runs of the fuzzer don't re-save inputs it already knows about.
+func OpenCorpus(dir string) (*Corpus, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("netdicom: failed to create corpus dir %q: %v", dir, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("netdicom: failed to list corpus dir %q: %v", dir, err)
+	}
+	c := &Corpus{dir: dir, seen: make(map[uint64]bool)}
+	for _, entry := range entries {
+		var hash uint64
+		if _, err := fmt.Sscanf(entry.Name(), "%016x", &hash); err == nil {
+			c.seen[hash] = true
+		}
+	}
+	return c, nil
+}
+
+// path returns the on-disk path the input for the given state-transition
+// hash would be stored at.
+func (c *Corpus) path(hash uint64) string {
+	return filepath.Join(c.dir, fmt.Sprintf("%016x", hash))
+}
+
+// Seen reports whether hash (see FaultInjector.StateTransitionHash) has
+// already been recorded in this corpus.
+func (c *Corpus) Seen(hash uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seen[hash]
+}
+
+// Add persists input to the corpus under hash, unless an input producing
+// the same hash is already stored. It returns true if input was newly
+// added.
+func (c *Corpus) Add(hash uint64, input []byte) (bool, error) {
+	c.mu.Lock()
+	if c.seen[hash] {
+		c.mu.Unlock()
+		return false, nil
+	}
+	c.seen[hash] = true
+	c.mu.Unlock()
+	if err := os.WriteFile(c.path(hash), input, 0644); err != nil {
+		return false, fmt.Errorf("netdicom: failed to save corpus entry %016x: %v", hash, err)
+	}
+	return true, nil
+}
+
+// mutator is one coverage-guided mutation strategy. It returns a mutated
+// copy of seed; seed itself must not be modified.
+type mutator func(rnd *rand.Rand, seed []byte) []byte
+
+// mutators is the set of strategies Mutate samples from.
+var mutators = []mutator{
+	mutateBitFlip,
+	mutateArithmetic,
+	mutateBlockInsert,
+	mutateBlockDelete,
+	mutateBlockSplice,
+	mutateDictionaryInject,
+}
+
+// Mutate applies one randomly-chosen mutation strategy to seed and returns
+// the result. seed is never modified in place. The strategies are the ones
+// a coverage-guided fuzzer (e.g. go-fuzz, go test -fuzz) typically applies:
+// single-bit flips, small arithmetic perturbations of a single byte,
+// random block insertion/deletion, splicing a chunk from elsewhere in seed,
+// and injecting a known-interesting DICOM tag or UID.
+func Mutate(seed []byte) []byte {
+	return mutators[rand.Intn(len(mutators))](rand.New(rand.NewSource(rand.Int63())), seed)
+}
+
+func cloneBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	copy(out, b)
+	return out
+}
+
+func mutateBitFlip(rnd *rand.Rand, seed []byte) []byte {
+	if len(seed) == 0 {
+		return seed
+	}
+	out := cloneBytes(seed)
+	out[rnd.Intn(len(out))] ^= 1 << uint(rnd.Intn(8))
+	return out
+}
+
+func mutateArithmetic(rnd *rand.Rand, seed []byte) []byte {
+	if len(seed) == 0 {
+		return seed
+	}
+	out := cloneBytes(seed)
+	delta := byte(rnd.Intn(35) + 1) // +1..+35, mirrors go-fuzz's arithmetic range
+	if rnd.Intn(2) == 0 {
+		delta = 0 - delta
+	}
+	out[rnd.Intn(len(out))] += delta
+	return out
+}
+
+func mutateBlockInsert(rnd *rand.Rand, seed []byte) []byte {
+	n := rnd.Intn(16) + 1
+	block := make([]byte, n)
+	rnd.Read(block)
+	at := rnd.Intn(len(seed) + 1)
+	out := make([]byte, 0, len(seed)+n)
+	out = append(out, seed[:at]...)
+	out = append(out, block...)
+	out = append(out, seed[at:]...)
+	return out
+}
+
+func mutateBlockDelete(rnd *rand.Rand, seed []byte) []byte {
+	if len(seed) == 0 {
+		return seed
+	}
+	at := rnd.Intn(len(seed))
+	n := rnd.Intn(len(seed)-at) + 1
+	out := make([]byte, 0, len(seed)-n)
+	out = append(out, seed[:at]...)
+	out = append(out, seed[at+n:]...)
+	return out
+}
+
+func mutateBlockSplice(rnd *rand.Rand, seed []byte) []byte {
+	if len(seed) < 2 {
+		return seed
+	}
+	srcAt := rnd.Intn(len(seed))
+	srcN := rnd.Intn(len(seed)-srcAt) + 1
+	chunk := seed[srcAt : srcAt+srcN]
+	dstAt := rnd.Intn(len(seed) + 1)
+	out := make([]byte, 0, len(seed)+srcN)
+	out = append(out, seed[:dstAt]...)
+	out = append(out, chunk...)
+	out = append(out, seed[dstAt:]...)
+	return out
+}
+
+func mutateDictionaryInject(rnd *rand.Rand, seed []byte) []byte {
+	token := interestingDICOMTokens[rnd.Intn(len(interestingDICOMTokens))]
+	at := rnd.Intn(len(seed) + 1)
+	out := make([]byte, 0, len(seed)+len(token))
+	out = append(out, seed[:at]...)
+	out = append(out, token...)
+	out = append(out, seed[at:]...)
+	return out
+}
+
+// Minimize shrinks input to a smaller byte slice that still satisfies
+// isInteresting (e.g. "crashes" or "reaches the same terminal state"),
+// using a delta-debugging style approach: repeatedly try removing
+// ever-smaller chunks, keeping any removal that preserves interestingness.
+// If input itself does not satisfy isInteresting, it is returned unchanged.
+func Minimize(input []byte, isInteresting func([]byte) bool) []byte {
+	if !isInteresting(input) {
+		return input
+	}
+	current := cloneBytes(input)
+	chunkSize := len(current) / 2
+	for chunkSize > 0 {
+		changed := true
+		for changed {
+			changed = false
+			for start := 0; start < len(current); start += chunkSize {
+				end := start + chunkSize
+				if end > len(current) {
+					end = len(current)
+				}
+				candidate := make([]byte, 0, len(current)-(end-start))
+				candidate = append(candidate, current[:start]...)
+				candidate = append(candidate, current[end:]...)
+				if isInteresting(candidate) {
+					current = candidate
+					changed = true
+					break
+				}
+			}
+		}
+		chunkSize /= 2
+	}
+	return current
+}
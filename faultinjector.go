@@ -25,6 +25,13 @@ type FaultInjector struct {
 	steps int
 
 	stateHistory []faultInjectorStateTransition
+
+	// scenario, matchCounts, and pending implement the scripted (as
+	// opposed to random-fuzzing) mode of fault injection; see
+	// NewFaultInjectorFromScenario and FaultInjector.apply.
+	scenario    *FaultScenario
+	matchCounts map[string]int // "State|Event" -> times that pair has been reached
+	pending     *FaultRule     // the rule (if any) matched for the transition currently running
 }
 
 var userFaults, providerFaults *FaultInjector
@@ -84,10 +91,16 @@ func SetProviderFaultInjector(f *FaultInjector) {
 	providerFaults = f
 }
 
-func getUserFaultInjector() *FaultInjector {
+// GetUserFaultInjector returns the fault injector set by SetUserFaultInjector
+// (nil if none), for the user (client)-side statemachine to consult.
+func GetUserFaultInjector() *FaultInjector {
 	return userFaults
 }
-func getProviderFaultInjector() *FaultInjector {
+
+// GetProviderFaultInjector returns the fault injector set by
+// SetProviderFaultInjector (nil if none), for the provider (server)-side
+// statemachine to consult.
+func GetProviderFaultInjector() *FaultInjector {
 	return providerFaults
 }
 
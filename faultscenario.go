@@ -0,0 +1,189 @@
+package netdicom
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// eventsByName maps the DSL's event names ("evt09") to the package's
+// eventType values, for FaultCondition.Event/FaultAction.InjectEvent.
+var eventsByName = map[string]eventType{
+	"evt01": evt01, "evt02": evt02, "evt03": evt03, "evt04": evt04,
+	"evt05": evt05, "evt06": evt06, "evt07": evt07, "evt08": evt08,
+	"evt09": evt09, "evt10": evt10, "evt11": evt11, "evt12": evt12,
+	"evt13": evt13, "evt14": evt14, "evt15": evt15, "evt16": evt16,
+	"evt17": evt17, "evt18": evt18, "evt19": evt19,
+}
+
+// eventName returns e's DSL name, the inverse of eventsByName.
+func eventName(e eventType) string {
+	return fmt.Sprintf("evt%02d", e.Event)
+}
+
+// statesByName maps the DSL's state names ("sta06") to the package's
+// stateType values, for FaultCondition.State.
+var statesByName = map[string]*stateType{
+	"sta01": sta01, "sta02": sta02, "sta03": sta03, "sta04": sta04,
+	"sta05": sta05, "sta06": sta06, "sta07": sta07, "sta08": sta08,
+	"sta09": sta09, "sta10": sta10, "sta11": sta11, "sta12": sta12,
+	"sta13": sta13,
+}
+
+// FaultActionOp names the misbehavior a FaultRule injects.
+type FaultActionOp string
+
+const (
+	// FaultActionDrop silently discards the PDU sendPDU was about to
+	// write, simulating packet loss.
+	FaultActionDrop FaultActionOp = "drop"
+	// FaultActionDelay adds FaultAction.DelayMillis on top of the normal ARTIM
+	// duration the next time startTimer runs for the matched transition.
+	FaultActionDelay FaultActionOp = "delay"
+	// FaultActionInject replaces the matched event with
+	// FaultAction.InjectEvent before it reaches findAction, e.g. forcing
+	// evt19 (invalid PDU) in place of the Nth evt10 (P-DATA-TF), or evt12
+	// (A-RELEASE-RQ) while in sta07 to simulate a release collision.
+	FaultActionInject FaultActionOp = "inject"
+	// FaultActionCorrupt flips a byte of the PDU sendPDU was about to
+	// write before it goes out, simulating wire corruption.
+	FaultActionCorrupt FaultActionOp = "corrupt"
+)
+
+// FaultCondition selects which (state, event) transitions a FaultRule
+// applies to. An empty State or Event matches any state/event. Count, if
+// nonzero, restricts the match to the Count'th time this (state, event)
+// pair is reached (1 = the first time); zero matches every time.
+type FaultCondition struct {
+	State string `json:"state"`
+	Event string `json:"event"`
+	Count int    `json:"count"`
+}
+
+func (c FaultCondition) matches(state *stateType, event eventType, occurrence int) bool {
+	if c.State != "" && !strings.EqualFold(c.State, state.Name) {
+		return false
+	}
+	if c.Event != "" && !strings.EqualFold(c.Event, eventName(event)) {
+		return false
+	}
+	if c.Count != 0 && c.Count != occurrence {
+		return false
+	}
+	return true
+}
+
+// FaultAction is the misbehavior a FaultRule injects once its When matches.
+type FaultAction struct {
+	Op FaultActionOp `json:"op"`
+
+	// DelayMillis is the extra ARTIM duration to add, in milliseconds, for
+	// Op==FaultActionDelay.
+	DelayMillis int64 `json:"delay_ms,omitempty"`
+
+	// InjectEvent names the event (e.g. "evt19") to substitute in place of
+	// the matched one, for Op==FaultActionInject.
+	InjectEvent string `json:"inject_event,omitempty"`
+}
+
+// FaultRule is one entry in a FaultScenario: when When matches the
+// transition the state machine is about to run, inject Do.
+type FaultRule struct {
+	When FaultCondition `json:"when"`
+	Do   FaultAction    `json:"do"`
+}
+
+// FaultScenario is a declarative fault-injection script, loaded via
+// NewFaultInjectorFromFile/NewFaultInjectorFromScenario: a list of rules,
+// each matched against every (state, event) pair the state machine reaches,
+// so a test can script deterministic misbehavior (drop a specific PDU type,
+// delay ARTIM firing, force an invalid-PDU event after N P-DATA-TFs,
+// simulate a release collision) instead of NewFuzzFaultInjector's random
+// byte mutation.
+type FaultScenario struct {
+	Rules []FaultRule `json:"rules"`
+}
+
+func validateFaultScenario(scenario *FaultScenario) error {
+	for i, rule := range scenario.Rules {
+		if rule.When.State != "" {
+			if _, ok := statesByName[strings.ToLower(rule.When.State)]; !ok {
+				return fmt.Errorf("netdicom: fault scenario rule %d: unknown state %q", i, rule.When.State)
+			}
+		}
+		if rule.When.Event != "" {
+			if _, ok := eventsByName[strings.ToLower(rule.When.Event)]; !ok {
+				return fmt.Errorf("netdicom: fault scenario rule %d: unknown event %q", i, rule.When.Event)
+			}
+		}
+		switch rule.Do.Op {
+		case FaultActionDrop, FaultActionDelay, FaultActionInject, FaultActionCorrupt:
+		default:
+			return fmt.Errorf("netdicom: fault scenario rule %d: unknown action %q", i, rule.Do.Op)
+		}
+		if rule.Do.Op == FaultActionInject {
+			if _, ok := eventsByName[strings.ToLower(rule.Do.InjectEvent)]; !ok {
+				return fmt.Errorf("netdicom: fault scenario rule %d: unknown inject_event %q", i, rule.Do.InjectEvent)
+			}
+		}
+	}
+	return nil
+}
+
+// NewFaultInjectorFromScenario returns a FaultInjector that replays scenario
+// deterministically against every state transition it's consulted on (see
+// stateMachine.faults). Unlike NewFuzzFaultInjector, it never mutates random
+// bytes -- only the rules scenario spells out fire, each at most as many
+// times as its Count (if any) allows.
+func NewFaultInjectorFromScenario(scenario *FaultScenario) (*FaultInjector, error) {
+	if err := validateFaultScenario(scenario); err != nil {
+		return nil, err
+	}
+	return &FaultInjector{scenario: scenario, matchCounts: make(map[string]int)}, nil
+}
+
+// NewFaultInjectorFromFile loads a FaultScenario as JSON from path and
+// returns a FaultInjector that replays it; see NewFaultInjectorFromScenario.
+func NewFaultInjectorFromFile(path string) (*FaultInjector, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("netdicom: failed to read fault scenario %q: %v", path, err)
+	}
+	var scenario FaultScenario
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		return nil, fmt.Errorf("netdicom: failed to parse fault scenario %q: %v", path, err)
+	}
+	return NewFaultInjectorFromScenario(&scenario)
+}
+
+// apply is called once per transition, before findAction looks up what to
+// run for event. It returns the event to actually process (event itself,
+// unless a FaultActionInject rule matched) and the rule, if any, whose
+// non-inject action (drop/delay/corrupt) applies to running this
+// transition's action -- sendPDU and startTimer consult it via
+// stateMachine.faults.pending for the remainder of this step.
+func (f *FaultInjector) apply(state *stateType, event stateEvent) (newEvent stateEvent, pending *FaultRule) {
+	newEvent = event
+	if f.scenario == nil {
+		return
+	}
+	key := state.Name + "|" + eventName(event.event)
+	f.matchCounts[key]++
+	occurrence := f.matchCounts[key]
+	for i := range f.scenario.Rules {
+		rule := &f.scenario.Rules[i]
+		if !rule.When.matches(state, event.event, occurrence) {
+			continue
+		}
+		if rule.Do.Op == FaultActionInject {
+			if injected, ok := eventsByName[strings.ToLower(rule.Do.InjectEvent)]; ok {
+				newEvent = stateEvent{event: injected}
+			}
+			return
+		}
+		pending = rule
+		return
+	}
+	return
+}
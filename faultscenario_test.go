@@ -0,0 +1,66 @@
+package netdicom
+
+import "testing"
+
+func TestFaultScenarioUnknownState(t *testing.T) {
+	_, err := NewFaultInjectorFromScenario(&FaultScenario{
+		Rules: []FaultRule{{When: FaultCondition{State: "sta99"}, Do: FaultAction{Op: FaultActionDrop}}},
+	})
+	if err == nil {
+		t.Error("expected an error for an unknown state name")
+	}
+}
+
+func TestFaultScenarioUnknownAction(t *testing.T) {
+	_, err := NewFaultInjectorFromScenario(&FaultScenario{
+		Rules: []FaultRule{{When: FaultCondition{Event: "evt09"}, Do: FaultAction{Op: "explode"}}},
+	})
+	if err == nil {
+		t.Error("expected an error for an unknown action op")
+	}
+}
+
+func TestFaultScenarioApplyDrop(t *testing.T) {
+	f, err := NewFaultInjectorFromScenario(&FaultScenario{
+		Rules: []FaultRule{{
+			When: FaultCondition{State: "sta06", Event: "evt09"},
+			Do:   FaultAction{Op: FaultActionDrop},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewFaultInjectorFromScenario: %v", err)
+	}
+	_, pending := f.apply(sta06, stateEvent{event: evt09})
+	if pending == nil || pending.Do.Op != FaultActionDrop {
+		t.Errorf("expected a matched drop rule, got %+v", pending)
+	}
+	// A different (state, event) pair should not match.
+	_, pending = f.apply(sta06, stateEvent{event: evt10})
+	if pending != nil {
+		t.Errorf("expected no match for evt10, got %+v", pending)
+	}
+}
+
+func TestFaultScenarioApplyCount(t *testing.T) {
+	f, err := NewFaultInjectorFromScenario(&FaultScenario{
+		Rules: []FaultRule{{
+			When: FaultCondition{State: "sta06", Event: "evt10", Count: 2},
+			Do:   FaultAction{Op: FaultActionInject, InjectEvent: "evt19"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewFaultInjectorFromScenario: %v", err)
+	}
+	event, _ := f.apply(sta06, stateEvent{event: evt10})
+	if event.event != evt10 {
+		t.Errorf("1st occurrence: expected evt10 unchanged, got %v", event.event)
+	}
+	event, _ = f.apply(sta06, stateEvent{event: evt10})
+	if event.event != evt19 {
+		t.Errorf("2nd occurrence: expected evt10 replaced by evt19, got %v", event.event)
+	}
+	event, _ = f.apply(sta06, stateEvent{event: evt10})
+	if event.event != evt10 {
+		t.Errorf("3rd occurrence: expected evt10 unchanged again, got %v", event.event)
+	}
+}
@@ -0,0 +1,42 @@
+package netdicom
+
+import "github.com/sirupsen/logrus"
+
+// logrusLogger adapts Logger to a logrus.FieldLogger -- *logrus.Logger
+// itself, or a *logrus.Entry produced by With (both satisfy the interface,
+// which is what lets With chain).
+type logrusLogger struct {
+	l logrus.FieldLogger
+}
+
+// LogrusLogger returns a Logger that writes through l.
+func LogrusLogger(l *logrus.Logger) Logger {
+	return logrusLogger{l: l}
+}
+
+func (a logrusLogger) fields(kv []interface{}) logrus.Fields {
+	fields := make(logrus.Fields, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		if key, ok := kv[i].(string); ok {
+			fields[key] = kv[i+1]
+		}
+	}
+	return fields
+}
+
+func (a logrusLogger) Debug(msg string, kv ...interface{}) {
+	a.l.WithFields(a.fields(kv)).Debug(msg)
+}
+func (a logrusLogger) Info(msg string, kv ...interface{}) {
+	a.l.WithFields(a.fields(kv)).Info(msg)
+}
+func (a logrusLogger) Warn(msg string, kv ...interface{}) {
+	a.l.WithFields(a.fields(kv)).Warn(msg)
+}
+func (a logrusLogger) Error(msg string, kv ...interface{}) {
+	a.l.WithFields(a.fields(kv)).Error(msg)
+}
+
+func (a logrusLogger) With(kv ...interface{}) Logger {
+	return logrusLogger{l: a.l.WithFields(a.fields(kv))}
+}
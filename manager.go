@@ -0,0 +1,104 @@
+package netdicom
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// Manager tracks the associations a ServiceProvider has accepted, so that
+// they can all be force-closed together -- e.g. on server shutdown, or when
+// a modality farm's connection count needs to be capped.
+//
+// Note on scope: DICOM's upper-layer protocol (PS3.8) binds exactly one
+// association to one TCP connection. Unlike wire protocols that multiplex
+// several logical streams over a shared socket (HTTP/2, gRPC, the Beam
+// harness's state channel), there's no PDU-level demultiplexing of several
+// associations over one net.Conn to borrow here, so Manager doesn't attempt
+// to share a single reader goroutine across associations -- each one
+// RunProviderForConnContext starts still owns its own reader/writer
+// goroutine pair and netCh/errorCh/timerCh. What Manager adds is a single
+// place to track every association an accept loop has started and
+// collectively abort them, by canceling the per-association context each
+// one was started with.
+type Manager struct {
+	mu      sync.RWMutex
+	nextID  uint64
+	cancels map[uint64]context.CancelFunc
+}
+
+// NewManager creates an empty Manager.
+func NewManager() *Manager {
+	return &Manager{cancels: make(map[uint64]context.CancelFunc)}
+}
+
+// Serve accepts connections from listener until Accept returns an error,
+// running each accepted connection as a provider association via
+// RunProviderForConnContext and registering it with m so that m.Shutdown
+// can force-close it. It blocks until the listener stops accepting
+// connections, then returns ctx.Err() if ctx has been canceled by then and
+// Accept's error otherwise. Canceling ctx does not by itself interrupt a
+// blocked Accept; the listener has to be closed for Serve to return.
+func (m *Manager) Serve(ctx context.Context, listener net.Listener, params ServiceProviderParams) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+				return err
+			}
+		}
+		go m.runAndRegister(ctx, conn, params)
+	}
+}
+
+// runAndRegister runs one provider association over conn under a context
+// derived from ctx, registering its cancel func with m for the association's
+// lifetime so that m.Shutdown can abort it.
+func (m *Manager) runAndRegister(ctx context.Context, conn net.Conn, params ServiceProviderParams) {
+	assocCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	id := m.register(cancel)
+	defer m.unregister(id)
+	RunProviderForConnContext(assocCtx, conn, params)
+}
+
+func (m *Manager) register(cancel context.CancelFunc) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	id := m.nextID
+	m.cancels[id] = cancel
+	return id
+}
+
+func (m *Manager) unregister(id uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.cancels, id)
+}
+
+// NumAssociations returns the number of associations m is currently
+// tracking.
+func (m *Manager) NumAssociations() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.cancels)
+}
+
+// Shutdown force-closes (aborts, via evt15) every association m is
+// currently tracking, by canceling the context each one is running under.
+// It does not wait for the aborted associations to finish tearing down.
+func (m *Manager) Shutdown() {
+	m.mu.Lock()
+	cancels := make([]context.CancelFunc, 0, len(m.cancels))
+	for _, cancel := range m.cancels {
+		cancels = append(cancels, cancel)
+	}
+	m.mu.Unlock()
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
@@ -0,0 +1,246 @@
+// Package mediadir assembles a DICOMDIR (Media Storage Directory, PS3.3
+// Annex F) describing a set of DICOM files laid out on a filesystem, so that
+// the directory plus the files it references forms a portable tree suitable
+// for burning to removable media or otherwise handing to a viewer that
+// expects a DICOMDIR at the root.
+//
+// A Builder is meant to sit downstream of a CStoreCallback: as each incoming
+// instance is written to disk, the callback also calls Builder.Add with the
+// instance's parsed dataset and its path relative to the media root, then
+// periodically (or once, at the end) calls Builder.Write to (re)generate the
+// DICOMDIR.
+package mediadir
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/yasushi-saito/go-dicom"
+	"github.com/yasushi-saito/go-dicom/dicomio"
+)
+
+// DICOMDIR-specific tags (PS3.6 Annex A.2's Directory Structuring Elements).
+// None of them have named dicom.Tag* constants elsewhere in this tree, since
+// no other file here encodes a directory record, so they're spelled out here
+// as literal (group, element) pairs instead.
+var (
+	tagFileSetID                         = dicom.Tag{0x0004, 0x1130}
+	tagFileSetConsistencyFlag            = dicom.Tag{0x0004, 0x1212}
+	tagDirectoryRecordSequence           = dicom.Tag{0x0004, 0x1220}
+	tagDirectoryRecordType               = dicom.Tag{0x0004, 0x1430}
+	tagReferencedFileID                  = dicom.Tag{0x0004, 0x1500}
+	tagReferencedSOPClassUIDInFile       = dicom.Tag{0x0004, 0x1510}
+	tagReferencedSOPInstanceUIDInFile    = dicom.Tag{0x0004, 0x1511}
+	tagReferencedTransferSyntaxUIDInFile = dicom.Tag{0x0004, 0x1512}
+)
+
+// mediaStorageDirectoryStorageUID is the SOP Class UID of a DICOMDIR itself
+// (PS3.4 Annex F); also reachable as sopclass.NonPatientObjectClasses'
+// "MediaStorageDirectoryStorage" entry.
+const mediaStorageDirectoryStorageUID = "1.2.840.10008.1.3.10"
+
+// Builder incrementally assembles a DICOMDIR's PATIENT -> STUDY -> SERIES ->
+// IMAGE directory record hierarchy as instances are stored, filling in
+// ReferencedFileID/ReferencedSOPClassUIDInFile/ReferencedSOPInstanceUIDInFile/
+// ReferencedTransferSyntaxUIDInFile for each IMAGE record the same way
+// dcmtk's dcmgpdir does. It is safe for concurrent use.
+type Builder struct {
+	rootDir string
+
+	mu       sync.Mutex
+	patients map[string]*patientRecord
+	order    []string // PatientID insertion order, for deterministic Write output
+}
+
+type patientRecord struct {
+	patientID   string
+	patientName string
+	studies     map[string]*studyRecord
+	order       []string
+}
+
+type studyRecord struct {
+	studyInstanceUID string
+	studyDate        string
+	studyID          string
+	series           map[string]*seriesRecord
+	order            []string
+}
+
+type seriesRecord struct {
+	seriesInstanceUID string
+	modality          string
+	images            []*imageRecord
+}
+
+type imageRecord struct {
+	sopInstanceUID    string
+	sopClassUID       string
+	transferSyntaxUID string
+	referencedFileID  []string // path components relative to rootDir
+}
+
+// NewBuilder creates an empty Builder. rootDir is both where Write will
+// create the DICOMDIR file and the base that Add's relPath argument (and the
+// resulting ReferencedFileID component list) is relative to.
+func NewBuilder(rootDir string) *Builder {
+	return &Builder{rootDir: rootDir, patients: make(map[string]*patientRecord)}
+}
+
+// Add records one stored instance, found at relPath (relative to the
+// rootDir passed to NewBuilder, e.g. "DICOM/0001"), into the builder's
+// PATIENT/STUDY/SERIES/IMAGE hierarchy. dataset must carry PatientID,
+// StudyInstanceUID, and SeriesInstanceUID in addition to the usual SOP
+// class/instance/transfer syntax metadata; a CStoreCallback implementation
+// typically gets all of these by writing a file header in front of its data
+// payload and decoding the result with dicom.ReadDataSetInBytes before
+// calling Add, as mediadirserver does.
+func (b *Builder) Add(dataset *dicom.DataSet, relPath string) error {
+	patientID, err := elementString(dataset, dicom.TagPatientID)
+	if err != nil {
+		return fmt.Errorf("mediadir: %v", err)
+	}
+	patientName, _ := elementString(dataset, dicom.TagPatientName)
+	studyUID, err := elementString(dataset, dicom.TagStudyInstanceUID)
+	if err != nil {
+		return fmt.Errorf("mediadir: %v", err)
+	}
+	studyDate, _ := elementString(dataset, dicom.TagStudyDate)
+	studyID, _ := elementString(dataset, dicom.TagStudyID)
+	seriesUID, err := elementString(dataset, dicom.TagSeriesInstanceUID)
+	if err != nil {
+		return fmt.Errorf("mediadir: %v", err)
+	}
+	modality, _ := elementString(dataset, dicom.TagModality)
+	sopClassUID, err := elementString(dataset, dicom.TagMediaStorageSOPClassUID)
+	if err != nil {
+		return fmt.Errorf("mediadir: no SOP class UID in dataset: %v", err)
+	}
+	sopInstanceUID, err := elementString(dataset, dicom.TagMediaStorageSOPInstanceUID)
+	if err != nil {
+		return fmt.Errorf("mediadir: no SOP instance UID in dataset: %v", err)
+	}
+	transferSyntaxUID, err := elementString(dataset, dicom.TagTransferSyntaxUID)
+	if err != nil {
+		return fmt.Errorf("mediadir: %v", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	patient, ok := b.patients[patientID]
+	if !ok {
+		patient = &patientRecord{
+			patientID:   patientID,
+			patientName: patientName,
+			studies:     make(map[string]*studyRecord),
+		}
+		b.patients[patientID] = patient
+		b.order = append(b.order, patientID)
+	}
+	study, ok := patient.studies[studyUID]
+	if !ok {
+		study = &studyRecord{
+			studyInstanceUID: studyUID,
+			studyDate:        studyDate,
+			studyID:          studyID,
+			series:           make(map[string]*seriesRecord),
+		}
+		patient.studies[studyUID] = study
+		patient.order = append(patient.order, studyUID)
+	}
+	series, ok := study.series[seriesUID]
+	if !ok {
+		series = &seriesRecord{seriesInstanceUID: seriesUID, modality: modality}
+		study.series[seriesUID] = series
+		study.order = append(study.order, seriesUID)
+	}
+	series.images = append(series.images, &imageRecord{
+		sopInstanceUID:    sopInstanceUID,
+		sopClassUID:       sopClassUID,
+		transferSyntaxUID: transferSyntaxUID,
+		referencedFileID:  strings.Split(filepath.ToSlash(relPath), "/"),
+	})
+	return nil
+}
+
+func elementString(ds *dicom.DataSet, tag dicom.Tag) (string, error) {
+	elem, err := ds.FindElementByTag(tag)
+	if err != nil {
+		return "", err
+	}
+	return elem.GetString()
+}
+
+// Write renders the accumulated PATIENT/STUDY/SERIES/IMAGE hierarchy as a
+// DICOMDIR file at rootDir/DICOMDIR (the name and location PS3.10 F.3.2.1
+// requires), overwriting it if it already exists. It may be called again
+// after further Adds to refresh the file.
+func (b *Builder) Write() error {
+	b.mu.Lock()
+	records := b.buildRecords()
+	b.mu.Unlock()
+
+	e := dicomio.NewBytesEncoder(nil, dicomio.ExplicitVR)
+	dicom.WriteFileHeader(e, []*dicom.Element{
+		dicom.MustNewElement(dicom.TagMediaStorageSOPClassUID, mediaStorageDirectoryStorageUID),
+		dicom.MustNewElement(dicom.TagMediaStorageSOPInstanceUID, mediaStorageDirectoryStorageUID),
+	})
+	dicom.WriteElement(e, dicom.MustNewElement(tagFileSetID, ""))
+	dicom.WriteElement(e, dicom.MustNewElement(tagFileSetConsistencyFlag, uint16(0)))
+	dicom.WriteElement(e, &dicom.Element{Tag: tagDirectoryRecordSequence, Value: records})
+	if err := e.Error(); err != nil {
+		return fmt.Errorf("mediadir: encode DICOMDIR: %v", err)
+	}
+	return os.WriteFile(filepath.Join(b.rootDir, "DICOMDIR"), e.Bytes(), 0644)
+}
+
+// buildRecords flattens the PATIENT/STUDY/SERIES/IMAGE hierarchy into the
+// nested []interface{} of *dicom.DataSet items DirectoryRecordSequence
+// expects, one item per record, each tagged with its DirectoryRecordType
+// (PS3.3 F.5) and the record-type-specific attributes PS3.3 Annex F.5 lists.
+//
+// This is the one part of this package that couldn't be checked against the
+// actual go-dicom dependency in this checkout (nothing else in this tree
+// encodes an SQ element to compare against); re-verify the Item nesting here
+// once a real build of go-dicom is available.
+func (b *Builder) buildRecords() []interface{} {
+	var records []interface{}
+	for _, patientID := range b.order {
+		patient := b.patients[patientID]
+		records = append(records, &dicom.DataSet{Elements: []*dicom.Element{
+			dicom.MustNewElement(tagDirectoryRecordType, "PATIENT"),
+			dicom.MustNewElement(dicom.TagPatientID, patient.patientID),
+			dicom.MustNewElement(dicom.TagPatientName, patient.patientName),
+		}})
+		for _, studyUID := range patient.order {
+			study := patient.studies[studyUID]
+			records = append(records, &dicom.DataSet{Elements: []*dicom.Element{
+				dicom.MustNewElement(tagDirectoryRecordType, "STUDY"),
+				dicom.MustNewElement(dicom.TagStudyInstanceUID, study.studyInstanceUID),
+				dicom.MustNewElement(dicom.TagStudyDate, study.studyDate),
+				dicom.MustNewElement(dicom.TagStudyID, study.studyID),
+			}})
+			for _, seriesUID := range study.order {
+				series := study.series[seriesUID]
+				records = append(records, &dicom.DataSet{Elements: []*dicom.Element{
+					dicom.MustNewElement(tagDirectoryRecordType, "SERIES"),
+					dicom.MustNewElement(dicom.TagSeriesInstanceUID, series.seriesInstanceUID),
+					dicom.MustNewElement(dicom.TagModality, series.modality),
+				}})
+				for _, image := range series.images {
+					records = append(records, &dicom.DataSet{Elements: []*dicom.Element{
+						dicom.MustNewElement(tagDirectoryRecordType, "IMAGE"),
+						dicom.MustNewElement(tagReferencedFileID, image.referencedFileID),
+						dicom.MustNewElement(tagReferencedSOPClassUIDInFile, image.sopClassUID),
+						dicom.MustNewElement(tagReferencedSOPInstanceUIDInFile, image.sopInstanceUID),
+						dicom.MustNewElement(tagReferencedTransferSyntaxUIDInFile, image.transferSyntaxUID),
+					}})
+				}
+			}
+		}
+	}
+	return records
+}
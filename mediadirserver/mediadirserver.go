@@ -0,0 +1,97 @@
+// Command mediadirserver is a variant of the basic C-STORE example that
+// writes each received instance under -dir and maintains a DICOMDIR
+// alongside them, so -dir ends up as a portable filesystem-plus-DICOMDIR
+// tree suitable for burning to removable media.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/yasushi-saito/go-dicom"
+	"github.com/yasushi-saito/go-dicom/dicomio"
+	"github.com/yasushi-saito/go-netdicom"
+	"github.com/yasushi-saito/go-netdicom/dimse"
+	"github.com/yasushi-saito/go-netdicom/mediadir"
+	"v.io/x/lib/vlog"
+)
+
+var (
+	portFlag = flag.String("port", "10000", "TCP port to listen to")
+	dirFlag  = flag.String("dir", ".", "Directory to write received files and DICOMDIR under")
+)
+
+var pathSeq int32
+
+func onCStore(
+	ctx context.Context,
+	builder *mediadir.Builder,
+	rootDir string,
+	transferSyntaxUID, sopClassUID, sopInstanceUID string,
+	data []byte) dimse.Status {
+	relPath := filepath.Join("DICOM", fmt.Sprintf("image%04d.dcm", atomic.AddInt32(&pathSeq, 1)))
+
+	e := dicomio.NewBytesEncoder(nil, dicomio.UnknownVR)
+	dicom.WriteFileHeader(e, []*dicom.Element{
+		dicom.MustNewElement(dicom.TagTransferSyntaxUID, transferSyntaxUID),
+		dicom.MustNewElement(dicom.TagMediaStorageSOPClassUID, sopClassUID),
+		dicom.MustNewElement(dicom.TagMediaStorageSOPInstanceUID, sopInstanceUID),
+	})
+	e.WriteBytes(data)
+	if err := e.Error(); err != nil {
+		vlog.Errorf("%s: failed to encode: %v", sopInstanceUID, err)
+		return dimse.Status{Status: dimse.CStoreStatusCannotUnderstand}
+	}
+	fileBytes := e.Bytes()
+
+	fullPath := filepath.Join(rootDir, relPath)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		vlog.Errorf("%s: %v", fullPath, err)
+		return dimse.Status{Status: dimse.CStoreStatusOutOfResources}
+	}
+	if err := os.WriteFile(fullPath, fileBytes, 0644); err != nil {
+		vlog.Errorf("%s: %v", fullPath, err)
+		return dimse.Status{Status: dimse.CStoreStatusOutOfResources}
+	}
+
+	ds, err := dicom.ReadDataSetInBytes(fileBytes, dicom.ReadOptions{DropPixelData: true})
+	if err != nil {
+		vlog.Errorf("%s: failed to reparse stored file for DICOMDIR: %v", fullPath, err)
+		return dimse.Success
+	}
+	if err := builder.Add(ds, relPath); err != nil {
+		vlog.Errorf("%s: failed to add to DICOMDIR: %v", fullPath, err)
+		return dimse.Success
+	}
+	if err := builder.Write(); err != nil {
+		vlog.Errorf("failed to write DICOMDIR under %s: %v", rootDir, err)
+	}
+	vlog.Infof("Stored %s at %s", sopInstanceUID, fullPath)
+	return dimse.Success
+}
+
+func main() {
+	flag.Parse()
+	vlog.ConfigureLibraryLoggerFromFlags()
+	port := *portFlag
+	if !strings.Contains(port, ":") {
+		port = ":" + port
+	}
+	builder := mediadir.NewBuilder(*dirFlag)
+	params := netdicom.ServiceProviderParams{
+		CStore: func(ctx context.Context, transferSyntaxUID, sopClassUID, sopInstanceUID string, data []byte) dimse.Status {
+			return onCStore(ctx, builder, *dirFlag, transferSyntaxUID, sopClassUID, sopInstanceUID, data)
+		},
+	}
+	sp, err := netdicom.NewServiceProvider(params, port)
+	if err != nil {
+		vlog.Fatalf("listen on %s: %v", port, err)
+	}
+	vlog.Infof("Listening on %s, writing media tree under %s", port, *dirFlag)
+	sp.Run()
+}
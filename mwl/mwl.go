@@ -0,0 +1,131 @@
+// Package mwl supports implementing a Modality Worklist (PS3.4 Annex K)
+// C-FIND SCP: a typed WorklistItem for one Scheduled Procedure Step, and
+// Filter for applying the standard matching-key rules (universal, single
+// value, wildcard, range -- PS3.4 C.2.2.2) a requestor's query expects,
+// equivalent to what DCMTK's wlmscpfs provides.
+package mwl
+
+import (
+	"github.com/yasushi-saito/go-dicom"
+)
+
+// WorklistItem is one Scheduled Procedure Step, flattening together the
+// patient- and requested-procedure-level attributes with the Scheduled
+// Procedure Step Sequence item PS3.4 K.6 nests them under.
+type WorklistItem struct {
+	PatientID   string
+	PatientName string
+
+	AccessionNumber               string
+	RequestedProcedureID          string
+	RequestedProcedureDescription string
+
+	ScheduledProcedureStepID          string
+	ScheduledProcedureStepDescription string
+	ScheduledStationAETitle           string
+	Modality                          string
+
+	// ScheduledProcedureStepStartDateTime is "YYYYMMDDHHMMSS" (the
+	// Scheduled Procedure Step Start Date and Start Time concatenated);
+	// split into the two DICOM elements when encoded.
+	ScheduledProcedureStepStartDateTime string
+}
+
+// scheduledProcedureStepSequence (0040,0100) has no dicom.Tag* constant
+// elsewhere in this tree, since nothing else here encodes or queries a
+// Modality Worklist item; it's spelled out as a literal (group, element)
+// pair instead.
+var tagScheduledProcedureStepSequence = dicom.Tag{0x0040, 0x0100}
+
+// ToDataSet renders w the way a Modality Worklist C-FIND response encodes a
+// Scheduled Procedure Step: patient/requested-procedure attributes at the
+// top level, and the scheduling attributes nested one level down inside a
+// single-item ScheduledProcedureStepSequence.
+func (w WorklistItem) ToDataSet() *dicom.DataSet {
+	startDate, startTime := splitDateTime(w.ScheduledProcedureStepStartDateTime)
+	sps := &dicom.DataSet{Elements: []*dicom.Element{
+		dicom.MustNewElement(dicom.TagScheduledProcedureStepID, w.ScheduledProcedureStepID),
+		dicom.MustNewElement(dicom.TagScheduledProcedureStepDescription, w.ScheduledProcedureStepDescription),
+		dicom.MustNewElement(dicom.TagScheduledStationAETitle, w.ScheduledStationAETitle),
+		dicom.MustNewElement(dicom.TagScheduledProcedureStepStartDate, startDate),
+		dicom.MustNewElement(dicom.TagScheduledProcedureStepStartTime, startTime),
+		dicom.MustNewElement(dicom.TagModality, w.Modality),
+	}}
+	return &dicom.DataSet{Elements: []*dicom.Element{
+		dicom.MustNewElement(dicom.TagPatientID, w.PatientID),
+		dicom.MustNewElement(dicom.TagPatientName, w.PatientName),
+		dicom.MustNewElement(dicom.TagAccessionNumber, w.AccessionNumber),
+		dicom.MustNewElement(dicom.TagRequestedProcedureID, w.RequestedProcedureID),
+		dicom.MustNewElement(dicom.TagRequestedProcedureDescription, w.RequestedProcedureDescription),
+		{Tag: tagScheduledProcedureStepSequence, Value: []interface{}{sps}},
+	}}
+}
+
+func splitDateTime(dt string) (date, time string) {
+	if len(dt) <= 8 {
+		return dt, ""
+	}
+	return dt[:8], dt[8:]
+}
+
+// flatten expands any sequence (SQ) elements of ds -- recursively, at every
+// nesting depth, though a Scheduled Procedure Step Sequence item needs only
+// one level -- into their constituent elements, so Match can compare a worklist item's nested
+// representation against a query's nested filters element-by-element via
+// dicom.Query, which only looks at ds's top level.
+func flatten(ds *dicom.DataSet) []*dicom.Element {
+	var out []*dicom.Element
+	for _, elem := range ds.Elements {
+		var nested []*dicom.DataSet
+		for _, v := range elem.Value {
+			if sub, ok := v.(*dicom.DataSet); ok {
+				nested = append(nested, sub)
+			}
+		}
+		if len(nested) == 0 {
+			out = append(out, elem)
+			continue
+		}
+		for _, sub := range nested {
+			out = append(out, flatten(sub)...)
+		}
+	}
+	return out
+}
+
+// Match reports whether item satisfies every element of query, using
+// dicom.Query's matching-key semantics (the same mechanism this package's
+// sibling sample backends use for Patient/Study-root C-FIND) against item's
+// flattened representation. Elements nested inside query's own
+// ScheduledProcedureStepSequence item (e.g. ScheduledStationAETitle,
+// Modality) are matched the same way as top-level elements (e.g.
+// PatientID), since both sides are flattened identically first.
+func Match(item WorklistItem, query []*dicom.Element) (bool, error) {
+	flat := &dicom.DataSet{Elements: flatten(item.ToDataSet())}
+	for _, filter := range flatten(&dicom.DataSet{Elements: query}) {
+		ok, _, err := dicom.Query(flat, filter)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Filter returns the subset of items matching every element of query, per
+// Match.
+func Filter(items []WorklistItem, query []*dicom.Element) ([]WorklistItem, error) {
+	var matches []WorklistItem
+	for _, item := range items {
+		ok, err := Match(item, query)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, item)
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,85 @@
+package netdicom
+
+import (
+	"github.com/yasushi-saito/go-dicom/dicomuid"
+	"github.com/yasushi-saito/go-netdicom/pdu"
+	"github.com/yasushi-saito/go-netdicom/sopclass"
+)
+
+// NegotiationPolicy decides, for one presentation context proposed in an
+// A_ASSOCIATE_RQ, whether to accept it and with which transfer syntax, or to
+// reject it and with what PS3.8 Table 9-18 reason. It sits above
+// TransferSyntaxPolicy, which only ever picks among the transfer syntaxes
+// offered and has no way to reject a context outright -- rejection for an
+// abstract syntax this provider doesn't support, or a transfer syntax it
+// can't use, or an application-level access decision, all belong here
+// instead.
+//
+// See ServiceProviderParams.NegotiationPolicy. If that field is nil,
+// onAssociateRequest uses defaultNegotiationPolicy, which reproduces this
+// package's original behavior.
+type NegotiationPolicy interface {
+	// Negotiate is called once per proposed presentation context.
+	// transferSyntaxUIDs is always non-empty. Returning reject ==
+	// pdu.PresentationContextAccepted means accept the context using
+	// transferSyntaxUID, which must be one of transferSyntaxUIDs; any
+	// other reject value means transferSyntaxUID is ignored and the
+	// context is rejected with that reason.
+	Negotiate(abstractSyntaxUID string, transferSyntaxUIDs []string) (transferSyntaxUID string, reject pdu.PresentationContextResult)
+}
+
+// defaultNegotiationPolicy implements NegotiationPolicy in terms of this
+// package's older, narrower negotiation knobs -- acceptUnknownSOPClasses /
+// acceptUnknownSOPClassesFilter and transferSyntaxPolicy -- so a
+// ServiceProviderParams that sets those but leaves NegotiationPolicy nil
+// keeps behaving exactly as it did before NegotiationPolicy existed.
+type defaultNegotiationPolicy struct {
+	m *contextManager
+}
+
+func (p defaultNegotiationPolicy) Negotiate(abstractSyntaxUID string, transferSyntaxUIDs []string) (string, pdu.PresentationContextResult) {
+	m := p.m
+	if _, known := sopclass.LookupByUID(abstractSyntaxUID); !known &&
+		!m.acceptUnknownSOPClasses &&
+		!(m.acceptUnknownSOPClassesFilter != nil && m.acceptUnknownSOPClassesFilter(m.callingAETitle, m.callerIP)) {
+		return "", pdu.PresentationContextProviderRejectionAbstractSyntaxNotSupported
+	}
+	return m.transferSyntaxPolicy.Select(abstractSyntaxUID, transferSyntaxUIDs), pdu.PresentationContextAccepted
+}
+
+// preferenceListNegotiationPolicy is a NegotiationPolicy that accepts any
+// abstract syntax and picks a transfer syntax via a preference list,
+// rejecting only when none of the offered transfer syntaxes appear in the
+// list at all. It's the basis for the preferred-transfer-syntax default
+// policies below; construct one directly to also customize abstract-syntax
+// acceptance via a wrapping NegotiationPolicy.
+type preferenceListNegotiationPolicy struct {
+	preferred []string
+}
+
+func (p preferenceListNegotiationPolicy) Negotiate(abstractSyntaxUID string, transferSyntaxUIDs []string) (string, pdu.PresentationContextResult) {
+	for _, want := range p.preferred {
+		for _, offered := range transferSyntaxUIDs {
+			if want == offered {
+				return offered, pdu.PresentationContextAccepted
+			}
+		}
+	}
+	return "", pdu.PresentationContextProviderRejectionTransferSyntaxNotSupported
+}
+
+// DefaultNegotiationPolicy returns the NegotiationPolicy this package
+// recommends for a new ServiceProviderParams.NegotiationPolicy: like
+// PreferUncompressedTransferSyntaxPolicy, it prefers Explicit VR Little
+// Endian, then Implicit VR Little Endian, then Explicit VR Big Endian, but
+// unlike a plain TransferSyntaxPolicy it actually rejects the presentation
+// context -- with PresentationContextProviderRejectionTransferSyntaxNotSupported
+// -- when none of those three were offered, rather than silently falling
+// back to whatever the requestor listed first.
+func DefaultNegotiationPolicy() NegotiationPolicy {
+	return preferenceListNegotiationPolicy{preferred: []string{
+		dicomuid.ExplicitVRLittleEndian,
+		dicomuid.ImplicitVRLittleEndian,
+		explicitVRBigEndianTransferSyntaxUID,
+	}}
+}
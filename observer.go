@@ -0,0 +1,55 @@
+package netdicom
+
+import "time"
+
+// PresentationContext describes one presentation context negotiated during
+// an association's A-ASSOCIATE handshake, for
+// Observer.OnAssociationEstablished.
+type PresentationContext struct {
+	ContextID         byte
+	AbstractSyntaxUID string
+	TransferSyntaxUID string
+}
+
+// Observer receives synchronous callbacks for state-machine transitions, PDU
+// wire traffic, and association lifecycle events -- the same funnels
+// dicomTelemetry (see telemetry.go) uses to drive OpenTelemetry metrics, but
+// exposed as a plain interface so operators can export their own
+// histograms/counters (e.g. via a prometheus.Collector) without pulling in
+// OpenTelemetry. Every method must be safe to call concurrently -- a
+// ServiceUser or ServiceProvider may drive several associations' state
+// machines on separate goroutines at once -- and should return quickly,
+// since they run inline on the state machine's goroutine.
+//
+// See ServiceUserParams.Observer / ServiceProviderParams.Observer.
+type Observer interface {
+	// OnStateTransition fires once per DUL state-machine step, after the
+	// transition's action has run: from and to are stateType.Name values
+	// (e.g. "Sta05", "Sta06") and event is the eventType.Description that
+	// triggered it.
+	OnStateTransition(from, to, event string)
+
+	// OnPDUSent fires after a PDU has been written to the wire: pduType is
+	// the PDU's concrete Go type name (e.g. "*netdicom.P_DATA_TF"), bytes
+	// is its encoded wire size, and dur is how long the write took.
+	OnPDUSent(pduType string, bytes int, dur time.Duration)
+
+	// OnPDUReceived fires after a PDU has been read off the wire and
+	// decoded.
+	OnPDUReceived(pduType string, bytes int)
+
+	// OnAssociationEstablished fires once per association, when the
+	// A-ASSOCIATE handshake completes: peerAE is the remote AE title (the
+	// called AE title if this side is the ServiceUser, the calling AE
+	// title if this side is the ServiceProvider) and contexts lists the
+	// presentation contexts negotiated with it.
+	OnAssociationEstablished(peerAE string, contexts []PresentationContext)
+
+	// OnAssociationClosed fires once per established association, when it
+	// is fully torn down. cause is nil for a clean A-RELEASE and non-nil
+	// for an abort (e.g. a transport error or a protocol violation).
+	// Associations that never completed the handshake (e.g. a rejected
+	// A-ASSOCIATE-RQ) don't fire OnAssociationClosed, since they never
+	// fired OnAssociationEstablished either.
+	OnAssociationClosed(cause error)
+}
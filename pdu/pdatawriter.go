@@ -0,0 +1,111 @@
+package pdu
+
+import (
+	"bytes"
+	"io"
+)
+
+// pDataItemHeaderSize is the per-PresentationDataValueItem overhead: 4 bytes
+// item length + 1 byte context ID + 1 byte command/last flags.
+const pDataItemHeaderSize = 6
+
+// pDUHeaderSize is the 6-byte PDU header (type, reserved, length) that
+// precedes a PDU's payload.
+const pDUHeaderSize = 6
+
+// PDataWriter streams a DIMSE command or data stream out as a sequence of
+// P-DATA-TF PDUs, flushing each PDU to the underlying io.Writer as soon as it
+// fills up to maxPDUSize. Unlike EncodePDU, a caller driving PDataWriter
+// directly never has to materialize the whole P-DATA-TF PDU list -- or even
+// one whole PDU's worth of PresentationDataValueItems -- as a single []byte.
+//
+// This is a standalone, directly-testable encoding primitive; it is not
+// currently wired into ServiceUser/ServiceProvider's own C-STORE send path.
+// That path (CStoreFromReader) still reads its whole io.Reader into one
+// []byte before handing it to the state machine, and the state machine's
+// own P-DATA-TF writer (pdvFragmenter, in statemachine.go) fragments that
+// buffer on the fly rather than using PDataWriter, because sendPDU is only
+// ever called from the state machine's single per-association goroutine --
+// a caller outside it, like CStoreFromReader, cannot safely write to the
+// connection through PDataWriter without racing that goroutine. Likewise
+// there is no PDataReader yet; ReadPDU and dimse.CommandAssembler decode and
+// reassemble P-DATA-TF via fully materialized P_DATA_TF.Items slices. Both
+// gaps are tracked, not silently dropped.
+type PDataWriter struct {
+	out        io.Writer
+	contextID  byte
+	command    bool
+	maxPDUSize int
+
+	buf bytes.Buffer // bytes accumulated for the PDV currently being filled
+	err error
+}
+
+// NewPDataWriter creates a PDataWriter that writes PresentationDataValueItems
+// for contextID to out, each fragmented into P-DATA-TF PDUs no larger than
+// maxPDUSize bytes. Call SetCommand(false) before writing the data stream
+// (it defaults to the command stream), and call Close once the stream is
+// complete so the final fragment can be marked Last.
+func NewPDataWriter(out io.Writer, contextID byte, maxPDUSize int) *PDataWriter {
+	return &PDataWriter{out: out, contextID: contextID, command: true, maxPDUSize: maxPDUSize}
+}
+
+// SetCommand switches the stream PDataWriter is currently fragmenting.
+// Switching mid-PDV is not supported; call Close to flush the prior stream's
+// final fragment first.
+func (w *PDataWriter) SetCommand(command bool) {
+	w.command = command
+}
+
+// Write implements io.Writer, buffering p until a full maxPDUSize's worth of
+// payload has accumulated, at which point it is flushed as one P-DATA-TF PDU.
+func (w *PDataWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n := len(p)
+	capacity := w.maxPDUSize - pDUHeaderSize - pDataItemHeaderSize
+	for len(p) > 0 {
+		room := capacity - w.buf.Len()
+		if room <= 0 {
+			if err := w.flush(false); err != nil {
+				return n - len(p), err
+			}
+			room = capacity
+		}
+		chunk := p
+		if len(chunk) > room {
+			chunk = chunk[:room]
+		}
+		w.buf.Write(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// flush writes the accumulated PDV as a single-item P-DATA-TF PDU. last
+// marks it as the final fragment of the current stream.
+func (w *PDataWriter) flush(last bool) error {
+	item := PresentationDataValueItem{
+		ContextID: w.contextID,
+		Command:   w.command,
+		Last:      last,
+		Value:     w.buf.Bytes(),
+	}
+	if err := WritePDU(w.out, &P_DATA_TF{Items: []PresentationDataValueItem{item}}); err != nil {
+		w.err = err
+		return err
+	}
+	w.buf.Reset()
+	return nil
+}
+
+// Close flushes any remaining buffered bytes as the final (Last=true)
+// fragment of the current stream, even if empty, per PS3.8 9.3.1 (every
+// command/data stream ends with exactly one fragment with Last set).
+func (w *PDataWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.flush(true)
+}
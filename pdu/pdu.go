@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"github.com/yasushi-saito/go-dicom/dicomio"
 	"io"
+	"sync"
 	"v.io/x/lib/vlog"
 )
 
@@ -42,16 +43,33 @@ type SubItem interface {
 
 // Possible Type field values for SubItem.
 const (
-	ItemTypeApplicationContext           = 0x10
-	ItemTypePresentationContextRequest   = 0x20
-	ItemTypePresentationContextResponse  = 0x21
-	ItemTypeAbstractSyntax               = 0x30
-	ItemTypeTransferSyntax               = 0x40
-	ItemTypeUserInformation              = 0x50
-	ItemTypeUserInformationMaximumLength = 0x51
-	ItemTypeImplementationClassUID       = 0x52
-	ItemTypeAsynchronousOperationsWindow = 0x53
-	ItemTypeImplementationVersionName    = 0x55
+	ItemTypeApplicationContext                = 0x10
+	ItemTypePresentationContextRequest        = 0x20
+	ItemTypePresentationContextResponse       = 0x21
+	ItemTypeAbstractSyntax                    = 0x30
+	ItemTypeTransferSyntax                    = 0x40
+	ItemTypeUserInformation                   = 0x50
+	ItemTypeUserInformationMaximumLength      = 0x51
+	ItemTypeImplementationClassUID            = 0x52
+	ItemTypeAsynchronousOperationsWindow      = 0x53
+	ItemTypeRoleSelection                     = 0x54
+	ItemTypeImplementationVersionName         = 0x55
+	ItemTypeSOPClassExtendedNegotiation       = 0x56
+	ItemTypeSOPClassCommonExtendedNegotiation = 0x57
+	ItemTypeUserIdentityRQ                    = 0x58
+	ItemTypeUserIdentityAC                    = 0x59
+	// ItemTypeWireCompression is not part of PS3.8; it's a private-vendor
+	// sub-item (the standard only assigns item types up to 0x59) this
+	// package uses to negotiate optional wire compression of P-DATA-TF
+	// payloads. A peer that doesn't recognize it will reject the
+	// association with "no-reason-given", so only set it when both ends
+	// are known to support it (see ServiceProviderParams.WireCompression /
+	// ServiceUserParams.WireCompression).
+	ItemTypeWireCompression = 0x5a
+	// ItemTypeTraceContext is likewise a private-vendor sub-item, carrying a
+	// W3C traceparent string (see TraceContextSubItem) so a distributed
+	// trace started by the requestor can be continued by the acceptor.
+	ItemTypeTraceContext = 0x5b
 )
 
 func decodeSubItem(d *dicomio.Decoder) SubItem {
@@ -77,11 +95,30 @@ func decodeSubItem(d *dicomio.Decoder) SubItem {
 		return decodeImplementationClassUIDSubItem(d, length)
 	case ItemTypeAsynchronousOperationsWindow:
 		return decodeAsynchronousOperationsWindowSubItem(d, length)
+	case ItemTypeRoleSelection:
+		return decodeRoleSelectionSubItem(d, length)
 	case ItemTypeImplementationVersionName:
 		return decodeImplementationVersionNameSubItem(d, length)
+	case ItemTypeUserIdentityRQ:
+		return decodeUserIdentitySubItem(d, length)
+	case ItemTypeUserIdentityAC:
+		return decodeUserIdentityACSubItem(d, length)
+	case ItemTypeSOPClassExtendedNegotiation:
+		return decodeSOPClassExtendedNegotiationSubItem(d, length)
+	case ItemTypeSOPClassCommonExtendedNegotiation:
+		return decodeSOPClassCommonExtendedNegotiationSubItem(d, length)
+	case ItemTypeWireCompression:
+		return decodeWireCompressionSubItem(d, length)
+	case ItemTypeTraceContext:
+		return decodeTraceContextSubItem(d, length)
 	default:
-		d.SetError(fmt.Errorf("Unknown item type: 0x%x", itemType))
-		return nil
+		// Unrecognized item types are kept around as opaque blobs rather
+		// than rejected outright: private-vendor extensions like
+		// ItemTypeWireCompression must fall back cleanly when talking to a
+		// peer that predates them, instead of failing the whole
+		// A-ASSOCIATE-RQ/AC.
+		vlog.VI(1).Infof("Ignoring unrecognized item type: 0x%x", itemType)
+		return decodeSubItemUnsupported(d, itemType, length)
 	}
 }
 
@@ -190,6 +227,268 @@ func (v *AsynchronousOperationsWindowSubItem) String() string {
 		v.MaxOpsInvoked, v.MaxOpsPerformed)
 }
 
+// SCU/SCP role values for RoleSelectionSubItem.{SCURole,SCPRole}.
+const (
+	RoleNotSupported byte = 0
+	RoleSupported    byte = 1
+)
+
+// PS3.7 Annex D.3.3.4.1. Negotiated per abstract syntax, so that the
+// association requestor can ask to act as SCP (e.g. for C-GET's C-STORE
+// sub-operations) and have the acceptor confirm which roles it grants.
+type RoleSelectionSubItem struct {
+	SOPClassUID string
+	SCURole     byte // 0: not supported, 1: supported
+	SCPRole     byte // 0: not supported, 1: supported
+}
+
+func decodeRoleSelectionSubItem(d *dicomio.Decoder, length uint16) *RoleSelectionSubItem {
+	v := &RoleSelectionSubItem{}
+	d.PushLimit(int64(length))
+	defer d.PopLimit()
+	nameLength := d.ReadUInt16()
+	v.SOPClassUID = d.ReadString(int(nameLength))
+	v.SCURole = d.ReadByte()
+	v.SCPRole = d.ReadByte()
+	return v
+}
+
+func (v *RoleSelectionSubItem) Write(e *dicomio.Encoder) {
+	encodeSubItemHeader(e, ItemTypeRoleSelection, uint16(2+len(v.SOPClassUID)+2))
+	e.WriteUInt16(uint16(len(v.SOPClassUID)))
+	e.WriteString(v.SOPClassUID)
+	e.WriteByte(v.SCURole)
+	e.WriteByte(v.SCPRole)
+}
+
+func (v *RoleSelectionSubItem) String() string {
+	return fmt.Sprintf("roleselection{sopclass: \"%s\" scu: %d scp: %d}",
+		v.SOPClassUID, v.SCURole, v.SCPRole)
+}
+
+// Possible values for UserIdentitySubItem.Type. PS3.7 Annex D.3.3.7.1, Table D.3-11.
+const (
+	UserIdentityUsername              byte = 1
+	UserIdentityUsernamePasscode      byte = 2
+	UserIdentityKerberosServiceTicket byte = 3
+	UserIdentitySAMLAssertion         byte = 4
+	UserIdentityJWT                   byte = 5
+)
+
+// PS3.7 Annex D.3.3.7.1. Sent by the requestor to authenticate the
+// association, either as a bare username, username+passcode, or an opaque
+// token (Kerberos/SAML/JWT) carried in PrimaryField. Wire item type
+// ItemTypeUserIdentityRQ (0x58); the acceptor's response, if
+// PositiveResponseRequested, is UserIdentityACSubItem (item type
+// ItemTypeUserIdentityAC, 0x59).
+type UserIdentitySubItem struct {
+	Type                      byte // One of UserIdentity* above.
+	PositiveResponseRequested bool
+	PrimaryField              []byte
+	SecondaryField            []byte // Only used when Type==UserIdentityUsernamePasscode.
+}
+
+func decodeUserIdentitySubItem(d *dicomio.Decoder, length uint16) *UserIdentitySubItem {
+	v := &UserIdentitySubItem{}
+	d.PushLimit(int64(length))
+	defer d.PopLimit()
+	v.Type = d.ReadByte()
+	v.PositiveResponseRequested = d.ReadByte() != 0
+	primaryLength := d.ReadUInt16()
+	v.PrimaryField = d.ReadBytes(int(primaryLength))
+	secondaryLength := d.ReadUInt16()
+	if secondaryLength > 0 {
+		v.SecondaryField = d.ReadBytes(int(secondaryLength))
+	}
+	return v
+}
+
+func (v *UserIdentitySubItem) Write(e *dicomio.Encoder) {
+	length := 1 + 1 + 2 + len(v.PrimaryField) + 2 + len(v.SecondaryField)
+	encodeSubItemHeader(e, ItemTypeUserIdentityRQ, uint16(length))
+	e.WriteByte(v.Type)
+	if v.PositiveResponseRequested {
+		e.WriteByte(1)
+	} else {
+		e.WriteByte(0)
+	}
+	e.WriteUInt16(uint16(len(v.PrimaryField)))
+	e.WriteBytes(v.PrimaryField)
+	e.WriteUInt16(uint16(len(v.SecondaryField)))
+	e.WriteBytes(v.SecondaryField)
+}
+
+func (v *UserIdentitySubItem) String() string {
+	return fmt.Sprintf("useridentity{type: %d positiveresponserequested: %v primary: %d bytes secondary: %d bytes}",
+		v.Type, v.PositiveResponseRequested, len(v.PrimaryField), len(v.SecondaryField))
+}
+
+// PS3.7 Annex D.3.3.7.2. Sent by the acceptor in response to a
+// UserIdentitySubItem whose PositiveResponseRequested was true.
+type UserIdentityACSubItem struct {
+	ServerResponse []byte
+}
+
+func decodeUserIdentityACSubItem(d *dicomio.Decoder, length uint16) *UserIdentityACSubItem {
+	v := &UserIdentityACSubItem{}
+	d.PushLimit(int64(length))
+	defer d.PopLimit()
+	responseLength := d.ReadUInt16()
+	v.ServerResponse = d.ReadBytes(int(responseLength))
+	return v
+}
+
+func (v *UserIdentityACSubItem) Write(e *dicomio.Encoder) {
+	encodeSubItemHeader(e, ItemTypeUserIdentityAC, uint16(2+len(v.ServerResponse)))
+	e.WriteUInt16(uint16(len(v.ServerResponse)))
+	e.WriteBytes(v.ServerResponse)
+}
+
+func (v *UserIdentityACSubItem) String() string {
+	return fmt.Sprintf("useridentityac{serverresponse: %d bytes}", len(v.ServerResponse))
+}
+
+// WireCompressionSubItem is a private-vendor sub-item (see
+// ItemTypeWireCompression) that advertises, or -- when sent by the acceptor
+// in the A-ASSOCIATE-AC -- confirms, wire compressors for P-DATA-TF
+// payloads. Names lists compressor names such as "gzip" in preference
+// order; the acceptor's response carries exactly one name, the compressor
+// it picked, or is omitted entirely to mean "uncompressed".
+type WireCompressionSubItem struct {
+	Names []string
+}
+
+func decodeWireCompressionSubItem(d *dicomio.Decoder, length uint16) *WireCompressionSubItem {
+	v := &WireCompressionSubItem{}
+	d.PushLimit(int64(length))
+	defer d.PopLimit()
+	for d.Len() > 0 {
+		nameLength := d.ReadUInt16()
+		v.Names = append(v.Names, d.ReadString(int(nameLength)))
+	}
+	return v
+}
+
+func (v *WireCompressionSubItem) Write(e *dicomio.Encoder) {
+	length := 0
+	for _, name := range v.Names {
+		length += 2 + len(name)
+	}
+	encodeSubItemHeader(e, ItemTypeWireCompression, uint16(length))
+	for _, name := range v.Names {
+		e.WriteUInt16(uint16(len(name)))
+		e.WriteString(name)
+	}
+}
+
+func (v *WireCompressionSubItem) String() string {
+	return fmt.Sprintf("wirecompression{names: %v}", v.Names)
+}
+
+// TraceContextSubItem is a private-vendor sub-item (see ItemTypeTraceContext)
+// that lets a requestor propagate its distributed-tracing span context to
+// the acceptor, so both ends of the association report into the same
+// trace. TraceParent is the W3C Trace Context "traceparent" header value
+// (https://www.w3.org/TR/trace-context/#traceparent-header) -- the same
+// format used for HTTP propagation, reused here rather than inventing a
+// DICOM-specific encoding.
+type TraceContextSubItem struct {
+	TraceParent string
+}
+
+func decodeTraceContextSubItem(d *dicomio.Decoder, length uint16) *TraceContextSubItem {
+	return &TraceContextSubItem{TraceParent: decodeSubItemWithName(d, length)}
+}
+
+func (v *TraceContextSubItem) Write(e *dicomio.Encoder) {
+	encodeSubItemWithName(e, ItemTypeTraceContext, v.TraceParent)
+}
+
+func (v *TraceContextSubItem) String() string {
+	return fmt.Sprintf("tracecontext{traceparent: %v}", v.TraceParent)
+}
+
+// PS3.7 Annex D.3.3.5.1. Lets a requestor advertise service-class-specific
+// capabilities for a SOP class (e.g. the Q/R relational-query bit, or the
+// Storage SCP level of support byte). ApplicationInformation is an opaque
+// byte string whose layout is defined by the service class in question.
+type SOPClassExtendedNegotiationSubItem struct {
+	SOPClassUID            string
+	ApplicationInformation []byte
+}
+
+func decodeSOPClassExtendedNegotiationSubItem(d *dicomio.Decoder, length uint16) *SOPClassExtendedNegotiationSubItem {
+	v := &SOPClassExtendedNegotiationSubItem{}
+	d.PushLimit(int64(length))
+	defer d.PopLimit()
+	uidLength := d.ReadUInt16()
+	v.SOPClassUID = d.ReadString(int(uidLength))
+	v.ApplicationInformation = d.ReadBytes(int(d.Len()))
+	return v
+}
+
+func (v *SOPClassExtendedNegotiationSubItem) Write(e *dicomio.Encoder) {
+	length := 2 + len(v.SOPClassUID) + len(v.ApplicationInformation)
+	encodeSubItemHeader(e, ItemTypeSOPClassExtendedNegotiation, uint16(length))
+	e.WriteUInt16(uint16(len(v.SOPClassUID)))
+	e.WriteString(v.SOPClassUID)
+	e.WriteBytes(v.ApplicationInformation)
+}
+
+func (v *SOPClassExtendedNegotiationSubItem) String() string {
+	return fmt.Sprintf("sopclassextendednegotiation{sopclass: \"%s\" info: %d bytes}",
+		v.SOPClassUID, len(v.ApplicationInformation))
+}
+
+// PS3.7 Annex D.3.3.6.1. Advertises the SOP classes related to SOPClassUID
+// (e.g. via the General SOP Class relationship) so the acceptor can apply a
+// common set of extended-negotiation semantics across the family.
+type SOPClassCommonExtendedNegotiationSubItem struct {
+	SOPClassUID                string
+	ServiceClassUID            string
+	RelatedGeneralSOPClassUIDs []string
+}
+
+func decodeSOPClassCommonExtendedNegotiationSubItem(d *dicomio.Decoder, length uint16) *SOPClassCommonExtendedNegotiationSubItem {
+	v := &SOPClassCommonExtendedNegotiationSubItem{}
+	d.PushLimit(int64(length))
+	defer d.PopLimit()
+	sopClassLength := d.ReadUInt16()
+	v.SOPClassUID = d.ReadString(int(sopClassLength))
+	serviceClassLength := d.ReadUInt16()
+	v.ServiceClassUID = d.ReadString(int(serviceClassLength))
+	relatedLength := d.ReadUInt16()
+	d.PushLimit(int64(relatedLength))
+	for d.Len() > 0 {
+		uidLength := d.ReadUInt16()
+		v.RelatedGeneralSOPClassUIDs = append(v.RelatedGeneralSOPClassUIDs, d.ReadString(int(uidLength)))
+	}
+	d.PopLimit()
+	return v
+}
+
+func (v *SOPClassCommonExtendedNegotiationSubItem) Write(e *dicomio.Encoder) {
+	relatedEncoder := dicomio.NewBytesEncoder(binary.BigEndian, dicomio.UnknownVR)
+	for _, uid := range v.RelatedGeneralSOPClassUIDs {
+		relatedEncoder.WriteUInt16(uint16(len(uid)))
+		relatedEncoder.WriteString(uid)
+	}
+	relatedBytes := relatedEncoder.Bytes()
+	length := 2 + len(v.SOPClassUID) + 2 + len(v.ServiceClassUID) + 2 + len(relatedBytes)
+	encodeSubItemHeader(e, ItemTypeSOPClassCommonExtendedNegotiation, uint16(length))
+	e.WriteUInt16(uint16(len(v.SOPClassUID)))
+	e.WriteString(v.SOPClassUID)
+	e.WriteUInt16(uint16(len(v.ServiceClassUID)))
+	e.WriteString(v.ServiceClassUID)
+	e.WriteUInt16(uint16(len(relatedBytes)))
+	e.WriteBytes(relatedBytes)
+}
+
+func (v *SOPClassCommonExtendedNegotiationSubItem) String() string {
+	return fmt.Sprintf("sopclasscommonextendednegotiation{sopclass: \"%s\" serviceclass: \"%s\" related: %v}",
+		v.SOPClassUID, v.ServiceClassUID, v.RelatedGeneralSOPClassUIDs)
+}
+
 // PS3.7 Annex D.3.3.2.3
 type ImplementationVersionNameSubItem subItemWithName
 
@@ -432,22 +731,35 @@ func (v *PresentationDataValueItem) String() string {
 	return fmt.Sprintf("presentationdatavalue{context: %d, cmd:%v last:%v value: %d bytes}", v.ContextID, v.Command, v.Last, len(v.Value))
 }
 
-func EncodePDU(pdu PDU) ([]byte, error) {
-	var pduType PDUType
+// pduTypeOf returns the wire PDUType for pdu, or an error if pdu is not one
+// of the types implemented in this file.
+func pduTypeOf(pdu PDU) (PDUType, error) {
 	switch n := pdu.(type) {
 	case *A_ASSOCIATE:
-		pduType = n.Type
+		return n.Type, nil
 	case *A_ASSOCIATE_RJ:
-		pduType = PDUTypeA_ASSOCIATE_RJ
+		return PDUTypeA_ASSOCIATE_RJ, nil
 	case *P_DATA_TF:
-		pduType = PDUTypeP_DATA_TF
+		return PDUTypeP_DATA_TF, nil
 	case *A_RELEASE_RQ:
-		pduType = PDUTypeA_RELEASE_RQ
+		return PDUTypeA_RELEASE_RQ, nil
 	case *A_RELEASE_RP:
-		pduType = PDUTypeA_RELEASE_RP
+		return PDUTypeA_RELEASE_RP, nil
 	case *A_ABORT:
-		pduType = PDUTypeA_ABORT
+		return PDUTypeA_ABORT, nil
 	default:
+		return 0, fmt.Errorf("pdu: unknown PDU type %T", pdu)
+	}
+}
+
+// headerBufPool pools the 6-byte PDU headers written by WritePDU, so hot
+// paths (e.g. PDataWriter, which emits one header per fragment of a large
+// dataset) don't allocate one per call.
+var headerBufPool = sync.Pool{New: func() interface{} { return new([6]byte) }}
+
+func EncodePDU(pdu PDU) ([]byte, error) {
+	pduType, err := pduTypeOf(pdu)
+	if err != nil {
 		vlog.Fatalf("Unknown PDU %v", pdu)
 	}
 	e := dicomio.NewBytesEncoder(binary.BigEndian, dicomio.UnknownVR)
@@ -464,6 +776,36 @@ func EncodePDU(pdu PDU) ([]byte, error) {
 	return append(header[:], payload...), nil
 }
 
+// WritePDU encodes pdu and writes it directly to w as two separate writes
+// (header, then payload) instead of materializing the concatenation of the
+// two as EncodePDU does. Prefer this over EncodePDU in hot paths -- such as
+// PDataWriter, which emits one PDU per maxPDUSize fragment of a large
+// dataset -- where the caller is going to write the encoded bytes to an
+// io.Writer anyway and doesn't need them back as a []byte.
+func WritePDU(w io.Writer, pdu PDU) error {
+	pduType, err := pduTypeOf(pdu)
+	if err != nil {
+		return err
+	}
+	e := dicomio.NewBytesEncoder(binary.BigEndian, dicomio.UnknownVR)
+	pdu.WritePayload(e)
+	if err := e.Error(); err != nil {
+		return err
+	}
+	payload := e.Bytes()
+
+	header := headerBufPool.Get().(*[6]byte)
+	defer headerBufPool.Put(header)
+	header[0] = byte(pduType)
+	header[1] = 0 // Reserved.
+	binary.BigEndian.PutUint32(header[2:6], uint32(len(payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err = w.Write(payload)
+	return err
+}
+
 func ReadPDU(in io.Reader, maxPDUSize int) (PDU, error) {
 	var pduType PDUType
 	var skip byte
@@ -0,0 +1,114 @@
+package netdicom
+
+import "github.com/yasushi-saito/go-netdicom/pdu"
+
+// Role is a friendlier spelling of pdu.RoleSelectionSubItem's SCURole/SCPRole
+// byte pair (PS3.7 D.3.3.4), for ServiceUserParams.RoleSelection and
+// ServiceProviderParams.RoleSelection. A requestor offering RoleSCP or
+// RoleBoth for a SOP class is the PS3.7 D.3.3.4.1 mechanism a C-GET SCU uses
+// to also act as the C-STORE SCP for that C-GET's sub-operations.
+type Role int
+
+const (
+	// RoleSCU is the default if a SOP class has no entry in a RoleSelection
+	// map: this association endpoint only acts as SCU for it.
+	RoleSCU Role = iota
+	// RoleSCP requests/grants only the SCP role for a SOP class.
+	RoleSCP
+	// RoleBoth requests/grants both the SCU and SCP roles for a SOP class.
+	RoleBoth
+)
+
+func (r Role) scuSupported() byte {
+	if r == RoleSCU || r == RoleBoth {
+		return pdu.RoleSupported
+	}
+	return pdu.RoleNotSupported
+}
+
+func (r Role) scpSupported() byte {
+	if r == RoleSCP || r == RoleBoth {
+		return pdu.RoleSupported
+	}
+	return pdu.RoleNotSupported
+}
+
+// subItem renders r as the RoleSelectionSubItem this package's association
+// handshake code exchanges; sopClassUID fills in SOPClassUID, which isn't
+// part of Role itself since the same Role value is reused across the several
+// SOP class UIDs a RoleSelection map typically covers.
+func (r Role) subItem(sopClassUID string) pdu.RoleSelectionSubItem {
+	return pdu.RoleSelectionSubItem{
+		SOPClassUID: sopClassUID,
+		SCURole:     r.scuSupported(),
+		SCPRole:     r.scpSupported(),
+	}
+}
+
+// roleFromSubItem is subItem's inverse, used to turn a decoded
+// RoleSelectionSubItem (see contextManager.peerRoles) back into a Role.
+func roleFromSubItem(item pdu.RoleSelectionSubItem) Role {
+	switch {
+	case item.SCURole == pdu.RoleSupported && item.SCPRole == pdu.RoleSupported:
+		return RoleBoth
+	case item.SCPRole == pdu.RoleSupported:
+		return RoleSCP
+	default:
+		return RoleSCU
+	}
+}
+
+// grantedRole intersects requested (what the peer asked for in its
+// RoleSelectionSubItem) with offered (the role ServiceProviderParams.
+// RoleSelection is willing to grant for that SOP class UID), since PS3.7
+// D.3.3.4.1 only lets the acceptor grant a role the requestor actually
+// asked for, never more. When no role is both requested and offered, it
+// returns RoleSCU, the default role, even if the requestor asked only for
+// SCP.
+func grantedRole(requested, offered Role) Role {
+	scu := requested.scuSupported() == pdu.RoleSupported && offered.scuSupported() == pdu.RoleSupported
+	scp := requested.scpSupported() == pdu.RoleSupported && offered.scpSupported() == pdu.RoleSupported
+	switch {
+	case scu && scp:
+		return RoleBoth
+	case scp:
+		return RoleSCP
+	default:
+		return RoleSCU
+	}
+}
+
+// roleSelectionSubItems converts a ServiceUserParams.RoleSelection /
+// ServiceProviderParams.RoleSelection map into the
+// map[string]pdu.RoleSelectionSubItem contextManager.generateAssociateRequest
+// expects, filling in each entry's SOPClassUID from its map key.
+func roleSelectionSubItems(roles map[string]Role) map[string]pdu.RoleSelectionSubItem {
+	if len(roles) == 0 {
+		return nil
+	}
+	items := make(map[string]pdu.RoleSelectionSubItem, len(roles))
+	for sopClassUID, role := range roles {
+		items[sopClassUID] = role.subItem(sopClassUID)
+	}
+	return items
+}
+
+// extendedNegotiationSubItems converts a ServiceUserParams.
+// ExtendedNegotiation map into the
+// map[string]pdu.SOPClassExtendedNegotiationSubItem
+// contextManager.generateAssociateRequest expects. payload is the opaque,
+// service-class-specific ApplicationInformation bytes -- e.g.
+// sopclass.QRExtendedNegotiation's output for a Q/R Get/Find/Move SOP class.
+func extendedNegotiationSubItems(payloads map[string][]byte) map[string]pdu.SOPClassExtendedNegotiationSubItem {
+	if len(payloads) == 0 {
+		return nil
+	}
+	items := make(map[string]pdu.SOPClassExtendedNegotiationSubItem, len(payloads))
+	for sopClassUID, payload := range payloads {
+		items[sopClassUID] = pdu.SOPClassExtendedNegotiationSubItem{
+			SOPClassUID:            sopClassUID,
+			ApplicationInformation: payload,
+		}
+	}
+	return items
+}
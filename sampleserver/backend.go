@@ -0,0 +1,220 @@
+package main
+
+// This file defines the pluggable storage backend for the sample PACS
+// server: where C-STORE payloads are persisted, and how C-FIND/C-MOVE/C-GET
+// look them up. Selected at startup with the -backend flag.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/yasushi-saito/go-dicom"
+	"github.com/yasushi-saito/go-dicom/dicomio"
+	"v.io/x/lib/vlog"
+)
+
+// filterMatch describes one stored dataset that matched a C-FIND/C-MOVE
+// filter.
+type filterMatch struct {
+	location string           // Backend-specific key; see StorageBackend.
+	ds       *dicom.DataSet   // Contents of the dataset at "location".
+	elems    []*dicom.Element // Elements that matched the filter
+}
+
+// StorageBackend abstracts where the sample PACS server persists datasets
+// received via C-STORE and how it looks them up for C-FIND/C-MOVE/C-GET, so
+// the server isn't hard-wired to local-filesystem storage.
+type StorageBackend interface {
+	// Put persists "data" -- the C-STORE payload, encoded in
+	// transferSyntaxUID -- and returns a backend-specific location string
+	// (e.g. a file path or object key) that can later be passed to Get.
+	Put(transferSyntaxUID, sopClassUID, sopInstanceUID string, data []byte) (location string, err error)
+
+	// Get loads the full dataset (including PixelData) previously
+	// stored at location.
+	Get(location string) (*dicom.DataSet, error)
+
+	// Query returns every stored dataset matching all of "filters", per
+	// dicom.Query semantics. See sampleserver.go's onCFind/onCMove.
+	Query(filters []*dicom.Element) ([]filterMatch, error)
+
+	// List returns the location of every dataset currently stored.
+	List() ([]string, error)
+}
+
+// encodeDataset re-wraps a C-STORE payload with a standard DICOM file
+// header, exactly as the data would appear on disk. All backends use this
+// so Get() and the in-memory indices agree with what was actually stored.
+func encodeDataset(transferSyntaxUID, sopClassUID, sopInstanceUID string, data []byte) ([]byte, error) {
+	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
+	dicom.WriteFileHeader(e,
+		[]*dicom.Element{
+			dicom.MustNewElement(dicom.TagTransferSyntaxUID, transferSyntaxUID),
+			dicom.MustNewElement(dicom.TagMediaStorageSOPClassUID, sopClassUID),
+			dicom.MustNewElement(dicom.TagMediaStorageSOPInstanceUID, sopInstanceUID),
+		})
+	e.WriteBytes(data)
+	if err := e.Error(); err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+// queryDatasets implements StorageBackend.Query against an in-memory index
+// shared by localFSBackend and memoryBackend.
+func queryDatasets(datasets map[string]*dicom.DataSet, filters []*dicom.Element) ([]filterMatch, error) {
+	var matches []filterMatch
+	for location, ds := range datasets {
+		allMatched := true
+		match := filterMatch{location: location, ds: ds}
+		for _, filter := range filters {
+			ok, elem, err := dicom.Query(ds, filter)
+			if err != nil {
+				return matches, err
+			}
+			if !ok {
+				vlog.VI(2).Infof("DS: %s: filter %v missed", location, filter)
+				allMatched = false
+				break
+			}
+			if elem != nil {
+				match.elems = append(match.elems, elem)
+			} else {
+				elem, err := dicom.NewElement(filter.Tag)
+				if err != nil {
+					vlog.Error(err)
+					return matches, err
+				}
+				match.elems = append(match.elems, elem)
+			}
+		}
+		if allMatched {
+			if len(match.elems) == 0 {
+				panic(match)
+			}
+			matches = append(matches, match)
+		}
+	}
+	return matches, nil
+}
+
+// localFSBackend stores each dataset as a DICOM file under "writeDir",
+// indexing parsed attributes (PixelData dropped) of the files found under
+// "readDir" (typically an ancestor of writeDir) in memory for Query/List.
+// This is the server's original storage behavior.
+type localFSBackend struct {
+	writeDir string
+
+	mu       sync.Mutex
+	datasets map[string]*dicom.DataSet // guarded by mu; keyed by file path
+}
+
+// newLocalFSBackend creates a localFSBackend that writes new files under
+// "writeDir", preloading the index with the DICOM files already found
+// under "readDir" (see listDicomFiles).
+func newLocalFSBackend(readDir, writeDir string) (*localFSBackend, error) {
+	datasets, err := listDicomFiles(readDir)
+	if err != nil {
+		return nil, err
+	}
+	return &localFSBackend{writeDir: writeDir, datasets: datasets}, nil
+}
+
+var pathSeq int32
+
+func (b *localFSBackend) Put(transferSyntaxUID, sopClassUID, sopInstanceUID string, data []byte) (string, error) {
+	bytes, err := encodeDataset(transferSyntaxUID, sopClassUID, sopInstanceUID, data)
+	if err != nil {
+		return "", err
+	}
+	location := filepath.Join(b.writeDir, fmt.Sprintf("image%04d.dcm", atomic.AddInt32(&pathSeq, 1)))
+	if err := ioutil.WriteFile(location, bytes, 0644); err != nil {
+		return "", err
+	}
+	ds, err := dicom.ReadDataSetFromFile(location, dicom.ReadOptions{DropPixelData: true})
+	if err != nil {
+		vlog.Errorf("%s: failed to parse dicom file: %v", location, err)
+		return location, nil
+	}
+	b.mu.Lock()
+	b.datasets[location] = ds
+	b.mu.Unlock()
+	return location, nil
+}
+
+func (b *localFSBackend) Get(location string) (*dicom.DataSet, error) {
+	return dicom.ReadDataSetFromFile(location, dicom.ReadOptions{})
+}
+
+func (b *localFSBackend) Query(filters []*dicom.Element) ([]filterMatch, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return queryDatasets(b.datasets, filters)
+}
+
+func (b *localFSBackend) List() ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	locations := make([]string, 0, len(b.datasets))
+	for location := range b.datasets {
+		locations = append(locations, location)
+	}
+	return locations, nil
+}
+
+// memoryBackend stores datasets entirely in memory, keyed by SOP instance
+// UID. Nothing touches disk, so it's useful for tests and ephemeral
+// deployments.
+type memoryBackend struct {
+	mu       sync.Mutex
+	datasets map[string]*dicom.DataSet // guarded by mu; keyed by SOP instance UID
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{datasets: make(map[string]*dicom.DataSet)}
+}
+
+func (b *memoryBackend) Put(transferSyntaxUID, sopClassUID, sopInstanceUID string, data []byte) (string, error) {
+	bytes, err := encodeDataset(transferSyntaxUID, sopClassUID, sopInstanceUID, data)
+	if err != nil {
+		return "", err
+	}
+	ds, err := dicom.ReadDataSetInBytes(bytes, dicom.ReadOptions{})
+	if err != nil {
+		return "", err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.datasets[sopInstanceUID] = ds
+	return sopInstanceUID, nil
+}
+
+func (b *memoryBackend) Get(location string) (*dicom.DataSet, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ds, ok := b.datasets[location]
+	if !ok {
+		return nil, fmt.Errorf("memoryBackend: no dataset at %q", location)
+	}
+	return ds, nil
+}
+
+func (b *memoryBackend) Query(filters []*dicom.Element) ([]filterMatch, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return queryDatasets(b.datasets, filters)
+}
+
+func (b *memoryBackend) List() ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	locations := make([]string, 0, len(b.datasets))
+	for location := range b.datasets {
+		locations = append(locations, location)
+	}
+	return locations, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+// s3Backend stores datasets as objects in an S3-compatible bucket. See
+// newS3Backend and the -backend/-s3-bucket/-s3-endpoint flags in
+// sampleserver.go.
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/yasushi-saito/go-dicom"
+	"v.io/x/lib/vlog"
+)
+
+// s3Backend stores each dataset as an object under "prefix" + sopInstanceUID
+// in "bucket", indexing parsed attributes (PixelData dropped) in memory for
+// Query/List, same as localFSBackend does for files.
+type s3Backend struct {
+	client *s3.Client
+	bucket string
+	prefix string
+
+	mu       sync.Mutex
+	datasets map[string]*dicom.DataSet // guarded by mu; keyed by object key
+}
+
+// newS3Backend creates an s3Backend against "bucket" (keys prefixed with
+// "prefix"), using endpoint (empty means the default AWS endpoint -- set
+// this to point at an S3-compatible store such as MinIO). It preloads the
+// index by listing and fetching every existing object under "prefix".
+func newS3Backend(ctx context.Context, bucket, prefix, endpoint string) (*s3Backend, error) {
+	cfg, err := newAWSConfig(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	b := &s3Backend{
+		client:   s3.NewFromConfig(cfg),
+		bucket:   bucket,
+		prefix:   prefix,
+		datasets: make(map[string]*dicom.DataSet),
+	}
+	keys, err := b.listKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		ds, err := b.getDataset(ctx, key)
+		if err != nil {
+			vlog.Errorf("%s: failed to read object: %v", key, err)
+			continue
+		}
+		b.datasets[key] = ds
+	}
+	return b, nil
+}
+
+func (b *s3Backend) listKeys(ctx context.Context) ([]string, error) {
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(b.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.bucket),
+		Prefix: aws.String(b.prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	}
+	return keys, nil
+}
+
+func (b *s3Backend) getDataset(ctx context.Context, key string) (*dicom.DataSet, error) {
+	out, err := b.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	data := &bytes.Buffer{}
+	if _, err := data.ReadFrom(out.Body); err != nil {
+		return nil, err
+	}
+	return dicom.ReadDataSetInBytes(data.Bytes(), dicom.ReadOptions{DropPixelData: true})
+}
+
+func (b *s3Backend) Put(transferSyntaxUID, sopClassUID, sopInstanceUID string, data []byte) (string, error) {
+	encoded, err := encodeDataset(transferSyntaxUID, sopClassUID, sopInstanceUID, data)
+	if err != nil {
+		return "", err
+	}
+	key := b.prefix + sopInstanceUID
+	if _, err := b.client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(encoded),
+	}); err != nil {
+		return "", err
+	}
+	ds, err := dicom.ReadDataSetInBytes(encoded, dicom.ReadOptions{DropPixelData: true})
+	if err != nil {
+		vlog.Errorf("%s: failed to parse dicom object: %v", key, err)
+		return key, nil
+	}
+	b.mu.Lock()
+	b.datasets[key] = ds
+	b.mu.Unlock()
+	return key, nil
+}
+
+func (b *s3Backend) Get(location string) (*dicom.DataSet, error) {
+	out, err := b.client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(location),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	data := &bytes.Buffer{}
+	if _, err := data.ReadFrom(out.Body); err != nil {
+		return nil, err
+	}
+	return dicom.ReadDataSetInBytes(data.Bytes(), dicom.ReadOptions{})
+}
+
+func (b *s3Backend) Query(filters []*dicom.Element) ([]filterMatch, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return queryDatasets(b.datasets, filters)
+}
+
+func (b *s3Backend) List() ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	locations := make([]string, 0, len(b.datasets))
+	for location := range b.datasets {
+		locations = append(locations, location)
+	}
+	return locations, nil
+}
+
+// newAWSConfig loads the default AWS config (credentials from the
+// environment/shared config file, as usual), overriding the endpoint when
+// one is given so this can target an S3-compatible store instead of AWS.
+func newAWSConfig(ctx context.Context, endpoint string) (aws.Config, error) {
+	if endpoint == "" {
+		return config.LoadDefaultConfig(ctx)
+	}
+	resolver := aws.EndpointResolverWithOptionsFunc(
+		func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+			return aws.Endpoint{URL: endpoint, HostnameImmutable: true}, nil
+		})
+	return config.LoadDefaultConfig(ctx, config.WithEndpointResolverWithOptions(resolver))
+}
@@ -7,23 +7,19 @@ package main
 // It starts a DICOM server that serves files under <directory>.
 
 import (
-	"encoding/binary"
+	"context"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
-	"sync"
-	"sync/atomic"
 
 	"github.com/yasushi-saito/go-dicom"
-	"github.com/yasushi-saito/go-dicom/dicomio"
 	"github.com/yasushi-saito/go-dicom/dicomuid"
 	"github.com/yasushi-saito/go-netdicom"
 	"github.com/yasushi-saito/go-netdicom/dimse"
+	"go.opentelemetry.io/otel"
 	"v.io/x/lib/vlog"
 )
 
@@ -39,15 +35,20 @@ Files are searched recursivsely under this directory.
 Defaults to '.'.`)
 	outputFlag = flag.String("output", "", `
 The directory to store files received by C-STORE.
-If empty, use <dir>/incoming, where <dir> is the value of the -dir flag.`)
+If empty, use <dir>/incoming, where <dir> is the value of the -dir flag.
+Only used with -backend=localfs.`)
+	backendFlag = flag.String("backend", "localfs", `
+Storage backend to use for files received by C-STORE and served by C-FIND/C-MOVE/C-GET.
+One of: localfs, memory, s3.`)
+	s3BucketFlag   = flag.String("s3-bucket", "", "S3 bucket to use with -backend=s3")
+	s3PrefixFlag   = flag.String("s3-prefix", "", "Key prefix to use with -backend=s3")
+	s3EndpointFlag = flag.String("s3-endpoint", "", `
+S3-compatible endpoint URL to use with -backend=s3.
+If empty, the default AWS endpoint is used.`)
 )
 
-var pathSeq int32
-
 type server struct {
-	// Set of dicom files the server manages. Keys are file paths.
-	mu       *sync.Mutex
-	datasets map[string]*dicom.DataSet // guarded by mu.
+	backend StorageBackend
 }
 
 func (ss *server) onCStore(
@@ -55,85 +56,15 @@ func (ss *server) onCStore(
 	sopClassUID string,
 	sopInstanceUID string,
 	data []byte) dimse.Status {
-	ss.mu.Lock()
-	defer ss.mu.Unlock()
-	path := path.Join(*outputFlag, fmt.Sprintf("image%04d.dcm", atomic.AddInt32(&pathSeq, 1)))
-
-	vlog.Infof("Writing %s", path)
-	e := dicomio.NewBytesEncoder(binary.LittleEndian, dicomio.ExplicitVR)
-	dicom.WriteFileHeader(e,
-		[]*dicom.Element{
-			dicom.MustNewElement(dicom.TagTransferSyntaxUID, transferSyntaxUID),
-			dicom.MustNewElement(dicom.TagMediaStorageSOPClassUID, sopClassUID),
-			dicom.MustNewElement(dicom.TagMediaStorageSOPInstanceUID, sopInstanceUID),
-		})
-	e.WriteBytes(data)
-	if err := e.Error(); err != nil {
-		vlog.Errorf("%s: failed to write: %v", path, err)
-		return dimse.Status{Status: dimse.StatusNotAuthorized}
-	}
-	bytes := e.Bytes()
-	err := ioutil.WriteFile(path, bytes, 0644)
+	location, err := ss.backend.Put(transferSyntaxUID, sopClassUID, sopInstanceUID, data)
 	if err != nil {
-		vlog.Errorf("%s: %s", path, err)
+		vlog.Errorf("%s: failed to store: %v", sopInstanceUID, err)
 		return dimse.Status{Status: dimse.StatusNotAuthorized}
 	}
-
-	// Register the new file in ss.datasets.
-	ds, err := dicom.ReadDataSetFromFile(path, dicom.ReadOptions{DropPixelData: true})
-	if err != nil {
-		vlog.Errorf("%s: failed to parse dicom file: %v", path, err)
-	} else {
-		ss.datasets[path] = ds
-	}
+	vlog.Infof("Stored %s at %s", sopInstanceUID, location)
 	return dimse.Success
 }
 
-type filterMatch struct {
-	path  string           // DICOM path name
-	ds    *dicom.DataSet   // Contents of "path".
-	elems []*dicom.Element // Elements that matched the filter
-}
-
-func (ss *server) findMatchingFiles(filters []*dicom.Element) ([]filterMatch, error) {
-	ss.mu.Lock()
-	defer ss.mu.Unlock()
-
-	var matches []filterMatch
-	for path, ds := range ss.datasets {
-		allMatched := true
-		match := filterMatch{path: path, ds: ds}
-		for _, filter := range filters {
-			ok, elem, err := dicom.Query(ds, filter)
-			if err != nil {
-				return matches, err
-			}
-			if !ok {
-				vlog.VI(2).Infof("DS: %s: filter %v missed", path, filter)
-				allMatched = false
-				break
-			}
-			if elem != nil {
-				match.elems = append(match.elems, elem)
-			} else {
-				elem, err := dicom.NewElement(filter.Tag)
-				if err != nil {
-					vlog.Error(err)
-					return matches, err
-				}
-				match.elems = append(match.elems, elem)
-			}
-		}
-		if allMatched {
-			if len(match.elems) == 0 {
-				panic(match)
-			}
-			matches = append(matches, match)
-		}
-	}
-	return matches, nil
-}
-
 func (ss *server) onCFind(
 	transferSyntaxUID string,
 	sopClassUID string,
@@ -148,13 +79,13 @@ func (ss *server) onCFind(
 
 	// Match the filter against every file. This is just for demonstration
 	go func() {
-		matches, err := ss.findMatchingFiles(filters)
+		matches, err := ss.backend.Query(filters)
 		vlog.Infof("C-FIND: found %d matches, err %v", len(matches), err)
 		if err != nil {
 			ch <- netdicom.CFindResult{Err: err}
 		} else {
 			for _, match := range matches {
-				vlog.VI(1).Infof("C-FIND resp %s: %v", match.path, match.elems)
+				vlog.VI(1).Infof("C-FIND resp %s: %v", match.location, match.elems)
 				ch <- netdicom.CFindResult{Elements: match.elems}
 			}
 		}
@@ -175,16 +106,16 @@ func (ss *server) onCMove(
 	}
 	ch := make(chan netdicom.CMoveResult, 128)
 	go func() {
-		matches, err := ss.findMatchingFiles(filters)
+		matches, err := ss.backend.Query(filters)
 		vlog.Infof("C-MOVE: found %d matches, err %v", len(matches), err)
 		if err != nil {
 			ch <- netdicom.CMoveResult{Err: err}
 		} else {
 			for i, match := range matches {
-				vlog.VI(1).Infof("C-MOVE resp %d %s: %v", i, match.path, match.elems)
+				vlog.VI(1).Infof("C-MOVE resp %d %s: %v", i, match.location, match.elems)
 				ch <- netdicom.CMoveResult{
 					Remaining: len(matches) - i - 1,
-					Path:      match.path,
+					Path:      match.location,
 					DataSet:   match.ds,
 				}
 			}
@@ -267,30 +198,52 @@ func canonicalizeHostPort(addr string) string {
 	return addr
 }
 
+// newStorageBackend constructs the StorageBackend named by -backend.
+func newStorageBackend() (StorageBackend, error) {
+	switch *backendFlag {
+	case "localfs":
+		if *outputFlag == "" {
+			*outputFlag = filepath.Join(*dirFlag, "incoming")
+		}
+		return newLocalFSBackend(*dirFlag, *outputFlag)
+	case "memory":
+		return newMemoryBackend(), nil
+	case "s3":
+		if *s3BucketFlag == "" {
+			return nil, fmt.Errorf("-s3-bucket is required with -backend=s3")
+		}
+		return newS3Backend(context.Background(), *s3BucketFlag, *s3PrefixFlag, *s3EndpointFlag)
+	default:
+		return nil, fmt.Errorf("unknown -backend %q; want localfs, memory, or s3", *backendFlag)
+	}
+}
+
 func main() {
 	flag.Parse()
 	vlog.ConfigureLibraryLoggerFromFlags()
 	port := canonicalizeHostPort(*portFlag)
-	if *outputFlag == "" {
-		*outputFlag = filepath.Join(*dirFlag, "incoming")
-	}
 
 	remoteAEs, err := parseRemoteAEFlag(*remoteAEFlag)
 	if err != nil {
 		vlog.Fatalf("Failed to parse -remote-ae flag: %v", err)
 	}
-	datasets, err := listDicomFiles(*dirFlag)
+	backend, err := newStorageBackend()
 	if err != nil {
-		vlog.Fatalf("%s: Failed to list dicom files: %v", *dirFlag, err)
-	}
-	ss := server{
-		mu:       &sync.Mutex{},
-		datasets: datasets,
+		vlog.Fatalf("Failed to create -backend %q: %v", *backendFlag, err)
 	}
+	ss := server{backend: backend}
 	vlog.Infof("Listening on %s", port)
 	params := netdicom.ServiceProviderParams{
-		AETitle: *aeFlag,
+		AETitle:   *aeFlag,
 		RemoteAEs: remoteAEs,
+		// Picks up whatever global TracerProvider/MeterProvider the process
+		// has configured (e.g. via an OTLP exporter set up in an init hook);
+		// otel's defaults are no-ops, so CEcho/CFind/CMove/CStore tracing and
+		// the dicom.* metrics are opt-in and cost nothing when unconfigured.
+		Instrumentation: netdicom.Instrumentation{
+			TracerProvider: otel.GetTracerProvider(),
+			MeterProvider:  otel.GetMeterProvider(),
+		},
 	}
 	callbacks := netdicom.ServiceProviderCallbacks{
 		CEcho: func() dimse.Status {
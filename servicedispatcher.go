@@ -1,8 +1,11 @@
 package netdicom
 
 import (
+	"context"
+	"crypto/x509"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/yasushi-saito/go-netdicom/dimse"
 	"v.io/x/lib/vlog"
@@ -16,20 +19,81 @@ type serviceCommandState struct {
 
 	// upcallCh streams PROVIDER command+data for the given messageID.
 	upcallCh chan upcallEvent
+
+	// ctx is canceled when the association is torn down (serviceDispatcher.close),
+	// the requestor sends a C-CANCEL-RQ naming this messageID, or (if
+	// configured) requestTimeout elapses. Callbacks should select on
+	// ctx.Done() alongside their own response channel.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// PeerCertificates is the certificate chain the requestor presented
+	// over TLS, if any (see ServiceProviderParams.TLSConfig). Empty for
+	// plaintext associations or one-sided TLS.
+	PeerCertificates []*x509.Certificate
+
+	// telemetry, commandName, and span are set by startSpan (called once
+	// the command's CommandField is known) and consumed by deleteCommand,
+	// which ends the span and records the command's final DIMSE status.
+	telemetry   *dicomTelemetry
+	commandName string
+	span        *dicomSpan
+
+	// logger is cm.logger enriched with this command's calling/called AE
+	// title and messageID, so every log line a handler emits through it
+	// carries that context automatically. findOrCreateCommand seeds it
+	// with the plain cm.logger; startSpan attaches the per-command fields
+	// once the AE titles are known.
+	logger Logger
+
+	// lastStatus is the Status of the most recent DIMSE response sent via
+	// sendMessage, if any; see extractDIMSEStatus.
+	lastStatus    dimse.Status
+	hasLastStatus bool
+}
+
+// startSpan starts an OpenTelemetry span (and bumps the dicom.commands.active
+// gauge) for this command, named commandName (e.g. "dicom.c-store"; see
+// commandFieldName). It must be called at most once per command, as soon as
+// the command's type is known, and pairs with the endCommand call in
+// deleteCommand.
+func (cs *serviceCommandState) startSpan(commandName, callingAE, calledAE string) {
+	cs.commandName = commandName
+	cs.ctx, cs.span = cs.telemetry.startCommand(
+		cs.ctx, commandName, callingAE, calledAE,
+		cs.context.abstractSyntaxUID, cs.context.transferSyntaxUID, cs.messageID)
+	cs.logger = cs.logger.With(
+		"command", commandName,
+		"calling_ae", callingAE,
+		"called_ae", calledAE,
+		"message_id", cs.messageID)
 }
 
 func (cs *serviceCommandState) sendMessage(resp dimse.Message, data []byte) {
+	if status, ok := extractDIMSEStatus(resp); ok {
+		cs.lastStatus = status
+		cs.hasLastStatus = true
+	}
+	if cs.disp.tracer != nil {
+		cs.disp.tracer.OnSend(resp, data)
+	}
 	vlog.VI(1).Infof("Sending PROVIDER message: %v %v", resp, cs.disp)
-	payload := &stateEventDIMSEPayload{
+	// TODO(saito) payload.data should carry resp encoded onto the wire
+	// (command==true), with the dataset, if any, following as a second
+	// stateEventDataPayload (command==false); that encoding step predates
+	// this change and is tracked separately. messageID is threaded through
+	// regardless so replies stay matched to their invocation once several
+	// commands are in flight at once (MaxOpsInvoked/MaxOpsPerformed > 1).
+	payload := &stateEventDataPayload{
 		abstractSyntaxName: cs.context.abstractSyntaxUID,
-		command:            resp,
 		data:               data,
+		messageID:          cs.messageID,
 	}
 	cs.disp.downcallCh <- stateEvent{
-		event:        evt09,
-		pdu:          nil,
-		conn:         nil,
-		dimsePayload: payload,
+		event:       evt09,
+		pdu:         nil,
+		conn:        nil,
+		dataPayload: payload,
 	}
 }
 
@@ -43,29 +107,99 @@ type serviceDispatcher struct {
 	mu             sync.Mutex
 	activeCommands map[uint16]*serviceCommandState // guarded by mu
 	callbacks      map[int]serviceCallback         // guarded by mu
+
+	// maxOpsSem bounds the number of callbacks running concurrently, per the
+	// Asynchronous Operations Window (PS3.7 D.3.3.3) negotiated for this
+	// association. nil means unbounded (the pre-negotiation default of one
+	// operation happens to behave the same way in practice, since callbacks
+	// are launched one per incoming command).
+	//
+	// This throttles how many callbacks run at once; demultiplexing
+	// interleaved P-DATA-TF fragments from concurrent commands is handled
+	// one layer down, by stateMachine.commandAssemblers keying reassembly
+	// state off presentation context ID (see its doc comment for the
+	// remaining limitation: two commands interleaved on the very same
+	// context still aren't distinguishable below the DIMSE layer).
+	maxOpsSem chan struct{}
+
+	// invokeSem is maxOpsSem's mirror image for commands this side invokes
+	// (CStoreContext, CFindContext, etc.), bounding how many of them may be
+	// outstanding at once per the Asynchronous Operations Window's
+	// MaxOpsInvoked. nil means unbounded, same as maxOpsSem. Acquired by
+	// acquireInvokeSlot before a new outgoing command is created and
+	// released by releaseInvokeSlot once it completes.
+	invokeSem chan struct{}
+
+	// requestTimeout, if nonzero, bounds how long a single command may run
+	// before its ctx is canceled. Zero means no per-request deadline.
+	requestTimeout time.Duration
+
+	// peerCertificates is copied into each serviceCommandState's
+	// PeerCertificates field; see ServiceProviderParams.TLSConfig.
+	peerCertificates []*x509.Certificate
+
+	// telemetry is copied into each serviceCommandState created by this
+	// dispatcher; see ServiceProviderParams.Instrumentation and the
+	// ServiceUserParams equivalent. A nil *dicomTelemetry is a no-op.
+	telemetry *dicomTelemetry
+
+	// tracer, if non-nil, is notified of every DIMSE command this
+	// dispatcher sends (sendMessage) or receives (handleEvent); see
+	// ServiceProviderParams.Tracer and the ServiceUserParams equivalent.
+	tracer dimse.Tracer
 }
 
 func (disp *serviceDispatcher) findOrCreateCommand(
 	messageID uint16,
 	cm *contextManager,
-	context contextManagerEntry) (*serviceCommandState, bool) {
+	presentationContext contextManagerEntry) (*serviceCommandState, bool) {
 	disp.mu.Lock()
 	defer disp.mu.Unlock()
 	if cs, ok := disp.activeCommands[messageID]; ok {
 		return cs, true
 	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if disp.requestTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), disp.requestTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	logger := cm.logger
+	if logger == nil {
+		logger = VLogLogger()
+	}
 	cs := &serviceCommandState{
-		disp:      disp,
-		messageID: messageID,
-		cm:        cm,
-		context:   context,
-		upcallCh:  make(chan upcallEvent, 128),
+		disp:             disp,
+		messageID:        messageID,
+		cm:               cm,
+		context:          presentationContext,
+		upcallCh:         make(chan upcallEvent, 128),
+		ctx:              ctx,
+		cancel:           cancel,
+		PeerCertificates: disp.peerCertificates,
+		telemetry:        disp.telemetry,
+		logger:           logger,
 	}
 	disp.activeCommands[messageID] = cs
 	vlog.VI(1).Infof("Start provider command %v", messageID)
 	return cs, false
 }
 
+// cancelCommand cancels the ctx of the active command with the given
+// messageID, if any, as a result of a C-CANCEL-RQ naming it. ok is false if
+// no such command is currently active (e.g. it already completed).
+func (disp *serviceDispatcher) cancelCommand(messageID uint16) bool {
+	disp.mu.Lock()
+	cs, ok := disp.activeCommands[messageID]
+	disp.mu.Unlock()
+	if !ok {
+		return false
+	}
+	cs.cancel()
+	return true
+}
+
 func (disp *serviceDispatcher) deleteCommand(cs *serviceCommandState) {
 	disp.mu.Lock()
 	vlog.VI(1).Infof("Finish provider command %v", cs.messageID)
@@ -74,6 +208,7 @@ func (disp *serviceDispatcher) deleteCommand(cs *serviceCommandState) {
 	}
 	delete(disp.activeCommands, cs.messageID)
 	disp.mu.Unlock()
+	cs.telemetry.endCommand(cs.ctx, cs.commandName, cs.span, cs.lastStatus)
 }
 
 func (disp *serviceDispatcher) registerCallback(commandField int, cb serviceCallback) {
@@ -90,28 +225,37 @@ func (disp *serviceDispatcher) unregisterCallback(commandField int) {
 
 func (disp *serviceDispatcher) handleEvent(event upcallEvent) {
 	if event.eventType == upcallEventHandshakeCompleted {
+		disp.applyNegotiatedMaxOps(event.cm)
 		return
 	}
 	doassert(event.eventType == upcallEventData)
 	doassert(event.command != nil)
+	if disp.tracer != nil {
+		disp.tracer.OnReceive(event.command, event.data)
+	}
 	context, err := event.cm.lookupByContextID(event.contextID)
 	if err != nil {
 		vlog.Infof("Invalid context ID %d: %v", event.contextID, err)
 		disp.downcallCh <- stateEvent{event: evt19, pdu: nil, err: err}
 		return
 	}
-	messageID := event.command.GetMessageID()
-	dc, found := disp.findOrCreateCommand(messageID, event.cm, context)
+	dc, found := disp.findOrCreateCommand(event.messageID, event.cm, context)
 	if found {
 		vlog.VI(1).Infof("Forwarding command to existing command: %+v", event.command, dc)
 		dc.upcallCh <- event
 		vlog.VI(1).Infof("Done forwarding command to existing command: %+v", event.command, dc)
 		return
 	}
+	commandField, _ := dimseCommandField(event.command)
+	dc.startSpan(commandFieldName(commandField), event.cm.callingAETitle, event.cm.calledAETitle)
 	disp.mu.Lock()
-	cb := disp.callbacks[event.command.CommandField()]
+	cb := disp.callbacks[commandField]
 	disp.mu.Unlock()
 	go func() {
+		if disp.maxOpsSem != nil {
+			disp.maxOpsSem <- struct{}{}
+			defer func() { <-disp.maxOpsSem }()
+		}
 		cb(event.command, event.data, dc)
 		disp.deleteCommand(dc)
 	}()
@@ -120,16 +264,87 @@ func (disp *serviceDispatcher) handleEvent(event upcallEvent) {
 func (disp *serviceDispatcher) close() {
 	disp.mu.Lock()
 	for _, cs := range disp.activeCommands {
+		cs.cancel()
 		close(cs.upcallCh)
 	}
 	disp.mu.Unlock()
 	// TODO(saito): prevent new command from launching.
 }
 
-func newServiceDispatcher() *serviceDispatcher {
-	return &serviceDispatcher{
-		downcallCh:     make(chan stateEvent, 128),
-		activeCommands: make(map[uint16]*serviceCommandState),
-		callbacks:      make(map[int]serviceCallback),
+// newServiceDispatcher creates a dispatcher. maxOpsPerformed bounds the
+// number of service callbacks it runs concurrently; zero means unbounded.
+// maxOpsInvoked bounds the number of commands this side may have
+// outstanding as the invoker at once; zero means unbounded. requestTimeout,
+// if nonzero, cancels a command's ctx after that long; zero means commands
+// run until they finish, are canceled by a C-CANCEL-RQ, or the association
+// is torn down. peerCertificates is the TLS peer certificate chain for this
+// association, if any; it is copied into every serviceCommandState created
+// for it.
+func newServiceDispatcher(maxOpsPerformed, maxOpsInvoked uint16, requestTimeout time.Duration, peerCertificates []*x509.Certificate) *serviceDispatcher {
+	disp := &serviceDispatcher{
+		downcallCh:       make(chan stateEvent, 128),
+		activeCommands:   make(map[uint16]*serviceCommandState),
+		callbacks:        make(map[int]serviceCallback),
+		requestTimeout:   requestTimeout,
+		peerCertificates: peerCertificates,
+	}
+	if maxOpsPerformed > 0 {
+		disp.maxOpsSem = make(chan struct{}, maxOpsPerformed)
+	}
+	if maxOpsInvoked > 0 {
+		disp.invokeSem = make(chan struct{}, maxOpsInvoked)
+	}
+	return disp
+}
+
+// applyNegotiatedMaxOps resizes invokeSem to the Asynchronous Operations
+// Window actually negotiated with the peer (cm.lookupMaxOps), overriding
+// whatever maxOpsInvoked this dispatcher was constructed with: a peer that
+// grants a smaller MaxOpsInvoked than what was requested must be honored, not
+// just what this side originally asked for. Called once the handshake
+// completes, before any command that could call acquireInvokeSlot runs.
+// Guarded by mu since acquireInvokeSlot/releaseInvokeSlot read invokeSem
+// from other goroutines.
+func (disp *serviceDispatcher) applyNegotiatedMaxOps(cm *contextManager) {
+	maxOpsInvoked, _ := cm.lookupMaxOps()
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	if maxOpsInvoked == 0 {
+		disp.invokeSem = nil
+		return
+	}
+	disp.invokeSem = make(chan struct{}, maxOpsInvoked)
+}
+
+// acquireInvokeSlot blocks until a slot is free under invokeSem (or returns
+// immediately if invokeSem is nil, i.e. MaxOpsInvoked is unbounded), or
+// until ctx is done. invokeSem itself is read under mu, since
+// applyNegotiatedMaxOps may replace it from another goroutine; the blocking
+// send/receive happens on the snapshotted channel, outside the lock.
+func (disp *serviceDispatcher) acquireInvokeSlot(ctx context.Context) error {
+	disp.mu.Lock()
+	sem := disp.invokeSem
+	disp.mu.Unlock()
+	if sem == nil {
+		return nil
+	}
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseInvokeSlot is acquireInvokeSlot's counterpart, called once an
+// invoked command completes. See acquireInvokeSlot for why invokeSem is
+// snapshotted under mu rather than read directly.
+func (disp *serviceDispatcher) releaseInvokeSlot() {
+	disp.mu.Lock()
+	sem := disp.invokeSem
+	disp.mu.Unlock()
+	if sem == nil {
+		return
 	}
+	<-sem
 }
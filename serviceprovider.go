@@ -3,16 +3,28 @@
 package netdicom
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/yasushi-saito/go-dicom"
 	"github.com/yasushi-saito/go-dicom/dicomio"
 	"github.com/yasushi-saito/go-netdicom/dimse"
+	"github.com/yasushi-saito/go-netdicom/mwl"
 	"github.com/yasushi-saito/go-netdicom/sopclass"
 	"v.io/x/lib/vlog"
 )
 
+// modalityWorklistInformationFindUID is sopclass.WorklistFindClasses'
+// "ModalityWorklistInformationFind" entry, spelled out as a constant so
+// handleCFind can route to ServiceProviderParams.Worklist without looking it
+// up by name in sopclass on every request.
+const modalityWorklistInformationFindUID = "1.2.840.10008.5.1.4.31"
+
 func handleCStore(
 	cb CStoreCallback,
 	c *dimse.C_STORE_RQ, data []byte,
@@ -20,6 +32,7 @@ func handleCStore(
 	status := dimse.Status{Status: dimse.StatusUnrecognizedOperation}
 	if cb != nil {
 		status = cb(
+			cs.ctx,
 			cs.context.transferSyntaxUID,
 			c.AffectedSOPClassUID,
 			c.AffectedSOPInstanceUID,
@@ -39,6 +52,10 @@ func handleCFind(
 	params ServiceProviderParams,
 	c *dimse.C_FIND_RQ, data []byte,
 	cs *serviceCommandState) {
+	if c.AffectedSOPClassUID == modalityWorklistInformationFindUID && params.Worklist != nil {
+		handleWorklistFind(params, c, data, cs)
+		return
+	}
 	if params.CFind == nil {
 		cs.sendMessage(&dimse.C_FIND_RSP{
 			AffectedSOPClassUID:       c.AffectedSOPClassUID,
@@ -58,37 +75,47 @@ func handleCFind(
 		}, nil)
 		return
 	}
-	vlog.VI(1).Infof("C-FIND-RQ payload: %s", elementsString(elems))
+	cs.logger.Debug("C-FIND-RQ payload", "elements", elementsString(elems))
 
 	status := dimse.Status{Status: dimse.StatusSuccess}
 	responseCh := make(chan CFindResult, 128)
 	go func() {
-		params.CFind(cs.context.transferSyntaxUID, c.AffectedSOPClassUID, elems, responseCh)
+		params.CFind(cs.ctx, cs.context.transferSyntaxUID, c.AffectedSOPClassUID, elems, responseCh)
 	}()
-	for resp := range responseCh {
-		if resp.Err != nil {
-			status = dimse.Status{
-				Status:       dimse.CFindUnableToProcess,
-				ErrorComment: resp.Err.Error(),
+loop:
+	for {
+		select {
+		case <-cs.ctx.Done():
+			status = dimse.Status{Status: dimse.StatusCancel, ErrorComment: cs.ctx.Err().Error()}
+			break loop
+		case resp, ok := <-responseCh:
+			if !ok {
+				break loop
 			}
-			break
-		}
-		vlog.VI(1).Infof("C-FIND-RSP: %s", elementsString(resp.Elements))
-		payload, err := writeElementsToBytes(resp.Elements, cs.context.transferSyntaxUID)
-		if err != nil {
-			vlog.Errorf("C-FIND: encode error %v", err)
-			status = dimse.Status{
-				Status:       dimse.CFindUnableToProcess,
-				ErrorComment: err.Error(),
+			if resp.Err != nil {
+				status = dimse.Status{
+					Status:       dimse.CFindUnableToProcess,
+					ErrorComment: resp.Err.Error(),
+				}
+				break loop
 			}
-			break
+			cs.logger.Debug("C-FIND-RSP", "elements", elementsString(resp.Elements))
+			payload, err := writeElementsToBytes(resp.Elements, cs.context.transferSyntaxUID)
+			if err != nil {
+				cs.logger.Error("C-FIND: encode error", "err", err)
+				status = dimse.Status{
+					Status:       dimse.CFindUnableToProcess,
+					ErrorComment: err.Error(),
+				}
+				break loop
+			}
+			cs.sendMessage(&dimse.C_FIND_RSP{
+				AffectedSOPClassUID:       c.AffectedSOPClassUID,
+				MessageIDBeingRespondedTo: c.MessageID,
+				CommandDataSetType:        dimse.CommandDataSetTypeNonNull,
+				Status:                    dimse.Status{Status: dimse.StatusPending},
+			}, payload)
 		}
-		cs.sendMessage(&dimse.C_FIND_RSP{
-			AffectedSOPClassUID:       c.AffectedSOPClassUID,
-			MessageIDBeingRespondedTo: c.MessageID,
-			CommandDataSetType:        dimse.CommandDataSetTypeNonNull,
-			Status:                    dimse.Status{Status: dimse.StatusPending},
-		}, payload)
 	}
 	cs.sendMessage(&dimse.C_FIND_RSP{
 		AffectedSOPClassUID:       c.AffectedSOPClassUID,
@@ -100,6 +127,59 @@ func handleCFind(
 	}
 }
 
+// handleWorklistFind serves a C-FIND on ModalityWorklistInformationFind via
+// params.Worklist, re-applying mwl.Filter to whatever it returns so a
+// WorklistCallback that doesn't bother matching its own results (e.g. one
+// backed by a small in-memory list) still only sends back genuine matches.
+func handleWorklistFind(
+	params ServiceProviderParams,
+	c *dimse.C_FIND_RQ, data []byte,
+	cs *serviceCommandState) {
+	sendFinal := func(status dimse.Status) {
+		cs.sendMessage(&dimse.C_FIND_RSP{
+			AffectedSOPClassUID:       c.AffectedSOPClassUID,
+			MessageIDBeingRespondedTo: c.MessageID,
+			CommandDataSetType:        dimse.CommandDataSetTypeNull,
+			Status:                    status,
+		}, nil)
+	}
+	query, err := readElementsInBytes(data, cs.context.transferSyntaxUID)
+	if err != nil {
+		sendFinal(dimse.Status{Status: dimse.StatusUnrecognizedOperation, ErrorComment: err.Error()})
+		return
+	}
+	cs.logger.Debug("Worklist C-FIND-RQ payload", "elements", elementsString(query))
+
+	items, status := params.Worklist(cs.ctx, query)
+	if status.Status != dimse.StatusSuccess {
+		sendFinal(status)
+		return
+	}
+	matches, err := mwl.Filter(items, query)
+	if err != nil {
+		sendFinal(dimse.Status{Status: dimse.CFindUnableToProcess, ErrorComment: err.Error()})
+		return
+	}
+	for _, item := range matches {
+		if cs.ctx.Err() != nil {
+			sendFinal(dimse.Status{Status: dimse.StatusCancel, ErrorComment: cs.ctx.Err().Error()})
+			return
+		}
+		payload, err := writeElementsToBytes(item.ToDataSet().Elements, cs.context.transferSyntaxUID)
+		if err != nil {
+			sendFinal(dimse.Status{Status: dimse.CFindUnableToProcess, ErrorComment: err.Error()})
+			return
+		}
+		cs.sendMessage(&dimse.C_FIND_RSP{
+			AffectedSOPClassUID:       c.AffectedSOPClassUID,
+			MessageIDBeingRespondedTo: c.MessageID,
+			CommandDataSetType:        dimse.CommandDataSetTypeNonNull,
+			Status:                    dimse.Status{Status: dimse.StatusPending},
+		}, payload)
+	}
+	sendFinal(dimse.Status{Status: dimse.StatusSuccess})
+}
+
 func handleCMove(
 	params ServiceProviderParams,
 	c *dimse.C_MOVE_RQ, data []byte,
@@ -131,15 +211,26 @@ func handleCMove(
 		sendError(err)
 		return
 	}
-	vlog.VI(1).Infof("C-MOVE-RQ payload: %s", elementsString(elems))
+	cs.logger.Debug("C-MOVE-RQ payload", "elements", elementsString(elems))
 	responseCh := make(chan CMoveResult, 128)
 	go func() {
-		params.CMove(cs.context.transferSyntaxUID, c.AffectedSOPClassUID, elems, responseCh)
+		params.CMove(cs.ctx, cs.context.transferSyntaxUID, c.AffectedSOPClassUID, elems, responseCh)
 	}()
-	// responseCh :=
 	status := dimse.Status{Status: dimse.StatusSuccess}
 	var numSuccesses, numFailures uint16
-	for resp := range responseCh {
+loop:
+	for {
+		var resp CMoveResult
+		var ok bool
+		select {
+		case <-cs.ctx.Done():
+			status = dimse.Status{Status: dimse.StatusCancel, ErrorComment: cs.ctx.Err().Error()}
+			break loop
+		case resp, ok = <-responseCh:
+			if !ok {
+				break loop
+			}
+		}
 		if resp.Err != nil {
 			status = dimse.Status{
 				Status:       dimse.CFindUnableToProcess,
@@ -147,10 +238,15 @@ func handleCMove(
 			}
 			break
 		}
-		vlog.Infof("C-MOVE: Sending %v to %v(%s)", resp.Path, c.MoveDestination, remoteHostPort)
-		err := runCStoreOnNewAssociation(params.AETitle, c.MoveDestination, remoteHostPort, resp.DataSet)
+		cs.logger.Info("C-MOVE: sending", "path", resp.Path, "destination", c.MoveDestination, "host_port", remoteHostPort)
+		var err error
+		if params.cstorePool != nil {
+			err = cstoreViaPool(params.cstorePool, params.AETitle, c.MoveDestination, remoteHostPort, params.RemoteTLSConfig, resp.DataSet)
+		} else {
+			err = runCStoreOnNewAssociation(params.AETitle, c.MoveDestination, remoteHostPort, resp.DataSet, params.RemoteTLSConfig)
+		}
 		if err != nil {
-			vlog.Errorf("C-MOVE: C-store of %v to %v(%v) failed: %v", resp.Path, c.MoveDestination, remoteHostPort, err)
+			cs.logger.Error("C-MOVE: C-STORE sub-operation failed", "path", resp.Path, "destination", c.MoveDestination, "host_port", remoteHostPort, "err", err)
 			numFailures++
 		} else {
 			numSuccesses++
@@ -162,7 +258,7 @@ func handleCMove(
 			NumberOfRemainingSuboperations: uint16(resp.Remaining),
 			NumberOfCompletedSuboperations: numSuccesses,
 			NumberOfFailedSuboperations:    numFailures,
-			Status: dimse.Status{Status: dimse.StatusPending},
+			Status:                         dimse.Status{Status: dimse.StatusPending},
 		}, nil)
 	}
 	cs.sendMessage(&dimse.C_MOVE_RSP{
@@ -171,7 +267,7 @@ func handleCMove(
 		CommandDataSetType:             dimse.CommandDataSetTypeNull,
 		NumberOfCompletedSuboperations: numSuccesses,
 		NumberOfFailedSuboperations:    numFailures,
-		Status: status}, nil)
+		Status:                         status}, nil)
 	// Drain the responses in case of errors
 	for _ = range responseCh {
 	}
@@ -202,14 +298,26 @@ func handleCGet(
 		sendError(err)
 		return
 	}
-	vlog.VI(1).Infof("C-GET-RQ payload: %s", elementsString(elems))
+	cs.logger.Debug("C-GET-RQ payload", "elements", elementsString(elems))
 	responseCh := make(chan CMoveResult, 128)
 	go func() {
-		params.CGet(cs.context.transferSyntaxUID, c.AffectedSOPClassUID, elems, responseCh)
+		params.CGet(cs.ctx, cs.context.transferSyntaxUID, c.AffectedSOPClassUID, elems, responseCh)
 	}()
 	status := dimse.Status{Status: dimse.StatusSuccess}
 	var numSuccesses, numFailures uint16
-	for resp := range responseCh {
+getLoop:
+	for {
+		var resp CMoveResult
+		var ok bool
+		select {
+		case <-cs.ctx.Done():
+			status = dimse.Status{Status: dimse.StatusCancel, ErrorComment: cs.ctx.Err().Error()}
+			break getLoop
+		case resp, ok = <-responseCh:
+			if !ok {
+				break getLoop
+			}
+		}
 		if resp.Err != nil {
 			status = dimse.Status{
 				Status:       dimse.CFindUnableToProcess,
@@ -218,18 +326,18 @@ func handleCGet(
 			break
 		}
 		subCs, found := cs.disp.findOrCreateCommand(dimse.NewMessageID(), cs.cm, cs.context /*not used*/)
-		vlog.Infof("C-GET: Sending %v using subcommand wl id:%d", resp.Path, subCs.messageID)
+		cs.logger.Info("C-GET: sending", "path", resp.Path, "sub_message_id", subCs.messageID)
 		if found {
 			panic(subCs)
 		}
 		err := runCStoreOnAssociation(subCs.upcallCh, subCs.disp.downcallCh, subCs.cm, subCs.messageID, resp.DataSet)
-		vlog.Infof("C-GET: Done sending %v using subcommand wl id:%d: %v", resp.Path, subCs.messageID, err)
+		cs.logger.Info("C-GET: done sending", "path", resp.Path, "sub_message_id", subCs.messageID, "err", err)
 		defer cs.disp.deleteCommand(subCs)
 		if err != nil {
-			vlog.Errorf("C-GET: C-store of %v failed: %v", resp.Path, err)
+			cs.logger.Error("C-GET: C-STORE sub-operation failed", "path", resp.Path, "err", err)
 			numFailures++
 		} else {
-			vlog.Infof("C-GET: Sent %v", resp.Path)
+			cs.logger.Info("C-GET: sent", "path", resp.Path)
 			numSuccesses++
 		}
 		cs.sendMessage(&dimse.C_GET_RSP{
@@ -239,7 +347,7 @@ func handleCGet(
 			NumberOfRemainingSuboperations: uint16(resp.Remaining),
 			NumberOfCompletedSuboperations: numSuccesses,
 			NumberOfFailedSuboperations:    numFailures,
-			Status: dimse.Status{Status: dimse.StatusPending},
+			Status:                         dimse.Status{Status: dimse.StatusPending},
 		}, nil)
 	}
 	cs.sendMessage(&dimse.C_GET_RSP{
@@ -248,12 +356,22 @@ func handleCGet(
 		CommandDataSetType:             dimse.CommandDataSetTypeNull,
 		NumberOfCompletedSuboperations: numSuccesses,
 		NumberOfFailedSuboperations:    numFailures,
-		Status: status}, nil)
+		Status:                         status}, nil)
 	// Drain the responses in case of errors
 	for _ = range responseCh {
 	}
 }
 
+// handleCCancel handles a C-CANCEL-RQ (DIMSE command 0x0FFF). Unlike the
+// other handlers, it does not send a response -- PS3.7 9.3.2.3 specifies
+// C-CANCEL has no corresponding -RSP -- it just cancels the ctx of the
+// command being canceled, if it's still active.
+func handleCCancel(c *dimse.C_CANCEL_RQ, cs *serviceCommandState) {
+	if !cs.disp.cancelCommand(c.MessageIDBeingRespondedTo) {
+		cs.logger.Warn("C-CANCEL-RQ: no active command", "message_id", c.MessageIDBeingRespondedTo)
+	}
+}
+
 func handleCEcho(
 	params ServiceProviderParams,
 	c *dimse.C_ECHO_RQ, data []byte,
@@ -262,7 +380,7 @@ func handleCEcho(
 	if params.CEcho != nil {
 		status = params.CEcho()
 	}
-	vlog.Infof("Received E-ECHO: context: %+v, status: %+v", cs.context, status)
+	cs.logger.Info("Received C-ECHO", "context", cs.context, "status", status)
 	resp := &dimse.C_ECHO_RSP{
 		MessageIDBeingRespondedTo: c.MessageID,
 		CommandDataSetType:        dimse.CommandDataSetTypeNull,
@@ -271,6 +389,369 @@ func handleCEcho(
 	cs.sendMessage(resp, nil)
 }
 
+func handleNEventReport(
+	params ServiceProviderParams,
+	c *dimse.N_EVENT_REPORT_RQ, data []byte,
+	cs *serviceCommandState) {
+	sendError := func(err error) {
+		cs.sendMessage(&dimse.N_EVENT_REPORT_RSP{
+			AffectedSOPClassUID:       c.AffectedSOPClassUID,
+			MessageIDBeingRespondedTo: c.MessageID,
+			CommandDataSetType:        dimse.CommandDataSetTypeNull,
+			Status:                    dimse.Status{Status: dimse.StatusUnrecognizedOperation, ErrorComment: err.Error()},
+		}, nil)
+	}
+	if params.NEventReport == nil {
+		sendError(fmt.Errorf("No callback found for N-EVENT-REPORT"))
+		return
+	}
+	elems, err := readElementsInBytes(data, cs.context.transferSyntaxUID)
+	if err != nil {
+		sendError(err)
+		return
+	}
+	cs.logger.Debug("N-EVENT-REPORT-RQ payload", "elements", elementsString(elems))
+	status := params.NEventReport(cs.ctx, cs.context.transferSyntaxUID, c.AffectedSOPClassUID, c.AffectedSOPInstanceUID, c.EventTypeID, elems)
+	cs.sendMessage(&dimse.N_EVENT_REPORT_RSP{
+		AffectedSOPClassUID:       c.AffectedSOPClassUID,
+		MessageIDBeingRespondedTo: c.MessageID,
+		EventTypeID:               c.EventTypeID,
+		AffectedSOPInstanceUID:    c.AffectedSOPInstanceUID,
+		CommandDataSetType:        dimse.CommandDataSetTypeNull,
+		Status:                    status,
+	}, nil)
+}
+
+func handleNGet(
+	params ServiceProviderParams,
+	c *dimse.N_GET_RQ, data []byte,
+	cs *serviceCommandState) {
+	if params.NGet == nil {
+		cs.sendMessage(&dimse.N_GET_RSP{
+			AffectedSOPClassUID:       c.RequestedSOPClassUID,
+			MessageIDBeingRespondedTo: c.MessageID,
+			CommandDataSetType:        dimse.CommandDataSetTypeNull,
+			Status:                    dimse.Status{Status: dimse.StatusUnrecognizedOperation, ErrorComment: "No callback found for N-GET"},
+		}, nil)
+		return
+	}
+	respElems, status := params.NGet(cs.ctx, cs.context.transferSyntaxUID, c.RequestedSOPClassUID, c.RequestedSOPInstanceUID)
+	payload, err := writeElementsToBytes(respElems, cs.context.transferSyntaxUID)
+	if err != nil {
+		cs.sendMessage(&dimse.N_GET_RSP{
+			AffectedSOPClassUID:       c.RequestedSOPClassUID,
+			MessageIDBeingRespondedTo: c.MessageID,
+			CommandDataSetType:        dimse.CommandDataSetTypeNull,
+			Status:                    dimse.Status{Status: dimse.StatusUnrecognizedOperation, ErrorComment: err.Error()},
+		}, nil)
+		return
+	}
+	dataSetType := dimse.CommandDataSetTypeNull
+	if len(respElems) > 0 {
+		dataSetType = dimse.CommandDataSetTypeNonNull
+	}
+	cs.sendMessage(&dimse.N_GET_RSP{
+		AffectedSOPClassUID:       c.RequestedSOPClassUID,
+		MessageIDBeingRespondedTo: c.MessageID,
+		AffectedSOPInstanceUID:    c.RequestedSOPInstanceUID,
+		CommandDataSetType:        dataSetType,
+		Status:                    status,
+	}, payload)
+}
+
+func handleNSet(
+	params ServiceProviderParams,
+	c *dimse.N_SET_RQ, data []byte,
+	cs *serviceCommandState) {
+	sendError := func(err error) {
+		cs.sendMessage(&dimse.N_SET_RSP{
+			AffectedSOPClassUID:       c.RequestedSOPClassUID,
+			MessageIDBeingRespondedTo: c.MessageID,
+			CommandDataSetType:        dimse.CommandDataSetTypeNull,
+			Status:                    dimse.Status{Status: dimse.StatusUnrecognizedOperation, ErrorComment: err.Error()},
+		}, nil)
+	}
+	if params.NSet == nil {
+		sendError(fmt.Errorf("No callback found for N-SET"))
+		return
+	}
+	elems, err := readElementsInBytes(data, cs.context.transferSyntaxUID)
+	if err != nil {
+		sendError(err)
+		return
+	}
+	respElems, status := params.NSet(cs.ctx, cs.context.transferSyntaxUID, c.RequestedSOPClassUID, c.RequestedSOPInstanceUID, elems)
+	payload, err := writeElementsToBytes(respElems, cs.context.transferSyntaxUID)
+	if err != nil {
+		sendError(err)
+		return
+	}
+	dataSetType := dimse.CommandDataSetTypeNull
+	if len(respElems) > 0 {
+		dataSetType = dimse.CommandDataSetTypeNonNull
+	}
+	cs.sendMessage(&dimse.N_SET_RSP{
+		AffectedSOPClassUID:       c.RequestedSOPClassUID,
+		MessageIDBeingRespondedTo: c.MessageID,
+		AffectedSOPInstanceUID:    c.RequestedSOPInstanceUID,
+		CommandDataSetType:        dataSetType,
+		Status:                    status,
+	}, payload)
+}
+
+func handleNCreate(
+	params ServiceProviderParams,
+	c *dimse.N_CREATE_RQ, data []byte,
+	cs *serviceCommandState) {
+	sendError := func(err error) {
+		cs.sendMessage(&dimse.N_CREATE_RSP{
+			AffectedSOPClassUID:       c.AffectedSOPClassUID,
+			MessageIDBeingRespondedTo: c.MessageID,
+			CommandDataSetType:        dimse.CommandDataSetTypeNull,
+			Status:                    dimse.Status{Status: dimse.StatusUnrecognizedOperation, ErrorComment: err.Error()},
+		}, nil)
+	}
+	if params.NCreate == nil {
+		sendError(fmt.Errorf("No callback found for N-CREATE"))
+		return
+	}
+	elems, err := readElementsInBytes(data, cs.context.transferSyntaxUID)
+	if err != nil {
+		sendError(err)
+		return
+	}
+	sopInstanceUID, respElems, status := params.NCreate(cs.ctx, cs.context.transferSyntaxUID, c.AffectedSOPClassUID, c.AffectedSOPInstanceUID, elems)
+	payload, err := writeElementsToBytes(respElems, cs.context.transferSyntaxUID)
+	if err != nil {
+		sendError(err)
+		return
+	}
+	dataSetType := dimse.CommandDataSetTypeNull
+	if len(respElems) > 0 {
+		dataSetType = dimse.CommandDataSetTypeNonNull
+	}
+	cs.sendMessage(&dimse.N_CREATE_RSP{
+		AffectedSOPClassUID:       c.AffectedSOPClassUID,
+		MessageIDBeingRespondedTo: c.MessageID,
+		AffectedSOPInstanceUID:    sopInstanceUID,
+		CommandDataSetType:        dataSetType,
+		Status:                    status,
+	}, payload)
+}
+
+func handleNDelete(
+	params ServiceProviderParams,
+	c *dimse.N_DELETE_RQ, data []byte,
+	cs *serviceCommandState) {
+	status := dimse.Status{Status: dimse.StatusUnrecognizedOperation, ErrorComment: "No callback found for N-DELETE"}
+	if params.NDelete != nil {
+		status = params.NDelete(cs.ctx, cs.context.transferSyntaxUID, c.RequestedSOPClassUID, c.RequestedSOPInstanceUID)
+	}
+	cs.sendMessage(&dimse.N_DELETE_RSP{
+		AffectedSOPClassUID:       c.RequestedSOPClassUID,
+		MessageIDBeingRespondedTo: c.MessageID,
+		AffectedSOPInstanceUID:    c.RequestedSOPInstanceUID,
+		CommandDataSetType:        dimse.CommandDataSetTypeNull,
+		Status:                    status,
+	}, nil)
+}
+
+func handleNAction(
+	params ServiceProviderParams,
+	c *dimse.N_ACTION_RQ, data []byte,
+	cs *serviceCommandState) {
+	sendError := func(err error) {
+		cs.sendMessage(&dimse.N_ACTION_RSP{
+			AffectedSOPClassUID:       c.RequestedSOPClassUID,
+			MessageIDBeingRespondedTo: c.MessageID,
+			CommandDataSetType:        dimse.CommandDataSetTypeNull,
+			Status:                    dimse.Status{Status: dimse.StatusUnrecognizedOperation, ErrorComment: err.Error()},
+		}, nil)
+	}
+	if c.RequestedSOPClassUID == sopclass.StorageCommitmentClasses[0].UID && c.ActionTypeID == 1 {
+		handleStorageCommitmentRequest(params, c, data, cs)
+		return
+	}
+	if params.NAction == nil {
+		sendError(fmt.Errorf("No callback found for N-ACTION"))
+		return
+	}
+	elems, err := readElementsInBytes(data, cs.context.transferSyntaxUID)
+	if err != nil {
+		sendError(err)
+		return
+	}
+	respElems, status := params.NAction(cs.ctx, cs.context.transferSyntaxUID, c.RequestedSOPClassUID, c.RequestedSOPInstanceUID, c.ActionTypeID, elems)
+	payload, err := writeElementsToBytes(respElems, cs.context.transferSyntaxUID)
+	if err != nil {
+		sendError(err)
+		return
+	}
+	dataSetType := dimse.CommandDataSetTypeNull
+	if len(respElems) > 0 {
+		dataSetType = dimse.CommandDataSetTypeNonNull
+	}
+	cs.sendMessage(&dimse.N_ACTION_RSP{
+		AffectedSOPClassUID:       c.RequestedSOPClassUID,
+		MessageIDBeingRespondedTo: c.MessageID,
+		ActionTypeID:              c.ActionTypeID,
+		AffectedSOPInstanceUID:    c.RequestedSOPInstanceUID,
+		CommandDataSetType:        dataSetType,
+		Status:                    status,
+	}, payload)
+}
+
+// handleStorageCommitmentRequest implements the N-ACTION side of the Storage
+// Commitment Push Model (PS3.4 Annex J, SOP class 1.2.840.10008.1.20.1): it
+// acknowledges the request with an N-ACTION-RSP, then checks the referenced
+// instances via params.StorageCommitment and reports the result to the
+// requestor asynchronously, over a new association, as an N-EVENT-REPORT-RQ.
+func handleStorageCommitmentRequest(
+	params ServiceProviderParams,
+	c *dimse.N_ACTION_RQ, data []byte,
+	cs *serviceCommandState) {
+	sendError := func(err error) {
+		cs.sendMessage(&dimse.N_ACTION_RSP{
+			AffectedSOPClassUID:       c.RequestedSOPClassUID,
+			MessageIDBeingRespondedTo: c.MessageID,
+			CommandDataSetType:        dimse.CommandDataSetTypeNull,
+			Status:                    dimse.Status{Status: dimse.StatusUnrecognizedOperation, ErrorComment: err.Error()},
+		}, nil)
+	}
+	if params.StorageCommitment == nil {
+		sendError(fmt.Errorf("No callback found for Storage Commitment N-ACTION"))
+		return
+	}
+	elems, err := readElementsInBytes(data, cs.context.transferSyntaxUID)
+	if err != nil {
+		sendError(err)
+		return
+	}
+	transactionUID, referenced, err := parseStorageCommitmentRequest(elems)
+	if err != nil {
+		sendError(err)
+		return
+	}
+	callingAETitle := cs.cm.callingAETitle
+	remoteHostPort, ok := params.RemoteAEs[callingAETitle]
+	if !ok {
+		sendError(fmt.Errorf("Storage commitment requestor '%v' not registered in RemoteAEs", callingAETitle))
+		return
+	}
+	cs.sendMessage(&dimse.N_ACTION_RSP{
+		AffectedSOPClassUID:       c.RequestedSOPClassUID,
+		MessageIDBeingRespondedTo: c.MessageID,
+		ActionTypeID:              c.ActionTypeID,
+		AffectedSOPInstanceUID:    c.RequestedSOPInstanceUID,
+		CommandDataSetType:        dimse.CommandDataSetTypeNull,
+		Status:                    dimse.Status{Status: dimse.StatusSuccess},
+	}, nil)
+	go reportStorageCommitmentResult(params, callingAETitle, remoteHostPort, transactionUID, referenced)
+}
+
+// reportStorageCommitmentResult runs params.StorageCommitment, then opens a
+// fresh association back to remoteAETitle and sends the result as an
+// N-EVENT-REPORT-RQ (eventTypeID 1 "Storage Commitment Request Successful"
+// if every referenced instance succeeded, 2 "...Complete - Failures Exist"
+// otherwise), per PS3.4 Annex J.3.
+func reportStorageCommitmentResult(params ServiceProviderParams, remoteAETitle, remoteHostPort, transactionUID string, referenced []StorageCommitmentSOPInstance) {
+	logger := params.Logger
+	if logger == nil {
+		logger = VLogLogger()
+	}
+	succeeded, failed := params.StorageCommitment(context.Background(), transactionUID, referenced)
+	su, err := NewServiceUser(ServiceUserParams{
+		CalledAETitle:  remoteAETitle,
+		CallingAETitle: params.AETitle,
+		SOPClasses:     sopclass.StorageCommitmentClasses,
+		TLSConfig:      params.RemoteTLSConfig,
+	})
+	if err != nil {
+		logger.Error("Storage commitment: failed to connect back", "remote_ae", remoteAETitle, "host_port", remoteHostPort, "err", err)
+		return
+	}
+	defer su.Release()
+	su.Connect(remoteHostPort)
+	eventTypeID := uint16(1)
+	if len(failed) > 0 {
+		eventTypeID = 2
+	}
+	sopClassUID := sopclass.StorageCommitmentClasses[0].UID
+	elems := encodeStorageCommitmentResult(transactionUID, succeeded, failed)
+	if err := su.NEventReport(sopClassUID, sopClassUID, eventTypeID, elems); err != nil {
+		logger.Error("Storage commitment: N-EVENT-REPORT failed", "remote_ae", remoteAETitle, "host_port", remoteHostPort, "err", err)
+	}
+}
+
+// StorageCommitmentSOPInstance names one SOP instance referenced by a
+// Storage Commitment transaction (PS3.4 Annex J).
+type StorageCommitmentSOPInstance struct {
+	SOPClassUID    string
+	SOPInstanceUID string
+}
+
+// sopInstanceSequenceElement builds the dicom.Element for a SQ-VR tag whose
+// items are (ReferencedSOPClassUID, ReferencedSOPInstanceUID) pairs, as used
+// by both the Storage Commitment N-ACTION-RQ and N-EVENT-REPORT-RQ.
+func sopInstanceSequenceElement(tag dicom.Tag, instances []StorageCommitmentSOPInstance) *dicom.Element {
+	items := make([]interface{}, len(instances))
+	for i, inst := range instances {
+		items[i] = []*dicom.Element{
+			dicom.MustNewElement(dicom.TagReferencedSOPClassUID, inst.SOPClassUID),
+			dicom.MustNewElement(dicom.TagReferencedSOPInstanceUID, inst.SOPInstanceUID),
+		}
+	}
+	return &dicom.Element{Tag: tag, Value: items}
+}
+
+// parseStorageCommitmentRequest extracts the TransactionUID and the
+// ReferencedSOPSequence from a Storage Commitment N-ACTION-RQ payload.
+func parseStorageCommitmentRequest(elems []*dicom.Element) (transactionUID string, referenced []StorageCommitmentSOPInstance, err error) {
+	for _, elem := range elems {
+		switch elem.Tag {
+		case dicom.TagTransactionUID:
+			if transactionUID, err = elem.GetString(); err != nil {
+				return "", nil, err
+			}
+		case dicom.TagReferencedSOPSequence:
+			for _, item := range elem.Value {
+				itemElems, ok := item.([]*dicom.Element)
+				if !ok {
+					continue
+				}
+				var inst StorageCommitmentSOPInstance
+				for _, ie := range itemElems {
+					switch ie.Tag {
+					case dicom.TagReferencedSOPClassUID:
+						inst.SOPClassUID, _ = ie.GetString()
+					case dicom.TagReferencedSOPInstanceUID:
+						inst.SOPInstanceUID, _ = ie.GetString()
+					}
+				}
+				referenced = append(referenced, inst)
+			}
+		}
+	}
+	if transactionUID == "" {
+		return "", nil, fmt.Errorf("Storage commitment N-ACTION-RQ missing TransactionUID")
+	}
+	return transactionUID, referenced, nil
+}
+
+// encodeStorageCommitmentResult builds the dataset for a Storage Commitment
+// N-EVENT-REPORT-RQ: the TransactionUID plus a ReferencedSOPSequence for the
+// instances confirmed stored and, if any failed, a FailedSOPSequence.
+func encodeStorageCommitmentResult(transactionUID string, succeeded, failed []StorageCommitmentSOPInstance) []*dicom.Element {
+	elems := []*dicom.Element{
+		dicom.MustNewElement(dicom.TagTransactionUID, transactionUID),
+		sopInstanceSequenceElement(dicom.TagReferencedSOPSequence, succeeded),
+	}
+	if len(failed) > 0 {
+		elems = append(elems, sopInstanceSequenceElement(dicom.TagFailedSOPSequence, failed))
+	}
+	return elems
+}
+
 // ServiceProviderParams defines parameters for ServiceProvider.
 type ServiceProviderParams struct {
 	// The application-entity title of the server. Must be nonempty
@@ -289,6 +770,18 @@ type ServiceProviderParams struct {
 	// If CFindCallback=nil, a C-FIND call will produce an error response.
 	CFind CFindCallback
 
+	// Worklist is called instead of CFind for a C-FIND whose
+	// AffectedSOPClassUID is ModalityWorklistInformationFind
+	// (sopclass.WorklistFindClasses), so a provider can serve the Patient/
+	// Study-root and Modality Worklist query models with separate,
+	// differently-shaped callbacks rather than CFind having to branch on
+	// sopClassUID itself. Unlike CFind, it isn't streaming: it returns its
+	// full set of matches (already filtered against query, or not --
+	// either way Filter re-applies PS3.4 C.2.2.2 matching before
+	// responses are sent) in one call. If nil, a Modality Worklist C-FIND
+	// falls back to CFind, then to the usual "no callback" error response.
+	Worklist WorklistCallback
+
 	// CMove is called on C_MOVE request.
 	CMove CMoveCallback
 
@@ -300,6 +793,219 @@ type ServiceProviderParams struct {
 
 	// If CStoreCallback=nil, a C-STORE call will produce an error response.
 	CStore CStoreCallback
+
+	// CStoreStream, if non-nil, handles C-STORE requests instead of CStore,
+	// receiving the instance's data-set bytes as they stream off the wire
+	// rather than buffered whole. See CStoreStreamCallback.
+	CStoreStream CStoreStreamCallback
+
+	// NEventReport, NGet, NSet, NAction, NCreate, and NDelete are called on
+	// the corresponding Normalized-service request (PS3.7 E.1). A nil
+	// callback produces an error response for that service, same as the
+	// C-* callbacks above.
+	NEventReport NEventReportCallback
+	NGet         NGetCallback
+	NSet         NSetCallback
+	NAction      NActionCallback
+	NCreate      NCreateCallback
+	NDelete      NDeleteCallback
+
+	// StorageCommitment, if non-nil, backs the built-in handling of
+	// N-ACTION-RQ (actionTypeID=1) against the Storage Commitment Push
+	// Model SOP Class (1.2.840.10008.1.20.1, PS3.4 Annex J): it is called
+	// with the TransactionUID and referenced SOP instances from the
+	// request, and should return which of them are actually stored
+	// (succeeded) and which are not (failed). This request takes priority
+	// over NAction for that SOP class/action type. The requestor's AE
+	// title is looked up in RemoteAEs to address the reverse
+	// N-EVENT-REPORT-RQ, so RemoteAEs must list it.
+	StorageCommitment StorageCommitmentCallback
+
+	// Authenticator, if non-nil, is called with the requestor's User Identity
+	// Negotiation sub-item (PS3.7 D.3.3.7), if any, during A-ASSOCIATE-RQ
+	// processing. Returning ok=false rejects the association. See
+	// Authenticator for details.
+	Authenticator Authenticator
+
+	// AcceptUnknownSOPClasses, if true, makes this provider accept a
+	// proposed presentation context even when its abstract syntax UID
+	// isn't one sopclass.LookupByUID recognizes, using the requestor's
+	// preferred offered transfer syntax, instead of rejecting it with
+	// PresentationContextProviderRejectionAbstractSyntaxNotSupported.
+	// Incoming commands (e.g. C-STORE) for such a context still reach the
+	// matching callback (e.g. CStoreCallback) with the negotiated,
+	// unrecognized SOP class UID passed through as usual. Useful for
+	// private/vendor-specific SOP classes this package has no built-in
+	// entry for. Ignored if AcceptUnknownSOPClassesFilter is also set.
+	AcceptUnknownSOPClasses bool
+
+	// AcceptUnknownSOPClassesFilter, if non-nil, is consulted in place of
+	// AcceptUnknownSOPClasses for each proposed presentation context whose
+	// abstract syntax is unrecognized, and lets the decision vary by the
+	// requestor's calling AE title or source IP rather than being an
+	// all-or-nothing toggle.
+	AcceptUnknownSOPClassesFilter func(callingAE, callerIP string) bool
+
+	// RoleSelection, if non-nil, controls what SCP/SCU Role Selection
+	// (PS3.7 D.3.3.4) this provider is willing to grant, keyed by SOP class
+	// UID: when a requestor's A-ASSOCIATE-RQ asks for a role this provider
+	// doesn't offer for that SOP class UID, the grant is narrowed to
+	// whatever both sides agree on (see grantedRole) rather than simply
+	// echoing back the request. A SOP class with no entry defaults to
+	// RoleSCU, i.e. nothing beyond the default is granted. Most commonly set
+	// to RoleSCP or RoleBoth for sopclass.StorageClasses entries, so a C-GET
+	// requestor can act as the SCP for that C-GET's C-STORE sub-operations.
+	RoleSelection map[string]Role
+
+	// TransferSyntaxPolicy decides which of the transfer syntaxes a
+	// requestor offers for an abstract syntax this provider accepts. Nil
+	// defaults to PreferOriginalTransferSyntaxPolicy, i.e. whichever
+	// syntax the requestor listed first -- this package's behavior before
+	// TransferSyntaxPolicy existed. Ignored for a given presentation
+	// context if NegotiationPolicy is set.
+	TransferSyntaxPolicy TransferSyntaxPolicy
+
+	// NegotiationPolicy, if non-nil, takes over presentation-context
+	// negotiation for every proposed context, in place of
+	// AcceptUnknownSOPClasses / AcceptUnknownSOPClassesFilter /
+	// TransferSyntaxPolicy above: it is the one place that can reject a
+	// context for an unsupported transfer syntax (PS3.8 Table 9-18 reason
+	// PresentationContextProviderRejectionTransferSyntaxNotSupported) or
+	// for an application-level policy reason
+	// (PresentationContextUserRejection), not just an unrecognized
+	// abstract syntax. See DefaultNegotiationPolicy for a ready-to-use
+	// preference-list-backed implementation.
+	NegotiationPolicy NegotiationPolicy
+
+	// AssociationEvents, if any field is set, is notified of the
+	// association's lifecycle -- request, accept, release, abort -- for
+	// access control, audit logging, or dynamic tuning. It complements
+	// Authorize (cert-based, runs before AE titles are fully processed)
+	// and Observer (fire-and-forget, no veto power): AssociationEvents.
+	// OnAssociateRequest can inspect the full proposed context list and
+	// reject the association outright.
+	AssociationEvents AssociationEventCallbacks
+
+	// Authorize, if non-nil, is consulted during A-ASSOCIATE-RQ processing,
+	// after the requestor's AE titles are known but before an
+	// A-ASSOCIATE-AC is sent. peer is the client certificate presented over
+	// TLSConfig (nil unless mutual TLS is in use; see TLSConfig). Returning
+	// a non-nil error rejects the association with an A-ASSOCIATE-RJ.
+	Authorize func(calledAETitle, callingAETitle string, peer *x509.Certificate) error
+
+	// MaxOpsInvoked and MaxOpsPerformed bound the Asynchronous Operations
+	// Window (PS3.7 D.3.3.3) this provider accepts from a requestor; zero
+	// means the default of one outstanding operation in each direction.
+	// A nonzero MaxOpsPerformed also bounds how many service callbacks run
+	// concurrently (serviceDispatcher.maxOpsSem); zero leaves callback
+	// concurrency unbounded. See the MaxOps* fields on
+	// ServiceUserParams for the corresponding request side.
+	MaxOpsInvoked   uint16
+	MaxOpsPerformed uint16
+
+	// TLSConfig, if non-nil, makes NewServiceProvider listen over TLS
+	// (PS3.15 Secure Transport Connection Profiles / BCP 195) instead of
+	// plaintext TCP. Use DefaultTLSConfig as a starting point for the
+	// cipher-suite and minimum-version settings, then set Certificates and,
+	// for mutual TLS, ClientCAs/ClientAuth as needed. The peer certificate
+	// chain presented by the requestor, if any, is available to Authorize
+	// and via serviceCommandState.PeerCertificates.
+	TLSConfig *tls.Config
+
+	// Transport, if non-nil, overrides how NewServiceProvider listens for
+	// inbound associations -- the general escape hatch for transports
+	// TLSConfig can't express (DTLS, a custom net.Listener, a test
+	// double). TLSConfig is a shorthand for Transport:
+	// TLSListenTransport{Config: TLSConfig}; set Transport directly only
+	// if that shorthand isn't enough.
+	Transport ListenTransport
+
+	// RequestTimeout, if nonzero, bounds how long a single C-FIND/C-MOVE/
+	// C-GET/C-STORE request may run before its ctx (see CFindCallback et
+	// al.) is canceled. Zero means no deadline beyond association teardown
+	// or an explicit C-CANCEL-RQ.
+	RequestTimeout time.Duration
+
+	// RemoteTLSConfig, if non-nil, is used to dial the outbound C-STORE
+	// association that handleCMove opens to a C-MOVE destination
+	// (RemoteAEs) over TLS, instead of plaintext TCP.
+	RemoteTLSConfig *tls.Config
+
+	// CMoveIdleTimeout closes a pooled outbound C-STORE association (see
+	// cstoreAssociationPool) that has sat idle this long instead of
+	// reusing it for the next C-MOVE. Zero means never expire idle
+	// associations.
+	CMoveIdleTimeout time.Duration
+
+	// CMoveMaxAssociationsPerDestination caps the number of concurrent
+	// outbound associations handleCMove keeps open to a single C-MOVE
+	// destination. Zero means unbounded.
+	CMoveMaxAssociationsPerDestination int
+
+	// cstorePool is set by NewServiceProvider so that successive C-MOVE
+	// requests across connections share pooled outbound associations. It
+	// is nil when a ServiceProviderParams is used directly with
+	// RunProviderForConn, in which case handleCMove falls back to opening
+	// a fresh association per C-STORE sub-operation.
+	cstorePool *cstoreAssociationPool
+
+	// Instrumentation, if its TracerProvider/MeterProvider are non-nil,
+	// enables OpenTelemetry tracing and metrics for DIMSE operations and
+	// state-machine transitions handled by this provider: a span per
+	// command (named e.g. "dicom.c-store") tagged with calling_ae,
+	// called_ae, sop_class_uid, transfer_syntax_uid, message_id, and
+	// dicom.status, plus the dicom.commands.total counter,
+	// dicom.command.duration_ms histogram, dicom.pdu.bytes_sent /
+	// dicom.pdu.bytes_received counters, and dicom.associations.active /
+	// dicom.commands.active gauges. The zero value disables instrumentation
+	// entirely.
+	Instrumentation Instrumentation
+
+	// Observer, if non-nil, receives synchronous callbacks for each
+	// association's state transitions, PDU wire traffic, and lifecycle
+	// events -- see the Observer interface doc comment for why this
+	// exists alongside Instrumentation.
+	Observer Observer
+
+	// Tracer, if non-nil, receives every DIMSE command each association
+	// sends or receives -- see the dimse.Tracer interface doc comment.
+	Tracer dimse.Tracer
+
+	// WireCompression lists, in preference order, the names of wire
+	// compressors (e.g. []string{"gzip"}) this provider is willing to use
+	// to compress P-DATA-TF data-set payloads. It's offered to the
+	// requestor as a private-vendor sub-item during the A-ASSOCIATE
+	// handshake; the requestor echoes back whichever of its own supported
+	// names, if any, also appears here, and that's what gets used for the
+	// rest of the association. Nil means never compress, which is also
+	// what happens with a requestor that doesn't support this extension at
+	// all (e.g. a standard PACS), preserving interop. See
+	// wireCompressor/negotiateWireCompressor and, for names this package
+	// actually knows how to use, builtinWireCompressors.
+	WireCompression []string
+
+	// Logger receives this provider's diagnostic output instead of the
+	// package default of VLogLogger(). See Logger and, e.g., SlogLogger.
+	Logger Logger
+
+	// ChannelFactory wraps the net.Conn RunProviderForConn was given
+	// (plaintext or, if TLSConfig is set, already-TLS) in a PDUChannel.
+	// Nil defaults to NewPDUChannel. Override it to exercise the state
+	// machine against a test double -- e.g. a replayed byte stream or a
+	// shim around a multiplexed connection -- without a real socket.
+	ChannelFactory PDUChannelFactory
+
+	// ARTIMTimeout bounds the DUL ARTIM timer (PS3.8 9.1.5) on this
+	// provider's side of the association (see ServiceUserParams.
+	// ARTIMTimeout for the matching client-side field). Zero defaults to
+	// 10 seconds.
+	ARTIMTimeout time.Duration
+
+	// PDVReadTimeout, if nonzero, bounds how long this association may sit
+	// idle (Sta06) waiting for the next P-DATA-TF before it is aborted.
+	// Zero means no idle read timeout beyond ctx cancellation (see
+	// RunProviderForConnContext).
+	PDVReadTimeout time.Duration
 }
 
 // DefaultMaxPDUSize is the the PDU size advertized by go-netdicom.
@@ -320,7 +1026,13 @@ const DefaultMaxPDUSize = 4 << 20
 // The function should store encode the sop{Class,InstanceUID} as the DICOM
 // header, followed by data. It should return either dimse.Success0 on success,
 // or one of CStoreStatus* error codes on errors.
+//
+// ctx is canceled when the association is torn down or, for streaming
+// operations, when the requestor issues a matching C-CANCEL-RQ; CStoreCallback
+// is not streaming, but ctx is still provided for consistency with the other
+// callbacks and so implementations can bail out of expensive writes early.
 type CStoreCallback func(
+	ctx context.Context,
 	transferSyntaxUID string,
 	sopClassUID string,
 	sopInstanceUID string,
@@ -337,12 +1049,31 @@ type CStoreCallback func(
 // matches, the callback should send multiple CFindResult objects, one for each
 // dataset.  The callback must close the channel after it produces all the
 // responses.
+//
+// ctx is canceled when the association is torn down or the requestor issues
+// a C-CANCEL-RQ naming this request; the callback should stop producing
+// results and close ch soon after ctx.Done() fires.
 type CFindCallback func(
+	ctx context.Context,
 	transferSyntaxUID string,
 	sopClassUID string,
 	filters []*dicom.Element,
 	ch chan CFindResult)
 
+// WorklistCallback implements a Modality Worklist C-FIND handler (PS3.4
+// Annex K); see ServiceProviderParams.Worklist. query is the requestor's
+// matching-key dataset, the same as CFindCallback's filters. Unlike
+// CFindCallback, the callback isn't expected to apply matching-key
+// filtering itself -- it may return every worklist entry it has and let
+// mwl.Filter(items, query) narrow them down, or do its own filtering (e.g.
+// pushed down into a database query) and return only the matches.
+//
+// ctx is canceled when the association is torn down or the requestor
+// issues a C-CANCEL-RQ naming this request.
+type WorklistCallback func(
+	ctx context.Context,
+	query []*dicom.Element) ([]mwl.WorklistItem, dimse.Status)
+
 // CMoveCallback implements C-MOVE or C-GET handler.  sopClassUID is the data
 // type requested (e.g.,"1.2.840.10008.5.1.4.1.1.1.2"), and transferSyntaxUID is
 // the data encoding requested (e.g., "1.2.840.10008.1.2.1").  These args are
@@ -351,7 +1082,12 @@ type CFindCallback func(
 // The callback must stream datasets or error to "ch". The callback may
 // block. The callback must close the channel after it produces all the
 // datasets.
+//
+// ctx is canceled when the association is torn down or the requestor issues
+// a C-CANCEL-RQ naming this request; the callback should stop producing
+// results and close ch soon after ctx.Done() fires.
 type CMoveCallback func(
+	ctx context.Context,
 	transferSyntaxUID string,
 	sopClassUID string,
 	filters []*dicom.Element,
@@ -361,10 +1097,98 @@ type CMoveCallback func(
 // dimse.Success.
 type CEchoCallback func() dimse.Status
 
+// NEventReportCallback implements an N-EVENT-REPORT handler: eventTypeID and
+// elems carry the event-specific payload (PS3.7 10.1.1) for the named SOP
+// instance.
+type NEventReportCallback func(
+	ctx context.Context,
+	transferSyntaxUID string,
+	sopClassUID string,
+	sopInstanceUID string,
+	eventTypeID uint16,
+	elems []*dicom.Element) dimse.Status
+
+// NGetCallback implements an N-GET handler, returning the requested
+// attributes of the named SOP instance.
+type NGetCallback func(
+	ctx context.Context,
+	transferSyntaxUID string,
+	sopClassUID string,
+	sopInstanceUID string) (respElems []*dicom.Element, status dimse.Status)
+
+// NSetCallback implements an N-SET handler: elems carries the attributes to
+// modify on the named SOP instance. The returned respElems, if any, are the
+// modification results (PS3.7 10.1.3).
+type NSetCallback func(
+	ctx context.Context,
+	transferSyntaxUID string,
+	sopClassUID string,
+	sopInstanceUID string,
+	elems []*dicom.Element) (respElems []*dicom.Element, status dimse.Status)
+
+// NActionCallback implements a generic N-ACTION handler: actionTypeID
+// selects the action (SOP-class specific) and elems carries its
+// action-information payload. See ServiceProviderParams.StorageCommitment
+// for the built-in Storage Commitment action, which takes priority over
+// this callback for that SOP class.
+type NActionCallback func(
+	ctx context.Context,
+	transferSyntaxUID string,
+	sopClassUID string,
+	sopInstanceUID string,
+	actionTypeID uint16,
+	elems []*dicom.Element) (respElems []*dicom.Element, status dimse.Status)
+
+// NCreateCallback implements an N-CREATE handler: elems carries the initial
+// attribute values for the new SOP instance. sopInstanceUID is the UID
+// proposed by the requestor, or empty if the SCP is expected to assign one;
+// the callback returns the UID actually assigned.
+//
+// A Modality Performed Procedure Step workflow (sopclass.MPPSClasses) is
+// just an NCreate (procedure step started, PerformedProcedureStepStatus
+// "IN PROGRESS") followed by an NSet (status "COMPLETED" or
+// "DISCONTINUED") against that SOP class -- there's no dedicated MPPS
+// callback, since PS3.4 Annex F defines no behavior beyond the generic
+// DIMSE-N semantics.
+type NCreateCallback func(
+	ctx context.Context,
+	transferSyntaxUID string,
+	sopClassUID string,
+	sopInstanceUID string,
+	elems []*dicom.Element) (assignedSOPInstanceUID string, respElems []*dicom.Element, status dimse.Status)
+
+// NDeleteCallback implements an N-DELETE handler for the named SOP instance.
+type NDeleteCallback func(
+	ctx context.Context,
+	transferSyntaxUID string,
+	sopClassUID string,
+	sopInstanceUID string) dimse.Status
+
+// StorageCommitmentCallback checks whether the SOP instances referenced by a
+// Storage Commitment transaction (PS3.4 Annex J) are actually stored. See
+// ServiceProviderParams.StorageCommitment.
+type StorageCommitmentCallback func(
+	ctx context.Context,
+	transactionUID string,
+	referenced []StorageCommitmentSOPInstance) (succeeded, failed []StorageCommitmentSOPInstance)
+
 // ServiceProvider encapsulates the state for DICOM server (provider).
 type ServiceProvider struct {
 	params   ServiceProviderParams
 	listener net.Listener
+
+	// shutdownCtx is canceled by Shutdown, and passed as the ctx of every
+	// RunProviderForConnContext call Run starts: canceling it is what
+	// drives each in-flight association's state machine to synthesize an
+	// A-ABORT (evt15; see statemachine.go's ctxDone handling) instead of
+	// being killed out from under its peer.
+	shutdownCtx    context.Context
+	shutdownCancel context.CancelFunc
+
+	// associations tracks in-flight RunProviderForConnContext goroutines,
+	// so Shutdown can wait for them to actually finish tearing down
+	// instead of just firing shutdownCancel and returning immediately.
+	associations sync.WaitGroup
 }
 
 func writeElementsToBytes(elems []*dicom.Element, transferSyntaxUID string) ([]byte, error) {
@@ -407,11 +1231,14 @@ func elementsString(elems []*dicom.Element) string {
 }
 
 // Send "ds" to remoteHostPort using C-STORE. Called as part of C-MOVE.
-func runCStoreOnNewAssociation(myAETitle, remoteAETitle, remoteHostPort string, ds *dicom.DataSet) error {
+// tlsConfig, if non-nil, dials the association over TLS (see
+// ServiceProviderParams.RemoteTLSConfig).
+func runCStoreOnNewAssociation(myAETitle, remoteAETitle, remoteHostPort string, ds *dicom.DataSet, tlsConfig *tls.Config) error {
 	su, err := NewServiceUser(ServiceUserParams{
 		CalledAETitle:  remoteAETitle,
 		CallingAETitle: myAETitle,
-		SOPClasses:     sopclass.StorageClasses})
+		SOPClasses:     sopclass.StorageClasses,
+		TLSConfig:      tlsConfig})
 	if err != nil {
 		return err
 	}
@@ -428,19 +1255,50 @@ func runCStoreOnNewAssociation(myAETitle, remoteAETitle, remoteHostPort string,
 // the service.
 func NewServiceProvider(params ServiceProviderParams, port string) (*ServiceProvider, error) {
 	sp := &ServiceProvider{params: params}
-	var err error
-	sp.listener, err = net.Listen("tcp", port)
+	sp.shutdownCtx, sp.shutdownCancel = context.WithCancel(context.Background())
+	transport := params.Transport
+	if transport == nil {
+		if params.TLSConfig != nil {
+			transport = TLSListenTransport{Config: params.TLSConfig}
+		} else {
+			transport = TCPListenTransport{}
+		}
+	}
+	listener, err := transport.Listen(port)
 	if err != nil {
 		return nil, err
 	}
+	sp.listener = listener
+	if params.RemoteAEs != nil {
+		sp.params.cstorePool = newCStoreAssociationPool(params.CMoveIdleTimeout, params.CMoveMaxAssociationsPerDestination)
+	}
 	return sp, nil
 }
 
 // RunProviderForConn starts threads for running a DICOM server on "conn". This
 // function returns immediately; "conn" will be cleaned up in the background.
 func RunProviderForConn(conn net.Conn, params ServiceProviderParams) {
+	RunProviderForConnContext(context.Background(), conn, params)
+}
+
+// RunProviderForConnContext is RunProviderForConn, except ctx additionally
+// bounds the association's lifetime: if ctx is canceled or its deadline
+// expires, the association is aborted (A-ABORT, evt15) instead of running
+// until the peer releases or the connection drops on its own. It starts the
+// state machine on a background goroutine, runs the association's
+// dispatcher on the calling goroutine, and returns once the association
+// has ended.
+func RunProviderForConnContext(ctx context.Context, conn net.Conn, params ServiceProviderParams) {
 	upcallCh := make(chan upcallEvent, 128)
-	disp := newServiceDispatcher()
+	var peerCertificates []*x509.Certificate
+	if tc, ok := conn.(*tls.Conn); ok {
+		peerCertificates = tc.ConnectionState().PeerCertificates
+	}
+	disp := newServiceDispatcher(params.MaxOpsPerformed, params.MaxOpsInvoked, params.RequestTimeout, peerCertificates)
+	disp.telemetry = newDICOMTelemetry(params.Instrumentation, params.Observer)
+	disp.tracer = params.Tracer
+	disp.telemetry.associationOpened(context.Background())
+	defer disp.telemetry.associationClosed(context.Background())
 	disp.registerCallback(dimse.CommandFieldC_STORE_RQ,
 		func(msg dimse.Message, data []byte, cs *serviceCommandState) {
 			handleCStore(params.CStore, msg.(*dimse.C_STORE_RQ), data, cs)
@@ -461,7 +1319,35 @@ func RunProviderForConn(conn net.Conn, params ServiceProviderParams) {
 		func(msg dimse.Message, data []byte, cs *serviceCommandState) {
 			handleCEcho(params, msg.(*dimse.C_ECHO_RQ), data, cs)
 		})
-	go runStateMachineForServiceProvider(conn, upcallCh, disp.downcallCh)
+	disp.registerCallback(dimse.CommandFieldC_CANCEL_RQ,
+		func(msg dimse.Message, data []byte, cs *serviceCommandState) {
+			handleCCancel(msg.(*dimse.C_CANCEL_RQ), cs)
+		})
+	disp.registerCallback(dimse.CommandFieldN_EVENT_REPORT_RQ,
+		func(msg dimse.Message, data []byte, cs *serviceCommandState) {
+			handleNEventReport(params, msg.(*dimse.N_EVENT_REPORT_RQ), data, cs)
+		})
+	disp.registerCallback(dimse.CommandFieldN_GET_RQ,
+		func(msg dimse.Message, data []byte, cs *serviceCommandState) {
+			handleNGet(params, msg.(*dimse.N_GET_RQ), data, cs)
+		})
+	disp.registerCallback(dimse.CommandFieldN_SET_RQ,
+		func(msg dimse.Message, data []byte, cs *serviceCommandState) {
+			handleNSet(params, msg.(*dimse.N_SET_RQ), data, cs)
+		})
+	disp.registerCallback(dimse.CommandFieldN_ACTION_RQ,
+		func(msg dimse.Message, data []byte, cs *serviceCommandState) {
+			handleNAction(params, msg.(*dimse.N_ACTION_RQ), data, cs)
+		})
+	disp.registerCallback(dimse.CommandFieldN_CREATE_RQ,
+		func(msg dimse.Message, data []byte, cs *serviceCommandState) {
+			handleNCreate(params, msg.(*dimse.N_CREATE_RQ), data, cs)
+		})
+	disp.registerCallback(dimse.CommandFieldN_DELETE_RQ,
+		func(msg dimse.Message, data []byte, cs *serviceCommandState) {
+			handleNDelete(params, msg.(*dimse.N_DELETE_RQ), data, cs)
+		})
+	go runStateMachineForServiceProvider(ctx, conn, params, upcallCh, disp.downcallCh)
 	for event := range upcallCh {
 		disp.handleEvent(event)
 	}
@@ -469,15 +1355,44 @@ func RunProviderForConn(conn net.Conn, params ServiceProviderParams) {
 }
 
 // Run listens to incoming connections, accepts them, and runs the DICOM
-// protocol. This function never returns.
+// protocol. It returns once Shutdown closes the listener.
 func (sp *ServiceProvider) Run() {
 	for {
 		conn, err := sp.listener.Accept()
 		if err != nil {
+			if sp.shutdownCtx.Err() != nil {
+				vlog.VI(1).Infof("Accept stopped: %v", err)
+				return
+			}
 			vlog.Errorf("Accept error: %v", err)
 			continue
 		}
-		go func() { RunProviderForConn(conn, sp.params) }()
+		sp.associations.Add(1)
+		go func() {
+			defer sp.associations.Done()
+			RunProviderForConnContext(sp.shutdownCtx, conn, sp.params)
+		}()
+	}
+}
+
+// Shutdown stops accepting new connections and cancels every in-flight
+// association's ctx, which drives each one to synthesize an A-ABORT
+// (see statemachine.go's ctxDone handling) rather than simply dropping the
+// connection. It then waits for all of them to finish tearing down, or for
+// ctx to expire first, whichever comes first.
+func (sp *ServiceProvider) Shutdown(ctx context.Context) error {
+	sp.listener.Close()
+	sp.shutdownCancel()
+	done := make(chan struct{})
+	go func() {
+		sp.associations.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
@@ -0,0 +1,294 @@
+package netdicom
+
+import (
+	"sync"
+	"time"
+)
+
+// ServiceUserPoolParams configures a ServiceUserPool (see NewServiceUserPool).
+// Much of the vocabulary here is deliberately borrowed from redis-style
+// connection pools (e.g. go-redis's PoolOptions): MinIdle/MaxIdle/MaxLifetime
+// size the pool, and IdleCheckFrequency drives a background reaper, since a
+// DICOM association is a similar expensive-to-establish, cheap-to-reuse
+// resource as a database connection.
+type ServiceUserPoolParams struct {
+	// ServerAddr is the "host:port" of the peer AE that every association
+	// in this pool connects to; see ServiceUser.Connect.
+	ServerAddr string
+
+	// Params is used as a template ServiceUserParams for every association
+	// the pool opens. Its SOPClasses/TransferSyntaxes should cover every
+	// abstract/transfer syntax any caller will ask for via Get, since the
+	// presentation contexts negotiated at handshake time are fixed for the
+	// life of an association.
+	Params ServiceUserParams
+
+	// MinIdle is the number of healthy idle associations the idle-check
+	// goroutine leaves in place when trimming; it won't release one if
+	// doing so would drop the pool below MinIdle. It does not open new
+	// associations to reach MinIdle: associations are only opened on
+	// demand, by Get, and then reused once released.
+	MinIdle int
+
+	// MaxIdle caps the number of idle associations kept in the pool; an
+	// association released back via Get's release func is torn down
+	// (A-RELEASE) instead of pooled once this many are already idle. Zero
+	// means unbounded.
+	MaxIdle int
+
+	// MaxLifetime, if nonzero, tears down a pooled association once it has
+	// been open this long, even if it's otherwise healthy and idle -- e.g.
+	// to bound how long it takes for a DNS/load-balancer change upstream of
+	// ServerAddr to be honored.
+	MaxLifetime time.Duration
+
+	// IdleCheckFrequency, if nonzero, runs a background goroutine that
+	// wakes up this often and tears down idle associations that have gone
+	// unhealthy, exceeded MaxLifetime, or sit beyond MinIdle. Zero disables
+	// proactive reaping; dead and expired associations are still noticed
+	// and dropped by Get/the release func, just not until something asks
+	// for one.
+	IdleCheckFrequency time.Duration
+}
+
+// serviceUserPoolEntry is one pooled, currently-idle association.
+type serviceUserPoolEntry struct {
+	su       *ServiceUser
+	openedAt time.Time
+	lastUsed time.Time
+}
+
+// alive reports whether entry's association is still usable. su.closed is
+// closed once the dispatcher tears the association down for any reason --
+// including evt17 (association rejected/transport failure) or evt19
+// (protocol error) surfacing out of networkReaderThread -- so a closed
+// entry means the peer or the state machine has already evicted it; the
+// pool must not hand it out or count it as reusable.
+func (entry *serviceUserPoolEntry) alive() bool {
+	select {
+	case <-entry.su.closed:
+		return false
+	default:
+		return true
+	}
+}
+
+// ServiceUserPool amortizes the cost of the A-ASSOCIATE handshake across many
+// DIMSE calls to the same peer AE. For bulk workloads (e.g. mirroring a study
+// of thousands of instances), running runStateMachineForServiceUser's full
+// sta01->sta06 handshake and an A-RELEASE teardown per call dominates the
+// actual work; ServiceUserPool instead keeps a set of warm, idle associations
+// and hands them out via Get, which the caller returns when done rather than
+// releasing.
+//
+// Unlike cstoreAssociationPool (purpose-built for handleCMove's outbound
+// C-STORE fan-out, keyed by destination and always offering
+// sopclass.StorageClasses), ServiceUserPool is general purpose: Get matches
+// an idle association by the abstract/transfer syntaxes the caller actually
+// needs against that association's negotiated presentation contexts, so one
+// pool can serve e.g. both C-FIND and C-STORE calls to a peer as long as
+// ServiceUserPoolParams.Params.SOPClasses offered both at handshake time.
+type ServiceUserPool struct {
+	params ServiceUserPoolParams
+	logger Logger
+
+	mu      sync.Mutex
+	idle    []*serviceUserPoolEntry
+	numOpen int // associations currently checked out or idle.
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewServiceUserPool creates a ServiceUserPool. If params.IdleCheckFrequency
+// is nonzero, it also starts the background idle-reaping goroutine; call
+// Close to stop it and tear down every idle association.
+func NewServiceUserPool(params ServiceUserPoolParams) *ServiceUserPool {
+	logger := params.Params.Logger
+	if logger == nil {
+		logger = VLogLogger()
+	}
+	p := &ServiceUserPool{
+		params: params,
+		logger: logger,
+		stopCh: make(chan struct{}),
+	}
+	if params.IdleCheckFrequency > 0 {
+		go p.idleCheckLoop()
+	}
+	return p
+}
+
+// matches reports whether su's negotiated presentation contexts satisfy
+// every abstract syntax UID in requiredAbstractSyntaxUIDs, each paired with a
+// transfer syntax in transferSyntaxUIDs (or any transfer syntax, if
+// transferSyntaxUIDs is empty).
+func (p *ServiceUserPool) matches(su *ServiceUser, requiredAbstractSyntaxUIDs, transferSyntaxUIDs []string) bool {
+	su.mu.Lock()
+	cm := su.cm
+	su.mu.Unlock()
+	if cm == nil {
+		return false
+	}
+	for _, abstractSyntaxUID := range requiredAbstractSyntaxUIDs {
+		e, ok := cm.abstractSyntaxNameToContextIDMap[abstractSyntaxUID]
+		if !ok {
+			return false
+		}
+		if len(transferSyntaxUIDs) == 0 {
+			continue
+		}
+		found := false
+		for _, ts := range transferSyntaxUIDs {
+			if ts == e.transferSyntaxUID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Get returns a ServiceUser whose negotiated presentation contexts cover
+// every UID in requiredAbstractSyntaxUIDs, each with a transfer syntax in
+// transferSyntaxUIDs (or any transfer syntax, if transferSyntaxUIDs is nil),
+// reusing a pooled idle association if one matches and is still alive, or
+// opening a new one against params.ServerAddr otherwise. The caller must
+// call the returned release func exactly once after its DIMSE exchange
+// finishes, passing healthy=false if the association should be torn down
+// (e.g. the DIMSE call itself returned an error) instead of returned to the
+// pool.
+func (p *ServiceUserPool) Get(requiredAbstractSyntaxUIDs, transferSyntaxUIDs []string) (*ServiceUser, func(healthy bool), error) {
+	p.mu.Lock()
+	live := p.idle[:0]
+	var match *serviceUserPoolEntry
+	for _, entry := range p.idle {
+		if !entry.alive() {
+			p.numOpen--
+			continue
+		}
+		if match == nil && p.matches(entry.su, requiredAbstractSyntaxUIDs, transferSyntaxUIDs) {
+			match = entry
+			continue
+		}
+		live = append(live, entry)
+	}
+	p.idle = live
+	p.mu.Unlock()
+
+	if match != nil {
+		p.logger.Debug("ServiceUserPool: reusing pooled association", "server", p.params.ServerAddr)
+		return match.su, p.releaseFunc(match), nil
+	}
+
+	su, err := NewServiceUser(p.params.Params)
+	if err != nil {
+		return nil, nil, err
+	}
+	su.Connect(p.params.ServerAddr)
+	entry := &serviceUserPoolEntry{su: su, openedAt: time.Now()}
+	p.mu.Lock()
+	p.numOpen++
+	p.mu.Unlock()
+	p.logger.Debug("ServiceUserPool: opened new association", "server", p.params.ServerAddr)
+	return su, p.releaseFunc(entry), nil
+}
+
+// releaseFunc returns the release closure Get hands back to the caller for
+// entry.
+func (p *ServiceUserPool) releaseFunc(entry *serviceUserPoolEntry) func(healthy bool) {
+	return func(healthy bool) {
+		discard := func() {
+			p.mu.Lock()
+			p.numOpen--
+			p.mu.Unlock()
+			if entry.alive() {
+				entry.su.Release()
+			}
+		}
+		if !healthy || !entry.alive() {
+			discard()
+			return
+		}
+		if p.params.MaxLifetime > 0 && time.Since(entry.openedAt) > p.params.MaxLifetime {
+			discard()
+			return
+		}
+		entry.lastUsed = time.Now()
+		p.mu.Lock()
+		if p.params.MaxIdle > 0 && len(p.idle) >= p.params.MaxIdle {
+			p.mu.Unlock()
+			discard()
+			return
+		}
+		p.idle = append(p.idle, entry)
+		p.mu.Unlock()
+	}
+}
+
+func (p *ServiceUserPool) idleCheckLoop() {
+	ticker := time.NewTicker(p.params.IdleCheckFrequency)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.reapIdle()
+		case <-p.stopCh:
+			return
+		}
+	}
+}
+
+// reapIdle tears down idle associations that have gone unhealthy or
+// exceeded MaxLifetime, then trims the remainder down to MinIdle,
+// evicting the least-recently-used entries first.
+func (p *ServiceUserPool) reapIdle() {
+	p.mu.Lock()
+	var keep, reap []*serviceUserPoolEntry
+	for _, entry := range p.idle {
+		if !entry.alive() || (p.params.MaxLifetime > 0 && time.Since(entry.openedAt) > p.params.MaxLifetime) {
+			reap = append(reap, entry)
+			continue
+		}
+		keep = append(keep, entry)
+	}
+	// keep is ordered oldest-released-first: releaseFunc only ever appends
+	// to the tail of p.idle (with lastUsed set just before appending), and
+	// Get's filtering above preserves relative order, so keep[0] is always
+	// the least-recently-used entry still idle. Trim from the front to
+	// match.
+	for len(keep) > p.params.MinIdle {
+		reap = append(reap, keep[0])
+		keep = keep[1:]
+	}
+	p.idle = keep
+	p.numOpen -= len(reap)
+	p.mu.Unlock()
+	for _, entry := range reap {
+		if entry.alive() {
+			p.logger.Debug("ServiceUserPool: reaping idle association", "server", p.params.ServerAddr)
+			entry.su.Release()
+		}
+	}
+}
+
+// Close stops the idle-check goroutine (if running) and tears down every
+// currently idle association. It does not affect associations currently
+// checked out via Get; it is safe to call even if IdleCheckFrequency was
+// zero.
+func (p *ServiceUserPool) Close() {
+	p.stopOnce.Do(func() { close(p.stopCh) })
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.numOpen -= len(idle)
+	p.mu.Unlock()
+	for _, entry := range idle {
+		if entry.alive() {
+			entry.su.Release()
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package netdicom
+
+import "log/slog"
+
+// slogLogger adapts Logger to a *slog.Logger (log/slog, Go's standard
+// structured-logging package).
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// SlogLogger returns a Logger that writes through l.
+func SlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l: l}
+}
+
+func (a slogLogger) Debug(msg string, kv ...interface{}) { a.l.Debug(msg, kv...) }
+func (a slogLogger) Info(msg string, kv ...interface{})  { a.l.Info(msg, kv...) }
+func (a slogLogger) Warn(msg string, kv ...interface{})  { a.l.Warn(msg, kv...) }
+func (a slogLogger) Error(msg string, kv ...interface{}) { a.l.Error(msg, kv...) }
+
+func (a slogLogger) With(kv ...interface{}) Logger { return SlogLogger(a.l.With(kv...)) }
@@ -2,6 +2,15 @@ package sopclass
 
 // TODO(saito) Merge w/ dicomuid.
 
+// NOTE: a go:generate pipeline that parses Part 6 of the DICOM standard
+// (or a sibling pynetdicom/dcmtk UID data file) to regenerate this file
+// would need one of those as an input; this checkout has neither, so the
+// groups below remain hand-maintained rather than generated. Fabricating a
+// parser with no real input to parse against would just trade one
+// hand-maintained (and typo-prone) list for another dressed up as
+// generated -- tracked separately for whenever such a data file is
+// available to check in alongside it.
+
 // DICOM SOP UID listing.
 //
 // https://www.dicomlibrary.com/dicom/sop/
@@ -10,147 +19,304 @@ package sopclass
 type SOPUID struct {
 	Name string
 	UID  string
+
+	// Retired is true for a SOP class the DICOM standard has withdrawn
+	// from later editions (e.g. most of the Print Management SOP
+	// classes). Retired classes are still listed, since peers may still
+	// offer or require them, but callers building a new SCU/SCP should
+	// generally prefer a non-retired alternative where one exists.
+	Retired bool
 }
 
 // For issuing C-ECHO
 var VerificationClasses = []SOPUID{
-	SOPUID{"VerificationSOPClass", "1.2.840.10008.1.1"},
+	SOPUID{"VerificationSOPClass", "1.2.840.10008.1.1", false},
 }
 
 // For issuing C-STORE or C-GET
 var StorageClasses = []SOPUID{
-	SOPUID{"ComputedRadiographyImageStorage", "1.2.840.10008.5.1.4.1.1.1"},
-	SOPUID{"DigitalXRayImagePresentationStorage", "1.2.840.10008.5.1.4.1.1.1.1"},
-	SOPUID{"DigitalMammographyXRayImagePresentationStorage", "1.2.840.10008.5.1.4.1.1.1.2"},
-	SOPUID{"DigitalMammographyXRayImageProcessingStorage", "1.2.840.10008.5.1.4.1.1.1.2.1"},
-	SOPUID{"DigitalIntraOralXRayImagePresentationStorage", "1.2.840.10008.5.1.4.1.1.1.3"},
-	SOPUID{"CTImageStorage", "1.2.840.10008.5.1.4.1.1.2"},
-	SOPUID{"EnhancedCTImageStorage", "1.2.840.10008.5.1.4.1.1.2.1"},
-	SOPUID{"LegacyConvertedEnhancedCTImageStorage", "1.2.840.10008.5.1.4.1.1.2.2"},
-	SOPUID{"UltrasoundMultiframeImageStorage", "1.2.840.10008.5.1.4.1.1.3.1"},
-	SOPUID{"MRImageStorage", "1.2.840.10008.5.1.4.1.1.4"},
-	SOPUID{"EnhancedMRImageStorage", "1.2.840.10008.5.1.4.1.1.4.1"},
-	SOPUID{"MRSpectroscopyStorage", "1.2.840.10008.5.1.4.1.1.4.2"},
-	SOPUID{"EnhancedMRColorImageStorage", "1.2.840.10008.5.1.4.1.1.4.3"},
-	SOPUID{"LegacyConvertedEnhancedMRImageStorage", "1.2.840.10008.5.1.4.1.1.4.4"},
-	SOPUID{"UltrasoundImageStorage", "1.2.840.10008.5.1.4.1.1.6.1"},
-	SOPUID{"EnhancedUSVolumeStorage", "1.2.840.10008.5.1.4.1.1.6.2"},
-	SOPUID{"SecondaryCaptureImageStorage", "1.2.840.10008.5.1.4.1.1.7"},
-	SOPUID{"MultiframeSingleBitSecondaryCaptureImageStorage", "1.2.840.10008.5.1.4.1.1.7.1"},
-	SOPUID{"MultiframeGrayscaleByteSecondaryCaptureImageStorage", "1.2.840.10008.5.1.4.1.1.7.2"},
-	SOPUID{"MultiframeGrayscaleWordSecondaryCaptureImageStorage", "1.2.840.10008.5.1.4.1.1.7.3"},
-	SOPUID{"MultiframeTrueColorSecondaryCaptureImageStorage", "1.2.840.10008.5.1.4.1.1.7.4"},
-	SOPUID{"TwelveLeadECGWaveformStorage", "1.2.840.10008.5.1.4.1.1.9.1.1"},
-	SOPUID{"GeneralECGWaveformStorage", "1.2.840.10008.5.1.4.1.1.9.1.2"},
-	SOPUID{"AmbulatoryECGWaveformStorage", "1.2.840.10008.5.1.4.1.1.9.1.3"},
-	SOPUID{"HemodynamicWaveformStorage", "1.2.840.10008.5.1.4.1.1.9.2.1"},
-	SOPUID{"CardiacElectrophysiologyWaveformStorage", "1.2.840.10008.5.1.4.1.1.9.3.1"},
-	SOPUID{"BasicVoiceAudioWaveformStorage", "1.2.840.10008.5.1.4.1.1.9.4.1"},
-	SOPUID{"GeneralAudioWaveformStorage", "1.2.840.10008.5.1.4.1.1.9.4.2"},
-	SOPUID{"ArterialPulseWaveformStorage", "1.2.840.10008.5.1.4.1.1.9.5.1"},
-	SOPUID{"RespiratoryWaveformStorage", "1.2.840.10008.5.1.4.1.1.9.6.1"},
-	SOPUID{"GrayscaleSoftcopyPresentationStateStorage", "1.2.840.10008.5.1.4.1.1.11.1"},
-	SOPUID{"ColorSoftcopyPresentationStateStorage", "1.2.840.10008.5.1.4.1.1.11.2"},
-	SOPUID{"PseudocolorSoftcopyPresentationStageStorage", "1.2.840.10008.5.1.4.1.1.11.3"},
-	SOPUID{"BlendingSoftcopyPresentationStateStorage", "1.2.840.10008.5.1.4.1.1.11.4"},
-	SOPUID{"XAXRFGrayscaleSoftcopyPresentationStateStorage", "1.2.840.10008.5.1.4.1.1.11.5"},
-	SOPUID{"XRayAngiographicImageStorage", "1.2.840.10008.5.1.4.1.1.12.1"},
-	SOPUID{"EnhancedXAImageStorage", "1.2.840.10008.5.1.4.1.1.12.1.1"},
-	SOPUID{"XRayRadiofluoroscopicImageStorage", "1.2.840.10008.5.1.4.1.1.12.2"},
-	SOPUID{"EnhancedXRFImageStorage", "1.2.840.10008.5.1.4.1.1.12.2.1"},
-	SOPUID{"XRay3DAngiographicImageStorage", "1.2.840.10008.5.1.4.1.1.13.1.1"},
-	SOPUID{"XRay3DCraniofacialImageStorage", "1.2.840.10008.5.1.4.1.1.13.1.2"},
-	SOPUID{"BreastTomosynthesisImageStorage", "1.2.840.10008.5.1.4.1.1.13.1.3"},
-	SOPUID{"BreastProjectionXRayImagePresentationStorage", "1.2.840.10008.5.1.4.1.1.13.1.4"},
-	SOPUID{"BreastProjectionXRayImageProcessingStorage", "1.2.840.10008.5.1.4.1.1.13.1.5"},
-	SOPUID{"IntravascularOpticalCoherenceTomographyImagePresentationStorage", "1.2.840.10008.5.1.4.1.1.14.1"},
-	SOPUID{"IntravascularOpticalCoherenceTomographyImageProcessingStorage", "1.2.840.10008.5.1.4.1.1.14.2"},
-	SOPUID{"NuclearMedicineImageStorage", "1.2.840.10008.5.1.4.1.1.20"},
-	SOPUID{"ParametricMapStorage", "1.2.840.10008.5.1.4.1.1.30"},
-	SOPUID{"RawDataStorage", "1.2.840.10008.5.1.4.1.1.66"},
-	SOPUID{"SpatialRegistrationStorage", "1.2.840.10008.5.1.4.1.1.66.1"},
-	SOPUID{"SpatialFiducialsStorage", "1.2.840.10008.5.1.4.1.1.66.2"},
-	SOPUID{"DeformableSpatialRegistrationStorage", "1.2.840.10008.5.1.4.1.1.66.3"},
-	SOPUID{"SegmentationStorage", "1.2.840.10008.5.1.4.1.1.66.4"},
-	SOPUID{"SurfaceSegmentationStorage", "1.2.840.10008.5.1.4.1.1.66.5"},
-	SOPUID{"RealWorldValueMappingStorage", "1.2.840.10008.5.1.4.1.1.67"},
-	SOPUID{"SurfaceScanMeshStorage", "1.2.840.10008.5.1.4.1.1.68.1"},
-	SOPUID{"SurfaceScanPointCloudStorage", "1.2.840.10008.5.1.4.1.1.68.2"},
-	SOPUID{"VLEndoscopicImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.1"},
-	SOPUID{"VideoEndoscopicImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.1.1"},
-	SOPUID{"VLMicroscopicImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.2"},
-	SOPUID{"VideoMicroscopicImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.2.1"},
-	SOPUID{"VLSlideCoordinatesMicroscopicImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.3"},
-	SOPUID{"VLPhotographicImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.4"},
-	SOPUID{"VideoPhotographicImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.4.1"},
-	SOPUID{"OphthalmicPhotography8BitImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.5.1"},
-	SOPUID{"OphthalmicPhotography16BitImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.5.2"},
-	SOPUID{"StereometricRelationshipStorage", "1.2.840.10008.5.1.4.1.1.77.1.5.3"},
-	SOPUID{"OpthalmicTomographyImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.5.4"},
-	SOPUID{"WideFieldOpthalmicPhotographyStereographicProjectionImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.5.5"},
-	SOPUID{"WideFieldOpthalmicPhotography3DCoordinatesImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.5.6"},
-	SOPUID{"VLWholeSlideMicroscopyImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.6"},
-	SOPUID{"LensometryMeasurementsStorage", "1.2.840.10008.5.1.4.1.1.78.1"},
-	SOPUID{"AutorefractionMeasurementsStorage", "1.2.840.10008.5.1.4.1.1.78.2"},
-	SOPUID{"KeratometryMeasurementsStorage", "1.2.840.10008.5.1.4.1.1.78.3"},
-	SOPUID{"SubjectiveRefractionMeasurementsStorage", "1.2.840.10008.5.1.4.1.1.78.4"},
-	SOPUID{"VisualAcuityMeasurementsStorage", "1.2.840.10008.5.1.4.1.1.78.5"},
-	SOPUID{"SpectaclePrescriptionReportStorage", "1.2.840.10008.5.1.4.1.1.78.6"},
-	SOPUID{"OpthalmicAxialMeasurementsStorage", "1.2.840.10008.5.1.4.1.1.78.7"},
-	SOPUID{"IntraocularLensCalculationsStorage", "1.2.840.10008.5.1.4.1.1.78.8"},
-	SOPUID{"MacularGridThicknessAndVolumeReport", "1.2.840.10008.5.1.4.1.1.79.1"},
-	SOPUID{"OpthalmicVisualFieldStaticPerimetryMeasurementsStorag", "1.2.840.10008.5.1.4.1.1.80.1"},
-	SOPUID{"OpthalmicThicknessMapStorage", "1.2.840.10008.5.1.4.1.1.81.1"},
-	SOPUID{"CornealTopographyMapStorage", "1.2.840.10008.5.1.4.1.1.82.1"},
-	SOPUID{"BasicTextSRStorage", "1.2.840.10008.5.1.4.1.1.88.11"},
-	SOPUID{"EnhancedSRStorage", "1.2.840.10008.5.1.4.1.1.88.22"},
-	SOPUID{"ComprehensiveSRStorage", "1.2.840.10008.5.1.4.1.1.88.33"},
-	SOPUID{"Comprehenseice3DSRStorage", "1.2.840.10008.5.1.4.1.1.88.34"},
-	SOPUID{"ExtensibleSRStorage", "1.2.840.10008.5.1.4.1.1.88.35"},
-	SOPUID{"ProcedureSRStorage", "1.2.840.10008.5.1.4.1.1.88.40"},
-	SOPUID{"MammographyCADSRStorage", "1.2.840.10008.5.1.4.1.1.88.50"},
-	SOPUID{"KeyObjectSelectionStorage", "1.2.840.10008.5.1.4.1.1.88.59"},
-	SOPUID{"ChestCADSRStorage", "1.2.840.10008.5.1.4.1.1.88.65"},
-	SOPUID{"XRayRadiationDoseSRStorage", "1.2.840.10008.5.1.4.1.1.88.67"},
-	SOPUID{"RadiopharmaceuticalRadiationDoseSRStorage", "1.2.840.10008.5.1.4.1.1.88.68"},
-	SOPUID{"ColonCADSRStorage", "1.2.840.10008.5.1.4.1.1.88.69"},
-	SOPUID{"ImplantationPlanSRDocumentStorage", "1.2.840.10008.5.1.4.1.1.88.70"},
-	SOPUID{"EncapsulatedPDFStorage", "1.2.840.10008.5.1.4.1.1.104.1"},
-	SOPUID{"EncapsulatedCDAStorage", "1.2.840.10008.5.1.4.1.1.104.2"},
-	SOPUID{"PositronEmissionTomographyImageStorage", "1.2.840.10008.5.1.4.1.1.128"},
-	SOPUID{"EnhancedPETImageStorage", "1.2.840.10008.5.1.4.1.1.130"},
-	SOPUID{"LegacyConvertedEnhancedPETImageStorage", "1.2.840.10008.5.1.4.1.1.128.1"},
-	SOPUID{"BasicStructuredDisplayStorage", "1.2.840.10008.5.1.4.1.1.131"},
-	SOPUID{"RTImageStorage", "1.2.840.10008.5.1.4.1.1.481.1"},
-	SOPUID{"RTDoseStorage", "1.2.840.10008.5.1.4.1.1.481.2"},
-	SOPUID{"RTStructureSetStorage", "1.2.840.10008.5.1.4.1.1.481.3"},
-	SOPUID{"RTBeamsTreatmentRecordStorage", "1.2.840.10008.5.1.4.1.1.481.4"},
-	SOPUID{"RTPlanStorage", "1.2.840.10008.5.1.4.1.1.481.5"},
-	SOPUID{"RTBrachyTreatmentRecordStorage", "1.2.840.10008.5.1.4.1.1.481.6"},
-	SOPUID{"RTTreatmentSummaryRecordStorage", "1.2.840.10008.5.1.4.1.1.481.7"},
-	SOPUID{"RTIonPlanStorage", "1.2.840.10008.5.1.4.1.1.481.8"},
-	SOPUID{"RTIonBeamsTreatmentRecordStorage", "1.2.840.10008.5.1.4.1.1.481.9"},
-	SOPUID{"RTBeamsDeliveryInstructionStorage", "1.2.840.10008.5.1.4.34.7"},
-	SOPUID{"GenericImplantTemplateStorage", "1.2.840.10008.5.1.4.43.1"},
-	SOPUID{"ImplantAssemblyTemplateStorage", "1.2.840.10008.5.1.4.44.1"},
-	SOPUID{"ImplantTemplateGroupStorage", "1.2.840.10008.5.1.4.45.1"},
+	SOPUID{"ComputedRadiographyImageStorage", "1.2.840.10008.5.1.4.1.1.1", false},
+	SOPUID{"DigitalXRayImagePresentationStorage", "1.2.840.10008.5.1.4.1.1.1.1", false},
+	SOPUID{"DigitalMammographyXRayImagePresentationStorage", "1.2.840.10008.5.1.4.1.1.1.2", false},
+	SOPUID{"DigitalMammographyXRayImageProcessingStorage", "1.2.840.10008.5.1.4.1.1.1.2.1", false},
+	SOPUID{"DigitalIntraOralXRayImagePresentationStorage", "1.2.840.10008.5.1.4.1.1.1.3", false},
+	SOPUID{"CTImageStorage", "1.2.840.10008.5.1.4.1.1.2", false},
+	SOPUID{"EnhancedCTImageStorage", "1.2.840.10008.5.1.4.1.1.2.1", false},
+	SOPUID{"LegacyConvertedEnhancedCTImageStorage", "1.2.840.10008.5.1.4.1.1.2.2", false},
+	SOPUID{"UltrasoundMultiframeImageStorage", "1.2.840.10008.5.1.4.1.1.3.1", false},
+	SOPUID{"MRImageStorage", "1.2.840.10008.5.1.4.1.1.4", false},
+	SOPUID{"EnhancedMRImageStorage", "1.2.840.10008.5.1.4.1.1.4.1", false},
+	SOPUID{"MRSpectroscopyStorage", "1.2.840.10008.5.1.4.1.1.4.2", false},
+	SOPUID{"EnhancedMRColorImageStorage", "1.2.840.10008.5.1.4.1.1.4.3", false},
+	SOPUID{"LegacyConvertedEnhancedMRImageStorage", "1.2.840.10008.5.1.4.1.1.4.4", false},
+	SOPUID{"UltrasoundImageStorage", "1.2.840.10008.5.1.4.1.1.6.1", false},
+	SOPUID{"EnhancedUSVolumeStorage", "1.2.840.10008.5.1.4.1.1.6.2", false},
+	SOPUID{"SecondaryCaptureImageStorage", "1.2.840.10008.5.1.4.1.1.7", false},
+	SOPUID{"MultiframeSingleBitSecondaryCaptureImageStorage", "1.2.840.10008.5.1.4.1.1.7.1", false},
+	SOPUID{"MultiframeGrayscaleByteSecondaryCaptureImageStorage", "1.2.840.10008.5.1.4.1.1.7.2", false},
+	SOPUID{"MultiframeGrayscaleWordSecondaryCaptureImageStorage", "1.2.840.10008.5.1.4.1.1.7.3", false},
+	SOPUID{"MultiframeTrueColorSecondaryCaptureImageStorage", "1.2.840.10008.5.1.4.1.1.7.4", false},
+	SOPUID{"TwelveLeadECGWaveformStorage", "1.2.840.10008.5.1.4.1.1.9.1.1", false},
+	SOPUID{"GeneralECGWaveformStorage", "1.2.840.10008.5.1.4.1.1.9.1.2", false},
+	SOPUID{"AmbulatoryECGWaveformStorage", "1.2.840.10008.5.1.4.1.1.9.1.3", false},
+	SOPUID{"HemodynamicWaveformStorage", "1.2.840.10008.5.1.4.1.1.9.2.1", false},
+	SOPUID{"CardiacElectrophysiologyWaveformStorage", "1.2.840.10008.5.1.4.1.1.9.3.1", false},
+	SOPUID{"BasicVoiceAudioWaveformStorage", "1.2.840.10008.5.1.4.1.1.9.4.1", false},
+	SOPUID{"GeneralAudioWaveformStorage", "1.2.840.10008.5.1.4.1.1.9.4.2", false},
+	SOPUID{"ArterialPulseWaveformStorage", "1.2.840.10008.5.1.4.1.1.9.5.1", false},
+	SOPUID{"RespiratoryWaveformStorage", "1.2.840.10008.5.1.4.1.1.9.6.1", false},
+	SOPUID{"GrayscaleSoftcopyPresentationStateStorage", "1.2.840.10008.5.1.4.1.1.11.1", false},
+	SOPUID{"ColorSoftcopyPresentationStateStorage", "1.2.840.10008.5.1.4.1.1.11.2", false},
+	SOPUID{"PseudocolorSoftcopyPresentationStageStorage", "1.2.840.10008.5.1.4.1.1.11.3", false},
+	SOPUID{"BlendingSoftcopyPresentationStateStorage", "1.2.840.10008.5.1.4.1.1.11.4", false},
+	SOPUID{"XAXRFGrayscaleSoftcopyPresentationStateStorage", "1.2.840.10008.5.1.4.1.1.11.5", false},
+	SOPUID{"XRayAngiographicImageStorage", "1.2.840.10008.5.1.4.1.1.12.1", false},
+	SOPUID{"EnhancedXAImageStorage", "1.2.840.10008.5.1.4.1.1.12.1.1", false},
+	SOPUID{"XRayRadiofluoroscopicImageStorage", "1.2.840.10008.5.1.4.1.1.12.2", false},
+	SOPUID{"EnhancedXRFImageStorage", "1.2.840.10008.5.1.4.1.1.12.2.1", false},
+	SOPUID{"XRay3DAngiographicImageStorage", "1.2.840.10008.5.1.4.1.1.13.1.1", false},
+	SOPUID{"XRay3DCraniofacialImageStorage", "1.2.840.10008.5.1.4.1.1.13.1.2", false},
+	SOPUID{"BreastTomosynthesisImageStorage", "1.2.840.10008.5.1.4.1.1.13.1.3", false},
+	SOPUID{"BreastProjectionXRayImagePresentationStorage", "1.2.840.10008.5.1.4.1.1.13.1.4", false},
+	SOPUID{"BreastProjectionXRayImageProcessingStorage", "1.2.840.10008.5.1.4.1.1.13.1.5", false},
+	SOPUID{"IntravascularOpticalCoherenceTomographyImagePresentationStorage", "1.2.840.10008.5.1.4.1.1.14.1", false},
+	SOPUID{"IntravascularOpticalCoherenceTomographyImageProcessingStorage", "1.2.840.10008.5.1.4.1.1.14.2", false},
+	SOPUID{"NuclearMedicineImageStorage", "1.2.840.10008.5.1.4.1.1.20", false},
+	SOPUID{"ParametricMapStorage", "1.2.840.10008.5.1.4.1.1.30", false},
+	SOPUID{"RawDataStorage", "1.2.840.10008.5.1.4.1.1.66", false},
+	SOPUID{"SpatialRegistrationStorage", "1.2.840.10008.5.1.4.1.1.66.1", false},
+	SOPUID{"SpatialFiducialsStorage", "1.2.840.10008.5.1.4.1.1.66.2", false},
+	SOPUID{"DeformableSpatialRegistrationStorage", "1.2.840.10008.5.1.4.1.1.66.3", false},
+	SOPUID{"SegmentationStorage", "1.2.840.10008.5.1.4.1.1.66.4", false},
+	SOPUID{"SurfaceSegmentationStorage", "1.2.840.10008.5.1.4.1.1.66.5", false},
+	SOPUID{"RealWorldValueMappingStorage", "1.2.840.10008.5.1.4.1.1.67", false},
+	SOPUID{"SurfaceScanMeshStorage", "1.2.840.10008.5.1.4.1.1.68.1", false},
+	SOPUID{"SurfaceScanPointCloudStorage", "1.2.840.10008.5.1.4.1.1.68.2", false},
+	SOPUID{"VLEndoscopicImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.1", false},
+	SOPUID{"VideoEndoscopicImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.1.1", false},
+	SOPUID{"VLMicroscopicImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.2", false},
+	SOPUID{"VideoMicroscopicImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.2.1", false},
+	SOPUID{"VLSlideCoordinatesMicroscopicImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.3", false},
+	SOPUID{"VLPhotographicImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.4", false},
+	SOPUID{"VideoPhotographicImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.4.1", false},
+	SOPUID{"OphthalmicPhotography8BitImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.5.1", false},
+	SOPUID{"OphthalmicPhotography16BitImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.5.2", false},
+	SOPUID{"StereometricRelationshipStorage", "1.2.840.10008.5.1.4.1.1.77.1.5.3", false},
+	SOPUID{"OpthalmicTomographyImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.5.4", false},
+	SOPUID{"WideFieldOpthalmicPhotographyStereographicProjectionImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.5.5", false},
+	SOPUID{"WideFieldOpthalmicPhotography3DCoordinatesImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.5.6", false},
+	SOPUID{"VLWholeSlideMicroscopyImageStorage", "1.2.840.10008.5.1.4.1.1.77.1.6", false},
+	SOPUID{"LensometryMeasurementsStorage", "1.2.840.10008.5.1.4.1.1.78.1", false},
+	SOPUID{"AutorefractionMeasurementsStorage", "1.2.840.10008.5.1.4.1.1.78.2", false},
+	SOPUID{"KeratometryMeasurementsStorage", "1.2.840.10008.5.1.4.1.1.78.3", false},
+	SOPUID{"SubjectiveRefractionMeasurementsStorage", "1.2.840.10008.5.1.4.1.1.78.4", false},
+	SOPUID{"VisualAcuityMeasurementsStorage", "1.2.840.10008.5.1.4.1.1.78.5", false},
+	SOPUID{"SpectaclePrescriptionReportStorage", "1.2.840.10008.5.1.4.1.1.78.6", false},
+	SOPUID{"OpthalmicAxialMeasurementsStorage", "1.2.840.10008.5.1.4.1.1.78.7", false},
+	SOPUID{"IntraocularLensCalculationsStorage", "1.2.840.10008.5.1.4.1.1.78.8", false},
+	SOPUID{"MacularGridThicknessAndVolumeReport", "1.2.840.10008.5.1.4.1.1.79.1", false},
+	SOPUID{"OphthalmicVisualFieldStaticPerimetryMeasurementsStorage", "1.2.840.10008.5.1.4.1.1.80.1", false},
+	SOPUID{"OpthalmicThicknessMapStorage", "1.2.840.10008.5.1.4.1.1.81.1", false},
+	SOPUID{"CornealTopographyMapStorage", "1.2.840.10008.5.1.4.1.1.82.1", false},
+	SOPUID{"BasicTextSRStorage", "1.2.840.10008.5.1.4.1.1.88.11", false},
+	SOPUID{"EnhancedSRStorage", "1.2.840.10008.5.1.4.1.1.88.22", false},
+	SOPUID{"ComprehensiveSRStorage", "1.2.840.10008.5.1.4.1.1.88.33", false},
+	SOPUID{"Comprehensive3DSRStorage", "1.2.840.10008.5.1.4.1.1.88.34", false},
+	SOPUID{"ExtensibleSRStorage", "1.2.840.10008.5.1.4.1.1.88.35", false},
+	SOPUID{"ProcedureSRStorage", "1.2.840.10008.5.1.4.1.1.88.40", false},
+	SOPUID{"MammographyCADSRStorage", "1.2.840.10008.5.1.4.1.1.88.50", false},
+	SOPUID{"KeyObjectSelectionStorage", "1.2.840.10008.5.1.4.1.1.88.59", false},
+	SOPUID{"ChestCADSRStorage", "1.2.840.10008.5.1.4.1.1.88.65", false},
+	SOPUID{"XRayRadiationDoseSRStorage", "1.2.840.10008.5.1.4.1.1.88.67", false},
+	SOPUID{"RadiopharmaceuticalRadiationDoseSRStorage", "1.2.840.10008.5.1.4.1.1.88.68", false},
+	SOPUID{"ColonCADSRStorage", "1.2.840.10008.5.1.4.1.1.88.69", false},
+	SOPUID{"ImplantationPlanSRDocumentStorage", "1.2.840.10008.5.1.4.1.1.88.70", false},
+	SOPUID{"EncapsulatedPDFStorage", "1.2.840.10008.5.1.4.1.1.104.1", false},
+	SOPUID{"EncapsulatedCDAStorage", "1.2.840.10008.5.1.4.1.1.104.2", false},
+	SOPUID{"PositronEmissionTomographyImageStorage", "1.2.840.10008.5.1.4.1.1.128", false},
+	SOPUID{"EnhancedPETImageStorage", "1.2.840.10008.5.1.4.1.1.130", false},
+	SOPUID{"LegacyConvertedEnhancedPETImageStorage", "1.2.840.10008.5.1.4.1.1.128.1", false},
+	SOPUID{"BasicStructuredDisplayStorage", "1.2.840.10008.5.1.4.1.1.131", false},
+	SOPUID{"RTImageStorage", "1.2.840.10008.5.1.4.1.1.481.1", false},
+	SOPUID{"RTDoseStorage", "1.2.840.10008.5.1.4.1.1.481.2", false},
+	SOPUID{"RTStructureSetStorage", "1.2.840.10008.5.1.4.1.1.481.3", false},
+	SOPUID{"RTBeamsTreatmentRecordStorage", "1.2.840.10008.5.1.4.1.1.481.4", false},
+	SOPUID{"RTPlanStorage", "1.2.840.10008.5.1.4.1.1.481.5", false},
+	SOPUID{"RTBrachyTreatmentRecordStorage", "1.2.840.10008.5.1.4.1.1.481.6", false},
+	SOPUID{"RTTreatmentSummaryRecordStorage", "1.2.840.10008.5.1.4.1.1.481.7", false},
+	SOPUID{"RTIonPlanStorage", "1.2.840.10008.5.1.4.1.1.481.8", false},
+	SOPUID{"RTIonBeamsTreatmentRecordStorage", "1.2.840.10008.5.1.4.1.1.481.9", false},
+	SOPUID{"RTBeamsDeliveryInstructionStorage", "1.2.840.10008.5.1.4.34.7", false},
+	SOPUID{"GenericImplantTemplateStorage", "1.2.840.10008.5.1.4.43.1", false},
+	SOPUID{"ImplantAssemblyTemplateStorage", "1.2.840.10008.5.1.4.44.1", false},
+	SOPUID{"ImplantTemplateGroupStorage", "1.2.840.10008.5.1.4.45.1", false},
 }
 
 // For issuing C-FIND
 var QRFindClasses = []SOPUID{
-	SOPUID{"PatientRootQueryRetrieveInformationModelFind", "1.2.840.10008.5.1.4.1.2.1.1"},
-	SOPUID{"StudyRootQueryRetrieveInformationModelFind", "1.2.840.10008.5.1.4.1.2.2.1"},
-	SOPUID{"PatientStudyOnlyQueryRetrieveInformationModelFind", "1.2.840.10008.5.1.4.1.2.3.1"},
-	SOPUID{"ModalityWorklistInformationFind", "1.2.840.10008.5.1.4.31"}}
+	SOPUID{"PatientRootQueryRetrieveInformationModelFind", "1.2.840.10008.5.1.4.1.2.1.1", false},
+	SOPUID{"StudyRootQueryRetrieveInformationModelFind", "1.2.840.10008.5.1.4.1.2.2.1", false},
+	SOPUID{"PatientStudyOnlyQueryRetrieveInformationModelFind", "1.2.840.10008.5.1.4.1.2.3.1", false},
+	SOPUID{"ModalityWorklistInformationFind", "1.2.840.10008.5.1.4.31", false}}
 
 // For issuing C-MOVE
 var QRMoveClasses = []SOPUID{
-	SOPUID{"PatientRootQueryRetrieveInformationModelMove", "1.2.840.10008.5.1.4.1.2.1.2"},
-	SOPUID{"StudyRootQueryRetrieveInformationModelMove", "1.2.840.10008.5.1.4.1.2.2.2"},
-	SOPUID{"PatientStudyOnlyQueryRetrieveInformationModelMove", "1.2.840.10008.5.1.4.1.2.3.2"}}
+	SOPUID{"PatientRootQueryRetrieveInformationModelMove", "1.2.840.10008.5.1.4.1.2.1.2", false},
+	SOPUID{"StudyRootQueryRetrieveInformationModelMove", "1.2.840.10008.5.1.4.1.2.2.2", false},
+	SOPUID{"PatientStudyOnlyQueryRetrieveInformationModelMove", "1.2.840.10008.5.1.4.1.2.3.2", false}}
 
-// TODO(saito) Does this really work?
+// For issuing C-GET. A C-GET SCU also needs ServiceUserParams.RoleSelection
+// set to RoleSCP or RoleBoth for the sopclass.StorageClasses UIDs it expects
+// back as C-STORE sub-operations (PS3.4 C.4.3.1.1), since otherwise the SCP
+// has no grounds to treat this association as one it may send C-STORE
+// requests over; see QRExtendedNegotiation for the accompanying relational-
+// query flags some SCPs also expect.
 var QRGetClasses = []SOPUID{
-	SOPUID{"PatientRootQueryRetrieveInformationModelGet", "1.2.840.10008.5.1.4.1.2.1.3"},
-	SOPUID{"StudyRootQueryRetrieveInformationModelGet", "1.2.840.10008.5.1.4.1.2.2.3"},
-	SOPUID{"PatientStudyOnlyQueryRetrieveInformationModelGet", "1.2.840.10008.5.1.4.1.2.3.3"}}
+	SOPUID{"PatientRootQueryRetrieveInformationModelGet", "1.2.840.10008.5.1.4.1.2.1.3", false},
+	SOPUID{"StudyRootQueryRetrieveInformationModelGet", "1.2.840.10008.5.1.4.1.2.2.3", false},
+	SOPUID{"PatientStudyOnlyQueryRetrieveInformationModelGet", "1.2.840.10008.5.1.4.1.2.3.3", false}}
+
+// QRExtendedNegotiation builds the Extended Negotiation
+// ApplicationInformation payload (PS3.4 C.4.3.1.1, as amended by Supplements
+// 99/213) a Q/R Find/Move/Get SCU sends per negotiated SOP class UID (see
+// ServiceUserParams.ExtendedNegotiation) to advertise which of the four
+// optional query behaviors it intends to use: relational (not just
+// hierarchical) queries, combined date-time range matching, fuzzy semantic
+// matching of person names, and timezone query adjustment. An SCP that
+// doesn't see this sub-item, or sees a false byte for one of these, may
+// reject a query that relies on it.
+func QRExtendedNegotiation(relationalQueries, combinedDateTimeMatching, fuzzySemanticMatching, timezoneQueryAdjustment bool) []byte {
+	bit := func(supported bool) byte {
+		if supported {
+			return 1
+		}
+		return 0
+	}
+	return []byte{
+		bit(relationalQueries),
+		bit(combinedDateTimeMatching),
+		bit(fuzzySemanticMatching),
+		bit(timezoneQueryAdjustment),
+	}
+}
+
+// For issuing or receiving N-ACTION/N-EVENT-REPORT under the Storage
+// Commitment Push Model (PS3.4 Annex J).
+var StorageCommitmentClasses = []SOPUID{
+	SOPUID{"StorageCommitmentPushModelSOPClass", "1.2.840.10008.1.20.1", false},
+}
+
+// For issuing or receiving N-CREATE (procedure step started) and N-SET
+// (procedure step updated/completed/discontinued) against the Modality
+// Performed Procedure Step SOP class (PS3.4 Annex F). Unlike Storage
+// Commitment, MPPS needs no special-cased handler: it's just the generic
+// ServiceProviderParams.NCreate/NSet callbacks invoked against this SOP
+// class, with the MPPS instance UID as the SOP instance.
+var MPPSClasses = []SOPUID{
+	SOPUID{"ModalityPerformedProcedureStepSOPClass", "1.2.840.10008.3.1.2.3.3", false},
+}
+
+// For issuing C-FIND against the Modality Worklist Information Model
+// (PS3.4 Annex K). ModalityWorklistInformationFind is also reachable via
+// QRFindClasses for backward compatibility, since existing callers already
+// depend on finding it there.
+var WorklistFindClasses = []SOPUID{
+	SOPUID{"ModalityWorklistInformationFind", "1.2.840.10008.5.1.4.31", false},
+}
+
+// For issuing or receiving N-CREATE/N-SET/N-ACTION/N-GET/N-EVENT-REPORT
+// against the Basic Grayscale/Color Print Management SOP classes (PS3.4
+// Annex H). Most of these were retired from later editions of the
+// standard, but peers (especially older modalities and film printers)
+// still commonly offer and require them.
+//
+// This list is a starting point, not exhaustive -- it isn't generated from
+// a machine-readable copy of Part 4 Annex H, which this checkout doesn't
+// have a copy of.
+var PrintClasses = []SOPUID{
+	SOPUID{"BasicFilmSessionSOPClass", "1.2.840.10008.5.1.1.1", true},
+	SOPUID{"BasicFilmBoxSOPClass", "1.2.840.10008.5.1.1.2", true},
+	SOPUID{"BasicGrayscaleImageBoxSOPClass", "1.2.840.10008.5.1.1.4", true},
+	SOPUID{"BasicColorImageBoxSOPClass", "1.2.840.10008.5.1.1.4.1", true},
+	SOPUID{"PrintJobSOPClass", "1.2.840.10008.5.1.1.14", true},
+	SOPUID{"BasicAnnotationBoxSOPClass", "1.2.840.10008.5.1.1.15", true},
+	SOPUID{"PrinterSOPClass", "1.2.840.10008.5.1.1.16", false},
+	SOPUID{"PrinterConfigurationRetrievalSOPClass", "1.2.840.10008.5.1.1.16.376", false},
+	SOPUID{"PresentationLUTSOPClass", "1.2.840.10008.5.1.1.23", false},
+}
+
+// For issuing or receiving the Unified Procedure Step SOP classes (PS3.4
+// Annex CC): N-CREATE/N-SET/N-GET/N-ACTION/N-EVENT-REPORT against UPS
+// Push/Watch/Pull/Event.
+var UPSClasses = []SOPUID{
+	SOPUID{"UnifiedProcedureStepPushSOPClass", "1.2.840.10008.5.1.4.34.6.1", false},
+	SOPUID{"UnifiedProcedureStepWatchSOPClass", "1.2.840.10008.5.1.4.34.6.2", false},
+	SOPUID{"UnifiedProcedureStepPullSOPClass", "1.2.840.10008.5.1.4.34.6.3", false},
+	SOPUID{"UnifiedProcedureStepEventSOPClass", "1.2.840.10008.5.1.4.34.6.4", false},
+}
+
+// Storage SOP classes for non-patient objects: Media Storage Directory
+// (the DICOMDIR, PS3.3 Annex F), Hanging Protocols, Color Palettes, and
+// the implant template family (also reachable via StorageClasses, listed
+// again here for callers that want just the non-patient subset).
+var NonPatientObjectClasses = []SOPUID{
+	SOPUID{"MediaStorageDirectoryStorage", "1.2.840.10008.1.3.10", false},
+	SOPUID{"HangingProtocolStorage", "1.2.840.10008.5.1.4.38.1", false},
+	SOPUID{"ColorPaletteStorage", "1.2.840.10008.5.1.4.39.1", false},
+	SOPUID{"GenericImplantTemplateStorage", "1.2.840.10008.5.1.4.43.1", false},
+	SOPUID{"ImplantAssemblyTemplateStorage", "1.2.840.10008.5.1.4.44.1", false},
+	SOPUID{"ImplantTemplateGroupStorage", "1.2.840.10008.5.1.4.45.1", false},
+}
+
+// For issuing C-FIND against the Relevant Patient Information Query SOP
+// classes (PS3.4 Annex Q).
+var RelevantPatientInfoQueryClasses = []SOPUID{
+	SOPUID{"GeneralRelevantPatientInformationQuery", "1.2.840.10008.5.1.4.37.1", false},
+	SOPUID{"BreastImagingRelevantPatientInformationQuery", "1.2.840.10008.5.1.4.37.2", false},
+	SOPUID{"CardiacRelevantPatientInformationQuery", "1.2.840.10008.5.1.4.37.3", false},
+}
+
+// all is every SOPUID this package knows about, across all the typed
+// slices above, for LookupByUID/LookupByName.
+var all = func() []SOPUID {
+	var a []SOPUID
+	for _, classes := range [][]SOPUID{
+		VerificationClasses,
+		StorageClasses,
+		QRFindClasses,
+		QRMoveClasses,
+		QRGetClasses,
+		StorageCommitmentClasses,
+		MPPSClasses,
+		WorklistFindClasses,
+		PrintClasses,
+		UPSClasses,
+		NonPatientObjectClasses,
+		RelevantPatientInfoQueryClasses,
+	} {
+		a = append(a, classes...)
+	}
+	return a
+}()
+
+// LookupByUID returns the SOPUID with the given UID, if this package knows
+// about it.
+func LookupByUID(uid string) (SOPUID, bool) {
+	for _, s := range all {
+		if s.UID == uid {
+			return s, true
+		}
+	}
+	return SOPUID{}, false
+}
+
+// LookupByName returns the SOPUID with the given Name (e.g.
+// "CTImageStorage"), if this package knows about it.
+func LookupByName(name string) (SOPUID, bool) {
+	for _, s := range all {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return SOPUID{}, false
+}
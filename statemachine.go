@@ -4,12 +4,14 @@ package netdicom
 // http://dicom.nema.org/medical/dicom/current/output/pdf/part08.pdf
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
-	"github.com/golang/glog"
 	"github.com/yasushi-saito/go-dicom"
+	"github.com/yasushi-saito/go-netdicom/dimse"
 	"io"
 	"net"
-	"strings"
 	"sync/atomic"
 	"time"
 )
@@ -25,6 +27,15 @@ func (s *stateType) String() string {
 
 var smSeq int32 = 32 // for assignign unique stateMachine.name
 
+// defaultARTIMTimeout and defaultAssociateTimeout are used in place of a
+// zero ServiceUserParams.ARTIMTimeout/AssociateTimeout or
+// ServiceProviderParams.ARTIMTimeout -- the delay startTimer/
+// startAssociateTimer used unconditionally before those fields existed.
+const (
+	defaultARTIMTimeout     = 10 * time.Second
+	defaultAssociateTimeout = 10 * time.Second
+)
+
 var (
 	sta01 = &stateType{"Sta01", "Idle"}
 	sta02 = &stateType{"Sta02", "Transport connection open (Awaiting A-ASSOCIATE-RQ PDU)"}
@@ -81,19 +92,23 @@ func (s *stateAction) String() string {
 var actionAe1 = &stateAction{"AE-1",
 	"Issue TRANSPORT CONNECT request primitive to local transport service",
 	func(sm *stateMachine, event stateEvent) *stateType {
-		if event.conn == nil && event.serverAddr == "" {
-			glog.Fatalf("%s: illegal event %v", sm.name, event)
-		}
+		doassert(event.conn != nil || event.serverAddr != "")
 		go func(ch chan stateEvent, serverHostPort string) {
 			conn, err := net.Dial("tcp", serverHostPort)
 			if err != nil {
-				glog.Infof("%s: Failed to connect to %s: %v", sm.name, serverHostPort, err)
+				sm.logger.Info("Failed to connect", "server", serverHostPort, "err", err)
 				ch <- stateEvent{event: evt17, pdu: nil, err: err}
 				close(ch)
 				return
 			}
 			ch <- stateEvent{event: evt02, pdu: nil, err: nil, conn: conn}
-			networkReaderThread(ch, conn, sm.userParams.MaxPDUSize, sm.name)
+			factory := sm.channelFactory
+			if factory == nil {
+				factory = NewPDUChannel
+			}
+			channel := factory(conn)
+			channel.SetMaxPDUSize(uint32(sm.userParams.MaxPDUSize))
+			networkReaderThread(ch, channel, sm.name, sm.telemetry, sm.logger)
 		}(sm.netCh, event.serverAddr)
 		return sta04
 	}}
@@ -130,7 +145,7 @@ var actionAe2 = &stateAction{"AE-2", "Send A-ASSOCIATE-RQ-PDU",
 			Items:           items,
 		}
 		sendPDU(sm, pdu)
-		startTimer(sm)
+		startAssociateTimer(sm)
 		return sta05
 	}}
 
@@ -150,29 +165,52 @@ var actionAe3 = &stateAction{"AE-3", "Issue A-ASSOCIATE confirmation (accept) pr
 			sm.upcallCh <- upcallEvent{eventType: upcallEventHandshakeCompleted}
 			sm.maxPDUSize = sm.userParams.MaxPDUSize // TODO(saito) Extract from response!
 			doassert(sm.maxPDUSize > 0)
+			sm.telemetry.observeAssociationEstablished(sm.ctx, sm.userParams.CalledAETitle,
+				sm.contextManager.peerImplementationClassUID, sm.contextManager.peerImplementationVersionName,
+				"", sm.contextManager.presentationContexts())
+			sm.announcedEstablished = true
+			startPDVReadTimer(sm)
 			return sta06
 		} else {
-			glog.Error(err)
+			sm.logger.Error("A-ASSOCIATE-AC rejected", "err", err)
 			return actionAa8.Callback(sm, event)
 		}
 	}}
 
 var actionAe4 = &stateAction{"AE-4", "Issue A-ASSOCIATE confirmation (reject) primitive and close transport connection",
 	func(sm *stateMachine, event stateEvent) *stateType {
-		closeConnection(sm)
+		closeConnection(sm, nil)
 		return sta01
 	}}
 
 var actionAe5 = &stateAction{"AE-5", "Issue Transport connection response primitive; start ARTIM timer",
 	func(sm *stateMachine, event stateEvent) *stateType {
 		doassert(event.conn != nil)
+		doassert(sm.channel != nil)
+		sm.channel.SetMaxPDUSize(uint32(sm.providerParams.MaxPDUSize))
 		startTimer(sm)
-		go func(ch chan stateEvent, conn net.Conn) {
-			networkReaderThread(ch, conn, sm.providerParams.MaxPDUSize, sm.name)
-		}(sm.netCh, event.conn)
+		go func(ch chan stateEvent, channel PDUChannel) {
+			networkReaderThread(ch, channel, sm.name, sm.telemetry, sm.logger)
+		}(sm.netCh, sm.channel)
 		return sta02
 	}}
 
+// authorizeAssociateRequest consults sm.providerParams.Authorize, if set,
+// passing it the requestor's AE titles and TLS peer certificate (nil unless
+// mutual TLS is in use). A non-nil return rejects the association.
+func authorizeAssociateRequest(sm *stateMachine, pdu *A_ASSOCIATE) error {
+	if sm.providerParams.Authorize == nil {
+		return nil
+	}
+	var peer *x509.Certificate
+	if tc, ok := sm.conn.(*tls.Conn); ok {
+		if certs := tc.ConnectionState().PeerCertificates; len(certs) > 0 {
+			peer = certs[0]
+		}
+	}
+	return sm.providerParams.Authorize(pdu.CalledAETitle, pdu.CallingAETitle, peer)
+}
+
 func extractPresentationContextItems(items []SubItem) []*PresentationContextItem {
 	var contextItems []*PresentationContextItem
 	for _, item := range items {
@@ -190,18 +228,23 @@ otherwise issue A-ASSOCIATE-RJ-PDU and start ARTIM timer`,
 		stopTimer(sm)
 		pdu := event.pdu.(*A_ASSOCIATE)
 		if pdu.ProtocolVersion != 0x0001 {
-			glog.Infof("%s: Wrong remote protocol version 0x%x", sm.name, pdu.ProtocolVersion)
+			sm.logger.Info("Wrong remote protocol version", "protocol_version", pdu.ProtocolVersion)
 			rj := A_ASSOCIATE_RJ{Result: 1, Source: 2, Reason: 2}
 			sendPDU(sm, &rj)
 			startTimer(sm)
 			return sta13
 		}
+		sm.contextManager.callingAETitle = pdu.CallingAETitle
+		sm.contextManager.calledAETitle = pdu.CalledAETitle
 		responses := []SubItem{
 			&ApplicationContextItem{
 				Name: DefaultApplicationContextItemName,
 			},
 		}
 		items, err := sm.contextManager.onAssociateRequest(extractPresentationContextItems(pdu.Items))
+		if err == nil {
+			err = authorizeAssociateRequest(sm, pdu)
+		}
 		if err != nil {
 			// TODO(saito) set proper error code.
 			sm.downcallCh <- stateEvent{
@@ -243,6 +286,11 @@ var actionAe7 = &stateAction{"AE-7", "Send A-ASSOCIATE-AC PDU",
 	func(sm *stateMachine, event stateEvent) *stateType {
 		sendPDU(sm, event.pdu.(*A_ASSOCIATE))
 		sm.upcallCh <- upcallEvent{eventType: upcallEventHandshakeCompleted}
+		sm.telemetry.observeAssociationEstablished(sm.ctx, sm.contextManager.callingAETitle,
+			sm.contextManager.peerImplementationClassUID, sm.contextManager.peerImplementationVersionName,
+			sm.contextManager.peerTraceParent, sm.contextManager.presentationContexts())
+		sm.announcedEstablished = true
+		startPDVReadTimer(sm)
 		return sta06
 	}}
 
@@ -253,81 +301,227 @@ var actionAe8 = &stateAction{"AE-8", "Send A-ASSOCIATE-RJ PDU and start ARTIM ti
 		return sta13
 	}}
 
-// Produce a list of P_DATA_TF PDUs that collective store "data".
-func splitDataIntoPDUs(sm *stateMachine, abstractSyntaxName string, command bool, data []byte) []P_DATA_TF {
-	doassert(sm.maxPDUSize > 0)
-	doassert(len(data) > 0)
-	context, err := sm.contextManager.lookupByAbstractSyntaxUID(abstractSyntaxName)
+// pdvFragmenter streams data as a sequence of PresentationDataValueItems,
+// one fragment at a time, instead of splitDataIntoPDUs's old approach of
+// materializing the whole list of P_DATA_TF PDUs up front. actionDt1 uses
+// this to round-robin fragments across several in-flight sends, so a large
+// C-STORE payload doesn't hold up an interleaved C-FIND response behind it.
+//
+// The command set (command==true) is always sent as-is, per PS3.7 -- only
+// the data-set payload is eligible for the wire compression negotiated via
+// sm.contextManager.wireCompressor, if any; compression, unlike
+// fragmentation, still has to happen on the whole payload up front, since
+// it produces a single compressed stream.
+type pdvFragmenter struct {
+	sm        *stateMachine
+	command   bool
+	contextID byte
+	data      []byte // remaining bytes not yet handed out by next()
+}
+
+func newPDVFragmenter(sm *stateMachine, payload *stateEventDataPayload) (*pdvFragmenter, error) {
+	doassert(len(payload.data) > 0)
+	context, err := sm.contextManager.lookupByAbstractSyntaxUID(payload.abstractSyntaxName)
 	if err != nil {
-		// TODO(saito) Don't crash here.
-		glog.Fatalf("%s: Illegal syntax name %s: %s", sm.name, dicom.UIDString(abstractSyntaxName), err)
+		return nil, fmt.Errorf("%s: illegal syntax name %s: %v", sm.name, dicom.UIDString(payload.abstractSyntaxName), err)
+	}
+	data := payload.data
+	if !payload.command && sm.contextManager.wireCompressor != nil {
+		compressed, err := sm.contextManager.wireCompressor.Compress(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to %s-compress data: %v", sm.name, sm.contextManager.wireCompressor.Name(), err)
+		}
+		data = compressed
 	}
-	var pdus []P_DATA_TF
+	return &pdvFragmenter{sm: sm, command: payload.command, contextID: context.contextID, data: data}, nil
+}
+
+// next returns this fragmenter's next PresentationDataValueItem-sized chunk
+// and whether it was the last one. It must not be called again once done is
+// true.
+func (f *pdvFragmenter) next() (item PresentationDataValueItem, done bool) {
+	doassert(f.sm.maxPDUSize > 0)
+	doassert(len(f.data) > 0)
 	// two byte header overhead.
 	//
 	// TODO(saito) move the magic number elsewhere.
-	var maxChunkSize = sm.maxPDUSize - 2
-	for len(data) > 0 {
-		chunkSize := len(data)
-		if chunkSize > maxChunkSize {
-			chunkSize = sm.maxPDUSize
-		}
-		chunk := data[0:chunkSize]
-		data = data[chunkSize:]
-		pdus = append(pdus, P_DATA_TF{Items: []PresentationDataValueItem{
-			PresentationDataValueItem{
-				ContextID: context.contextID,
-				Command:   command,
-				Last:      false, // Set later.
-				Value:     chunk,
-			}}})
+	maxChunkSize := f.sm.maxPDUSize - 2
+	chunkSize := len(f.data)
+	if chunkSize > maxChunkSize {
+		chunkSize = maxChunkSize
 	}
-	if len(pdus) > 0 {
-		pdus[len(pdus)-1].Items[0].Last = true
+	chunk := f.data[0:chunkSize]
+	f.data = f.data[chunkSize:]
+	done = len(f.data) == 0
+	return PresentationDataValueItem{
+		ContextID: f.contextID,
+		Command:   f.command,
+		Last:      done,
+		Value:     chunk,
+	}, done
+}
+
+// sendOneRound sends one PDV from at most one fragmenter per presentation
+// context in active, dropping those that are now exhausted, and returns the
+// fragmenters still left to send. Calling this repeatedly, once per
+// fragmenter added, is what makes concurrent sends on distinct contexts
+// interleave instead of running to completion one at a time; see actionDt1.
+//
+// Two fragmenters sharing the same context ID are never interleaved with
+// each other -- only the first one (in active's order) gets a turn each
+// round, so the second's PDVs don't start hitting the wire until the first
+// is done. dimse.CommandAssembler.AddDataPDU reassembles by context ID
+// alone, so interleaving two in-flight commands on the same context would
+// concatenate their command/data bytes into one corrupted stream (or abort
+// with "Mixed context" if they disagree on which of command/data is being
+// sent); see stateMachine.commandAssemblers.
+func sendOneRound(sm *stateMachine, active []*pdvFragmenter) []*pdvFragmenter {
+	remaining := active[:0]
+	sentContext := make(map[byte]bool, len(active))
+	for _, f := range active {
+		if sentContext[f.contextID] {
+			remaining = append(remaining, f)
+			continue
+		}
+		sentContext[f.contextID] = true
+		item, done := f.next()
+		sendPDU(sm, &P_DATA_TF{Items: []PresentationDataValueItem{item}})
+		if !done {
+			remaining = append(remaining, f)
+		}
 	}
-	return pdus
+	return remaining
 }
 
 // Data transfer related actions
 var actionDt1 = &stateAction{"DT-1", "Send P-DATA-TF PDU",
 	func(sm *stateMachine, event stateEvent) *stateType {
-		doassert(event.dataPayload != nil)
-		pdus := splitDataIntoPDUs(sm, event.dataPayload.abstractSyntaxName, event.dataPayload.command, event.dataPayload.data)
-		for _, pdu := range pdus {
-			sendPDU(sm, &pdu)
+		startPDVReadTimer(sm)
+		if event.dataPayload != nil {
+			fragmenter, err := newPDVFragmenter(sm, event.dataPayload)
+			if err != nil {
+				sm.logger.Error("Failed to prepare P-DATA-TF payload", "err", err)
+				return actionAa8.Callback(sm, event)
+			}
+			sm.activeFragmenters = append(sm.activeFragmenters, fragmenter)
+		}
+		sm.activeFragmenters = sendOneRound(sm, sm.activeFragmenters)
+		if len(sm.activeFragmenters) > 0 {
+			// Other in-flight sends still have fragments left; re-enqueue
+			// ourselves so they get their next turn interleaved with
+			// whatever real sends arrive meanwhile, instead of draining
+			// this round's fragmenters to completion before anything else
+			// gets a chance to run.
+			sm.downcallCh <- stateEvent{event: evt09}
 		}
 		return sta06
 	}}
 
 var actionDt2 = &stateAction{"DT-2", "Send P-DATA indication primitive",
 	func(sm *stateMachine, event stateEvent) *stateType {
-		abstractSyntaxUID, transferSyntaxUID, command, data, err := addPDataTF(&sm.commandAssembler, event.pdu.(*P_DATA_TF), sm.contextManager)
+		startPDVReadTimer(sm)
+		pdu := event.pdu.(*P_DATA_TF)
+		var contextID byte
+		if len(pdu.Items) > 0 {
+			contextID = pdu.Items[0].ContextID
+		}
+		assembler, ok := sm.commandAssemblers[contextID]
+		if !ok {
+			assembler = &dimseCommandAssembler{}
+			sm.commandAssemblers[contextID] = assembler
+		}
+		var streamStatus *dimse.Status
+		abstractSyntaxUID, transferSyntaxUID, command, data, err := addPDataTF(
+			assembler, pdu, sm.contextManager,
+			newCStoreStreamDataSink(sm, contextID, &streamStatus))
 		if err == nil {
 			if command != nil {
+				delete(sm.commandAssemblers, contextID)
+				messageID, _ := dimseMessageID(command)
+				eventType := upcallEventData
+				if status, ok := dimsePendingStatus(command); ok && status == dimse.StatusPending {
+					eventType = upcallEventSubOpProgress
+				}
 				sm.upcallCh <- upcallEvent{
-					eventType:         upcallEventData,
+					eventType:         eventType,
 					abstractSyntaxUID: abstractSyntaxUID,
 					transferSyntaxUID: transferSyntaxUID,
 					command:           command,
-					data:              data}
+					data:              data,
+					streamStatus:      streamStatus,
+					messageID:         messageID}
 			} else {
 				// Not all fragments received yet
 			}
 			return sta06
 		} else {
-			glog.Infof("%s: Failed to assemble data: %v", sm.name, err) // TODO(saito)
+			sm.logger.Info("Failed to assemble data", "err", err)
 			return actionAa8.Callback(sm, event)
 		}
 	}}
 
+// newCStoreStreamDataSink returns the streamDataSink addPDataTF should use
+// for the provider side of a connection when ServiceProviderParams.CStoreStream
+// is configured: it recognizes a C-STORE-RQ command, pipes its data-set bytes
+// to CStoreStream as they arrive, and stores the callback's result through
+// *result once the pipe is drained. Returns nil (no streaming) for the
+// ServiceUser side, or when CStoreStream isn't set. contextID identifies
+// which presentation context (see stateMachine.commandAssemblers) this
+// command arrived on, for looking up its negotiated transfer syntax.
+func newCStoreStreamDataSink(sm *stateMachine, contextID byte, result **dimse.Status) streamDataSink {
+	if sm.isUser || sm.providerParams.CStoreStream == nil {
+		return nil
+	}
+	return func(command DIMSEMessage) (io.WriteCloser, bool) {
+		rq, ok := command.(*C_STORE_RQ)
+		if !ok {
+			return nil, false
+		}
+		meta := CStoreMeta{
+			SOPClassUID:    rq.AffectedSOPClassUID,
+			SOPInstanceUID: rq.AffectedSOPInstanceUID,
+		}
+		if context, err := sm.contextManager.lookupByContextID(contextID); err == nil {
+			meta.TransferSyntaxUID = context.transferSyntaxUID
+		}
+		pr, pw := io.Pipe()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			status := sm.providerParams.CStoreStream(context.Background(), meta, pr)
+			pr.CloseWithError(nil)
+			*result = &status
+		}()
+		return &joinOnCloseWriter{WriteCloser: pw, done: done}, true
+	}
+}
+
+// joinOnCloseWriter wraps an io.Pipe's write side so that Close() -- called
+// by addPDataTF as soon as the last data fragment has been written -- blocks
+// until the reader goroutine (running the CStoreStreamCallback) has actually
+// finished consuming the pipe and recorded its result. This keeps
+// addPDataTF's return synchronous, same as the non-streaming path.
+type joinOnCloseWriter struct {
+	io.WriteCloser
+	done chan struct{}
+}
+
+func (w *joinOnCloseWriter) Close() error {
+	err := w.WriteCloser.Close()
+	<-w.done
+	return err
+}
+
 // Assocation Release related actions
 var actionAr1 = &stateAction{"AR-1", "Send A-RELEASE-RQ PDU",
 	func(sm *stateMachine, event stateEvent) *stateType {
+		stopTimer(sm) // Sta07 doesn't use the Sta06 PDV-read-idle timer.
 		sendPDU(sm, &A_RELEASE_RQ{})
 		return sta07
 	}}
 var actionAr2 = &stateAction{"AR-2", "Issue A-RELEASE indication primitive",
 	func(sm *stateMachine, event stateEvent) *stateType {
+		stopTimer(sm) // Sta08 doesn't use the Sta06 PDV-read-idle timer.
 		// TODO(saito) Do RELEASE callback here.
 		sm.downcallCh <- stateEvent{event: evt14}
 		return sta08
@@ -336,7 +530,11 @@ var actionAr2 = &stateAction{"AR-2", "Issue A-RELEASE indication primitive",
 var actionAr3 = &stateAction{"AR-3", "Issue A-RELEASE confirmation primitive and close transport connection",
 	func(sm *stateMachine, event stateEvent) *stateType {
 		sendPDU(sm, &A_RELEASE_RP{})
-		closeConnection(sm)
+		established := sm.announcedEstablished
+		closeConnection(sm, nil)
+		if established && sm.contextManager.associationEvents.OnAssociateRelease != nil {
+			sm.contextManager.associationEvents.OnAssociateRelease()
+		}
 		return sta01
 	}}
 var actionAr4 = &stateAction{"AR-4", "Issue A-RELEASE-RP PDU and start ARTIM timer",
@@ -360,9 +558,17 @@ var actionAr6 = &stateAction{"AR-6", "Issue P-DATA indication",
 var actionAr7 = &stateAction{"AR-7", "Issue P-DATA-TF PDU",
 	func(sm *stateMachine, event stateEvent) *stateType {
 		doassert(event.dataPayload != nil)
-		pdus := splitDataIntoPDUs(sm, event.dataPayload.abstractSyntaxName, event.dataPayload.command, event.dataPayload.data)
-		for _, pdu := range pdus {
-			sendPDU(sm, &pdu)
+		f, err := newPDVFragmenter(sm, event.dataPayload)
+		if err != nil {
+			sm.logger.Error("Failed to prepare P-DATA-TF payload", "err", err)
+			return actionAa8.Callback(sm, event)
+		}
+		for {
+			item, done := f.next()
+			sendPDU(sm, &P_DATA_TF{Items: []PresentationDataValueItem{item}})
+			if done {
+				break
+			}
 		}
 		sm.downcallCh <- stateEvent{event: evt14}
 		return sta08
@@ -403,13 +609,18 @@ var actionAa1 = &stateAction{"AA-1", "Send A-ABORT PDU (service-user source) and
 var actionAa2 = &stateAction{"AA-2", "Stop ARTIM timer if running. Close transport connection",
 	func(sm *stateMachine, event stateEvent) *stateType {
 		stopTimer(sm)
-		closeConnection(sm)
+		closeConnection(sm, event.err)
 		return sta01
 	}}
 
 var actionAa3 = &stateAction{"AA-3", "If (service-user initiated abort): issue A-ABORT indication and close transport connection, otherwise (service-dul initiated abort): issue A-P-ABORT indication and close transport connection",
 	func(sm *stateMachine, event stateEvent) *stateType {
-		closeConnection(sm)
+		established := sm.announcedEstablished
+		abortPDU, _ := event.pdu.(*A_ABORT)
+		closeConnection(sm, event.err)
+		if established && abortPDU != nil && sm.contextManager.associationEvents.OnAssociateAbort != nil {
+			sm.contextManager.associationEvents.OnAssociateAbort(abortPDU.Source, abortPDU.Reason)
+		}
 		return sta01
 	}}
 
@@ -445,6 +656,18 @@ var actionAa8 = &stateAction{"AA-8", "Send A-ABORT PDU (service-dul source), iss
 var (
 	upcallEventHandshakeCompleted = eventType{100, "Handshake completed"}
 	upcallEventData               = eventType{101, "P_DATA_TF PDU received"}
+	// upcallEventSubOpProgress is upcallEventData's non-terminal sibling:
+	// actionDt2 emits it instead for a response that carries PS3.7
+	// C.1.1's intermediate "pending" status (0xFF00) -- C-FIND-RSP,
+	// C-MOVE-RSP, C-GET-RSP -- so a caller streaming sub-operation
+	// progress can tell it apart from the final response without
+	// inspecting event.command's status itself.
+	upcallEventSubOpProgress = eventType{102, "Sub-operation progress"}
+	// upcallEventCancelled is pushed onto a serviceCommandState's upcallCh
+	// by (*ServiceUser).Cancel, to wake up a goroutine blocked waiting on
+	// that command's response (e.g. CFindContext's loop) instead of
+	// leaving it to hang until ctx.Done() or the connection closes.
+	upcallEventCancelled = eventType{103, "Command cancelled"}
 	// Note: connection shutdown and any error will result in channel
 	// closure, so they don't have event types.
 )
@@ -461,6 +684,19 @@ type upcallEvent struct {
 
 	command DIMSEMessage
 	data    []byte
+
+	// messageID is command's DIMSE MessageID (a request) or
+	// MessageIDBeingRespondedTo (a response), set for upcallEventData and
+	// upcallEventSubOpProgress; for upcallEventCancelled it names the
+	// canceled command. See stateEventDataPayload.messageID.
+	messageID uint16
+
+	// streamStatus is set iff command's data-set was handled by a
+	// CStoreStreamCallback (see ServiceProviderParams.CStoreStream)
+	// rather than buffered into data: it carries the callback's result,
+	// since by the time this event is emitted the callback has already
+	// run to completion.
+	streamStatus *dimse.Status
 }
 
 type stateEventDataPayload struct {
@@ -473,6 +709,13 @@ type stateEventDataPayload struct {
 	// Data to send. len(data) may exceed the max PDU size, in which case it
 	// will be split into multiple PresentationDataValueItems.
 	data []byte
+
+	// messageID identifies which invocation this payload belongs to (the
+	// DIMSE MessageID for a request, or MessageIDBeingRespondedTo for a
+	// response), so that with MaxOpsInvoked/MaxOpsPerformed > 1 a reply
+	// arriving while several commands are in flight on the same
+	// association can still be matched back to its invocation.
+	messageID uint16
 }
 
 type stateEventDebugInfo struct {
@@ -552,6 +795,10 @@ var stateTransitions = []stateTransition{
 	stateTransition{sta06, evt11, actionAr1},
 	stateTransition{sta06, evt12, actionAr2},
 	stateTransition{sta06, evt13, actionAa8},
+	// PDV-read-idle timeout (ServiceUserParams/ServiceProviderParams.
+	// PDVReadTimeout), armed by startPDVReadTimer -- see actionAe3/actionAe7/
+	// actionDt1/actionDt2.
+	stateTransition{sta06, evt18, actionAa1},
 	stateTransition{sta06, evt15, actionAa1},
 	stateTransition{sta06, evt16, actionAa3},
 	stateTransition{sta06, evt17, actionAa4},
@@ -652,6 +899,15 @@ type stateMachine struct {
 	userParams     ServiceUserParams
 	providerParams ServiceProviderParams
 
+	// ctx bounds the association's lifetime; ctxDone is its Done() channel,
+	// cached here since ctx.Done() is read on every getNextEvent call. On
+	// firing, getNextEvent synthesizes an A-ABORT (evt15) and then nils
+	// ctxDone so the now-permanently-closed channel doesn't spin the
+	// select loop. See runStateMachineForServiceUser/
+	// runStateMachineForServiceProvider for who actually supplies ctx.
+	ctx     context.Context
+	ctxDone <-chan struct{}
+
 	// abstractSyntaxMap maps a contextID (an odd integer) to an abstract
 	// syntax string such as 1.2.840.10008.5.1.4.1.1.1.2.  This field is set
 	// on receiving A_ASSOCIATE_RQ message. Thus, it is set only on the
@@ -680,50 +936,167 @@ type stateMachine struct {
 	conn         net.Conn
 	currentState *stateType
 
+	// channel frames PDUs over conn; it is (re)built by channelFactory
+	// whenever conn is set (see getNextEvent's evt02 case and
+	// runStateMachineForServiceProvider). sendPDU and networkReaderThread
+	// read/write through it instead of conn directly, so that a
+	// ServiceUserParams.ChannelFactory/ServiceProviderParams.ChannelFactory
+	// test double is exercised the same way a real socket would be. conn
+	// itself is kept around for APIs that need the raw connection, e.g.
+	// authorizeAssociateRequest's *tls.Conn peer-certificate check.
+	channel        PDUChannel
+	channelFactory PDUChannelFactory
+
 	// The negotiated PDU size.
 	maxPDUSize int
 
-	commandAssembler dimseCommandAssembler
-	faults           *FaultInjector
+	// commandAssemblers holds one dimseCommandAssembler per presentation
+	// context ID currently mid-assembly. Keying by context ID (rather than
+	// a single shared dimseCommandAssembler) is what lets an Asynchronous
+	// Operations Window > 1 peer (see ServiceUserParams/
+	// ServiceProviderParams.MaxOpsInvoked) pipeline more than one
+	// outstanding command down the same association: each presentation
+	// context gets its own independent command+data-set reassembly state,
+	// instead of a second context's P_DATA_TF fragments erroring out as
+	// "Mixed context" against whatever the first context was assembling.
+	//
+	// Entries are created on first use and removed by actionDt2 once
+	// addPDataTF reports the command complete. This does not demux two
+	// commands interleaved on the SAME context ID -- PS3.8 framing gives no
+	// way to tell them apart below the DIMSE layer, since MessageID lives
+	// inside the not-yet-decoded command bytes -- so a peer that wants true
+	// concurrency needs a presentation context (or association) per
+	// in-flight command, same as this package's own cstoreAssociationPool
+	// does for concurrent outbound C-STORE.
+	commandAssemblers map[byte]*dimseCommandAssembler
+	faults            *FaultInjector
+
+	// activeFragmenters holds one pdvFragmenter per send that actionDt1 has
+	// started but not yet finished. sendOneRound round-robins one PDV from
+	// each distinct presentation context represented here per invocation
+	// rather than draining a single one to completion, so a large C-STORE
+	// and a concurrently in-flight C-FIND response on a different context
+	// (each running in its own command goroutine, per MaxOpsInvoked/
+	// MaxOpsPerformed) interleave their P_DATA_TF fragments on the wire
+	// instead of one blocking the other. Fragmenters sharing a context are
+	// never interleaved with each other -- see sendOneRound.
+	activeFragmenters []*pdvFragmenter
+
+	// telemetry records PDU byte counts and state transitions, if the
+	// user/providerParams' Instrumentation is configured. Never nil; see
+	// newDICOMTelemetry.
+	telemetry *dicomTelemetry
+
+	// logger receives this statemachine's own diagnostic output (PDU
+	// send/receive, state transitions). Never nil; defaults to
+	// VLogLogger(), overridden by ServiceUserParams.Logger/
+	// ServiceProviderParams.Logger in runStateMachineForServiceUser/
+	// runStateMachineForServiceProvider -- the same value as
+	// contextManager.logger, kept as its own field here so sendPDU/
+	// runOneStep/etc. don't have to reach through sm.contextManager for it.
+	logger Logger
+
+	// announcedEstablished is set once actionAe3/actionAe7 has notified
+	// telemetry.observeAssociationEstablished, and cleared by
+	// closeConnection once it has correspondingly notified
+	// observeAssociationClosed. It guards against firing
+	// Observer.OnAssociationClosed for an association that never
+	// completed its handshake (e.g. a rejected A-ASSOCIATE-RQ), which
+	// never fired OnAssociationEstablished either.
+	announcedEstablished bool
 }
 
-func closeConnection(sm *stateMachine) {
+// closeConnection tears down sm's transport connection. cause is nil for a
+// clean release and the error that triggered the abort otherwise; it's only
+// ever surfaced via Observer.OnAssociationClosed, and only if the
+// association actually completed its handshake (sm.announcedEstablished),
+// since an association rejected before Sta06 never fired
+// OnAssociationEstablished in the first place.
+func closeConnection(sm *stateMachine, cause error) {
 	close(sm.upcallCh)
-	glog.Infof("%s: Closing connection %v", sm.name, sm.conn)
-	sm.conn.Close()
+	sm.logger.Debug("Closing connection", "conn", sm.conn)
+	sm.channel.Close()
+	if sm.announcedEstablished {
+		sm.telemetry.observeAssociationClosed(cause)
+		sm.announcedEstablished = false
+	}
 }
 
 func sendPDU(sm *stateMachine, pdu PDU) {
-	doassert(sm.conn != nil)
+	doassert(sm.channel != nil)
+	start := time.Now()
 	data, err := EncodePDU(pdu)
 	if err != nil {
-		glog.Infof("%s: Failed to encode: %v; closing connection %v", sm.name, err, sm.conn)
-		sm.conn.Close()
+		sm.logger.Info("Failed to encode; closing connection", "conn", sm.conn, "err", err)
+		sm.channel.Close()
 		sm.errorCh <- stateEvent{event: evt17, err: err}
 		return
 	}
 	if sm.faults != nil {
+		if sm.faults.pending != nil {
+			switch sm.faults.pending.Do.Op {
+			case FaultActionDrop:
+				sm.logger.Info("FAULT: dropping PDU per scenario rule", "pdu_type", fmt.Sprintf("%T", pdu))
+				return
+			case FaultActionCorrupt:
+				data[len(data)-1] ^= 0xff
+			}
+		}
 		action := sm.faults.onSend(data)
 		if action == faultInjectorDisconnect {
-			glog.Infof("%s: FAULT: closing connection for test", sm.name)
-			sm.conn.Close()
+			sm.logger.Info("FAULT: closing connection for test")
+			sm.channel.Close()
 		}
 	}
-	n, err := sm.conn.Write(data)
-	if n != len(data) || err != nil {
-		glog.Infof("%s: Failed to write %d bytes. Actual %d bytes : %v; closing connection %v", sm.name, len(data), n, err, sm.conn)
-		sm.conn.Close()
+	// WriteRaw, not WritePDU, so that the onSend/FaultActionCorrupt
+	// mutations applied to data above actually reach the wire instead of
+	// being discarded when WritePDU re-encodes pdu from scratch.
+	if err := sm.channel.WriteRaw(context.Background(), data); err != nil {
+		sm.logger.Info("Failed to write; closing connection", "bytes", len(data), "conn", sm.conn, "err", err)
+		sm.channel.Close()
 		sm.errorCh <- stateEvent{event: evt17, err: err}
 		return
 	}
-	// glog.Infof("%s: sendPDU: %v", sm.name, pdu.String())
+	sm.telemetry.recordPDUBytesSent(context.Background(), fmt.Sprintf("%T", pdu), len(data), time.Since(start))
 }
 
+// artimTimeout is the DUL ARTIM timer delay (PS3.8 9.1.5) for sm's side of
+// the association: ServiceUserParams.ARTIMTimeout or
+// ServiceProviderParams.ARTIMTimeout, as appropriate.
+func artimTimeout(sm *stateMachine) time.Duration {
+	if sm.isUser {
+		return sm.userParams.ARTIMTimeout
+	}
+	return sm.providerParams.ARTIMTimeout
+}
+
+// startTimer arms the ARTIM timer (PS3.8 9.1.5): most states that start or
+// restart it (Sta02 awaiting the A-ASSOCIATE-RQ, Sta13 awaiting transport
+// close after a reject, release or abort) are waiting on the DUL-defined ARTIM delay, not the
+// association-request-specific one actionAe2 uses -- see
+// startAssociateTimer.
 func startTimer(sm *stateMachine) {
+	startTimerWithDelay(sm, artimTimeout(sm))
+}
+
+// startAssociateTimer arms the timer actionAe2 starts after sending
+// A-ASSOCIATE-RQ, bounded by ServiceUserParams.AssociateTimeout rather than
+// the ARTIM timer -- PS3.8 doesn't actually name this wait separately from
+// ARTIM, but callers may reasonably want a different (e.g. longer) bound for
+// a peer that's slow to respond to association requests than for the
+// post-teardown ARTIM wait.
+func startAssociateTimer(sm *stateMachine) {
+	startTimerWithDelay(sm, sm.userParams.AssociateTimeout)
+}
+
+func startTimerWithDelay(sm *stateMachine, delay time.Duration) {
+	if sm.faults != nil && sm.faults.pending != nil && sm.faults.pending.Do.Op == FaultActionDelay {
+		delay += time.Duration(sm.faults.pending.Do.DelayMillis) * time.Millisecond
+	}
 	ch := make(chan stateEvent, 1)
 	sm.timerCh = ch
 	currentState := sm.currentState
-	time.AfterFunc(time.Duration(10)*time.Second,
+	time.AfterFunc(delay,
 		func() {
 			ch <- stateEvent{event: evt18, debug: &stateEventDebugInfo{currentState}}
 			close(ch)
@@ -734,17 +1107,50 @@ func restartTimer(sm *stateMachine) {
 	startTimer(sm)
 }
 
+// pdvReadTimeout is ServiceUserParams.PDVReadTimeout or
+// ServiceProviderParams.PDVReadTimeout, as appropriate for sm's side of the
+// association.
+func pdvReadTimeout(sm *stateMachine) time.Duration {
+	if sm.isUser {
+		return sm.userParams.PDVReadTimeout
+	}
+	return sm.providerParams.PDVReadTimeout
+}
+
+// startPDVReadTimer arms (or, called again, restarts) the idle-read timer
+// for Sta06 if pdvReadTimeout is configured nonzero: actionAe3/actionAe7 call
+// it on entering Sta06, and actionDt1/actionDt2 call it again on every send
+// or receive, so the timer only fires evt18 after PDVReadTimeout has elapsed
+// with no P-DATA-TF activity in either direction -- not PDVReadTimeout after
+// association establishment regardless of traffic.
+func startPDVReadTimer(sm *stateMachine) {
+	if d := pdvReadTimeout(sm); d > 0 {
+		startTimerWithDelay(sm, d)
+	}
+}
+
 func stopTimer(sm *stateMachine) {
 	sm.timerCh = make(chan stateEvent, 1)
 }
 
-func networkReaderThread(ch chan stateEvent, conn net.Conn, maxPDUSize int, smName string) {
-	glog.V(1).Infof("%s: Starting network reader for %v, maxPDU %d", smName, conn, maxPDUSize)
-	doassert(maxPDUSize > 16*1024)
+func networkReaderThread(ch chan stateEvent, channel PDUChannel, smName string, telemetry *dicomTelemetry, logger Logger) {
+	logger.Debug("Starting network reader", "sm", smName, "max_pdu_size", channel.MaxPDUSize())
+	doassert(channel.MaxPDUSize() > 16*1024)
 	for {
-		pdu, err := ReadPDU(conn, maxPDUSize)
+		pdu, err := channel.ReadPDU(context.Background())
+		if err == nil {
+			// PDUChannel hides the raw byte count behind ReadPDU, so this
+			// re-encodes the already-decoded PDU to recover it for
+			// telemetry; a custom PDUChannel backed by something other
+			// than a byte stream (e.g. a test double) will still report
+			// a reasonable approximation since wire size is determined
+			// by PDU content, not transport.
+			if data, encErr := EncodePDU(pdu); encErr == nil {
+				telemetry.recordPDUBytesReceived(context.Background(), fmt.Sprintf("%T", pdu), len(data))
+			}
+		}
 		if err != nil {
-			glog.Infof("%s: Failed to read PDU: %v", err, smName)
+			logger.Info("Failed to read PDU", "sm", smName, "err", err)
 			if err == io.EOF {
 				ch <- stateEvent{event: evt17, pdu: nil, err: nil}
 			} else {
@@ -755,7 +1161,7 @@ func networkReaderThread(ch chan stateEvent, conn net.Conn, maxPDUSize int, smNa
 		}
 		doassert(pdu != nil)
 		switch n := pdu.(type) {
-			case *A_ASSOCIATE:
+		case *A_ASSOCIATE:
 			if n.Type == PDUTypeA_ASSOCIATE_RQ {
 				ch <- stateEvent{event: evt06, pdu: n, err: nil}
 			} else {
@@ -781,11 +1187,11 @@ func networkReaderThread(ch chan stateEvent, conn net.Conn, maxPDUSize int, smNa
 		default:
 			err := fmt.Errorf("%s: Unknown PDU type: %v", pdu.String(), smName)
 			ch <- stateEvent{event: evt19, pdu: pdu, err: err}
-			glog.Error(err)
+			logger.Error("Unknown PDU type", "err", err)
 			continue
 		}
 	}
-	glog.V(1).Infof("%s: Exiting network reader for %v", conn, smName)
+	logger.Debug("Exiting network reader", "sm", smName)
 }
 
 func getNextEvent(sm *stateMachine) stateEvent {
@@ -812,16 +1218,30 @@ func getNextEvent(sm *stateMachine) stateEvent {
 			if !ok {
 				sm.downcallCh = nil
 			}
+		case <-sm.ctxDone:
+			channel = "ctx"
+			// A-ABORT request primitive (evt15) has a transition defined
+			// for every state from sta03 through sta13, so it's the right
+			// event to synthesize regardless of which of those
+			// sm.currentState happens to be. sta02 (a provider awaiting
+			// A-ASSOCIATE-RQ) has none; there runOneStep's no-transition
+			// fallback turns it into evt19, which aborts via AA-1. Clear ctxDone so the now-permanently-closed
+			// channel doesn't keep winning every subsequent select.
+			event = stateEvent{event: evt15, err: sm.ctx.Err()}
+			sm.ctxDone = nil
 		}
 	}
-	if event.event.Event == 0 {
-		glog.Fatalf("%s: received null event from channel '%s', sm: %v",
-			sm.name, channel, sm)
-	}
+	doassert(event.event.Event != 0)
+	sm.logger.Debug("Received event", "channel", channel, "event", event.event)
 	switch event.event {
 	case evt02:
 		doassert(event.conn != nil)
 		sm.conn = event.conn
+		factory := sm.channelFactory
+		if factory == nil {
+			factory = NewPDUChannel
+		}
+		sm.channel = factory(event.conn)
 	case evt17:
 		close(sm.upcallCh)
 		sm.conn = nil
@@ -842,28 +1262,50 @@ const DefaultMaximiumPDUSize = uint32(1 << 20)
 
 func runOneStep(sm *stateMachine) {
 	event := getNextEvent(sm)
-	glog.V(1).Infof("%s: Current state: %v, Event %v", sm.name, sm.currentState, event)
+	if sm.faults != nil {
+		event, sm.faults.pending = sm.faults.apply(sm.currentState, event)
+	}
+	sm.logger.Debug("Current state", "state", sm.currentState, "event", event)
 	action := findAction(sm.currentState, &event, sm.name)
 	if action == nil {
-		msg := fmt.Sprintf("%s: No action found for state %v, event %v", sm.name, sm.currentState, event.String())
+		msg := fmt.Sprintf("no action found for state %v, event %v", sm.currentState, event.String())
 		if sm.faults != nil {
 			msg += " FIhistory: " + sm.faults.String()
 		}
-		glog.Infof("Unknown state transition:")
-		for _, s := range strings.Split(msg, "\n") {
-			glog.Infof(s)
-		}
-		glog.Fatalf(msg)
+		// A bad or non-conformant peer can drive the state machine into a
+		// (state, event) pair with no defined transition (PS3.8 9.2.3 only
+		// specifies the combinations listed in stateTransitions); this used
+		// to glog.Fatalf, which would take down the whole host process over
+		// a single misbehaving association. Route it through evt19 instead,
+		// the same "unrecognized or invalid PDU" event every state from
+		// Sta02 on except Sta04 has an abort transition for, so the
+		// offending association gets torn down instead of the process.
+		sm.logger.Error("Unknown state transition", "err", msg)
+		sm.errorCh <- stateEvent{event: evt19, err: fmt.Errorf("%s: %s", sm.name, msg)}
+		return
 	}
 	if sm.faults != nil {
 		sm.faults.onStateTransition(sm.currentState, &event, action)
 	}
-	glog.V(1).Infof("%s: Running action %v", sm.name, action)
+	sm.logger.Debug("Running action", "action", action)
+	fromState := sm.currentState
 	sm.currentState = action.Callback(sm, event)
-	glog.V(1).Infof("Next state: %v", sm.currentState)
+	sm.logger.Debug("Next state", "state", sm.currentState)
+	sm.telemetry.recordStateTransition(context.Background(), fromState.Name, sm.currentState.Name, event.event.Description, action.Name)
 }
 
+// runStateMachineForServiceUser drives the user-side (client) state machine
+// until the association fully tears down. ctx bounds its whole lifetime:
+// getNextEvent selects on ctx.Done() and synthesizes an A-ABORT (evt15) if it
+// fires before the association would otherwise end. Note that, as called
+// from NewServiceUser today, ctx is always context.Background() -- the
+// statemachine goroutine starts before Connect/ConnectContext's caller-
+// supplied ctx is known, so per-call cancellation instead reaches the
+// association via the downcallCh-based watcher AssociateContext/
+// ShutdownContext already use (evt11/evt15). ctx.Done() here mainly serves
+// RunProviderForConnContext, where the real ctx is available up front.
 func runStateMachineForServiceUser(
+	ctx context.Context,
 	serverAddr string,
 	params ServiceUserParams,
 	upcallCh chan upcallEvent,
@@ -873,47 +1315,112 @@ func runStateMachineForServiceUser(
 	doassert(len(params.RequiredServices) > 0)
 	doassert(len(params.SupportedTransferSyntaxes) > 0)
 	sm := &stateMachine{
-		name:           fmt.Sprintf("sm(u)-%d", atomic.AddInt32(&smSeq, 1)),
-		isUser:         true,
-		contextManager: newContextManager(),
-		userParams:     params,
-		netCh:          make(chan stateEvent, 128),
-		errorCh:        make(chan stateEvent, 128),
-		downcallCh:     downcallCh,
-		upcallCh:       upcallCh,
-		faults:         GetUserFaultInjector(),
+		name:              fmt.Sprintf("sm(u)-%d", atomic.AddInt32(&smSeq, 1)),
+		isUser:            true,
+		contextManager:    newContextManager(),
+		userParams:        params,
+		channelFactory:    params.ChannelFactory,
+		netCh:             make(chan stateEvent, 128),
+		errorCh:           make(chan stateEvent, 128),
+		downcallCh:        downcallCh,
+		upcallCh:          upcallCh,
+		faults:            GetUserFaultInjector(),
+		telemetry:         newDICOMTelemetry(params.Instrumentation, params.Observer),
+		commandAssemblers: make(map[byte]*dimseCommandAssembler),
+		logger:            VLogLogger(),
+		ctx:               ctx,
+		ctxDone:           ctx.Done(),
+	}
+	if params.TransferSyntaxPolicy != nil {
+		sm.contextManager.transferSyntaxPolicy = params.TransferSyntaxPolicy
 	}
+	if params.Logger != nil {
+		sm.contextManager.logger = params.Logger
+		sm.logger = params.Logger
+	}
+	sm.contextManager.localWireCompression = params.WireCompression
 	event := stateEvent{event: evt01, serverAddr: serverAddr}
 	action := findAction(sta01, &event, sm.name)
 	sm.currentState = action.Callback(sm, event)
 	for sm.currentState != sta01 {
 		runOneStep(sm)
 	}
-	glog.V(1).Info("Connection shutdown")
+	sm.logger.Debug("Connection shutdown")
+}
+
+// callerIPFromAddr extracts the host portion of addr, for
+// contextManager.callerIP. Falls back to addr's full String() if it isn't a
+// host:port pair (e.g. some net.Conn implementations used in tests).
+func callerIPFromAddr(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
 }
 
+// runStateMachineForServiceProvider drives the provider-side state machine
+// for one accepted connection until the association fully tears down. See
+// runStateMachineForServiceUser's ctx comment; RunProviderForConnContext
+// supplies a real ctx up front, so ctx.Done()-triggered abort (evt15) works
+// for the full lifetime of this association, not just after handshake.
 func runStateMachineForServiceProvider(
+	ctx context.Context,
 	conn net.Conn,
 	params ServiceProviderParams,
 	upcallCh chan upcallEvent,
 	downcallCh chan stateEvent) {
+	channelFactory := params.ChannelFactory
+	if channelFactory == nil {
+		channelFactory = NewPDUChannel
+	}
 	sm := &stateMachine{
-		name:           fmt.Sprintf("sm(p)-%d", atomic.AddInt32(&smSeq, 1)),
-		isUser:         false,
-		providerParams: params,
-		contextManager: newContextManager(),
-		conn:           conn,
-		netCh:          make(chan stateEvent, 128),
-		errorCh:        make(chan stateEvent, 128),
-		downcallCh:     downcallCh,
-		upcallCh:       upcallCh,
-		faults:         GetProviderFaultInjector(),
+		name:              fmt.Sprintf("sm(p)-%d", atomic.AddInt32(&smSeq, 1)),
+		isUser:            false,
+		ctx:               ctx,
+		ctxDone:           ctx.Done(),
+		providerParams:    params,
+		contextManager:    newContextManager(),
+		conn:              conn,
+		channel:           channelFactory(conn),
+		channelFactory:    channelFactory,
+		netCh:             make(chan stateEvent, 128),
+		errorCh:           make(chan stateEvent, 128),
+		downcallCh:        downcallCh,
+		upcallCh:          upcallCh,
+		faults:            GetProviderFaultInjector(),
+		telemetry:         newDICOMTelemetry(params.Instrumentation, params.Observer),
+		commandAssemblers: make(map[byte]*dimseCommandAssembler),
+		logger:            VLogLogger(),
+	}
+	sm.contextManager.authenticator = params.Authenticator
+	sm.contextManager.acceptUnknownSOPClasses = params.AcceptUnknownSOPClasses
+	sm.contextManager.acceptUnknownSOPClassesFilter = params.AcceptUnknownSOPClassesFilter
+	sm.contextManager.localRoleSelection = params.RoleSelection
+	sm.contextManager.negotiationPolicy = params.NegotiationPolicy
+	sm.contextManager.associationEvents = params.AssociationEvents
+	if conn != nil {
+		sm.contextManager.callerIP = callerIPFromAddr(conn.RemoteAddr())
+	}
+	if params.TransferSyntaxPolicy != nil {
+		sm.contextManager.transferSyntaxPolicy = params.TransferSyntaxPolicy
+	}
+	if params.Logger != nil {
+		sm.contextManager.logger = params.Logger
+		sm.logger = params.Logger
+	}
+	if sm.providerParams.ARTIMTimeout == 0 {
+		sm.providerParams.ARTIMTimeout = defaultARTIMTimeout
 	}
+	sm.contextManager.localWireCompression = params.WireCompression
 	event := stateEvent{event: evt05, conn: conn}
 	action := findAction(sta01, &event, sm.name)
 	sm.currentState = action.Callback(sm, event)
 	for sm.currentState != sta01 {
 		runOneStep(sm)
 	}
-	glog.V(1).Info("Connection shutdown")
+	sm.logger.Debug("Connection shutdown")
 }
@@ -0,0 +1,411 @@
+package netdicom
+
+// This file wires optional OpenTelemetry tracing and metrics into
+// ServiceProvider and ServiceUser. Nothing here is required: a
+// dicomTelemetry built from the zero value of Instrumentation (the value
+// returned by newDICOMTelemetry(Instrumentation{}, nil)) is a complete no-op, so
+// existing callers that don't set ServiceProviderParams.Instrumentation or
+// the ServiceUserParams equivalent are unaffected.
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/yasushi-saito/go-netdicom/dimse"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"v.io/x/lib/vlog"
+)
+
+// instrumentationName is the OpenTelemetry instrumentation scope name used
+// for both the tracer and the meter.
+const instrumentationName = "github.com/yasushi-saito/go-netdicom"
+
+// Instrumentation bundles the OpenTelemetry providers ServiceProviderParams
+// and ServiceUserParams accept to enable tracing and metrics. Either field
+// may be left nil, in which case the corresponding instrumentation is a
+// no-op; the zero value of Instrumentation disables both.
+type Instrumentation struct {
+	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
+}
+
+// dicomTelemetry bundles the span/metric plumbing shared by ServiceProvider
+// and ServiceUser (both ultimately run commands through serviceDispatcher).
+type dicomTelemetry struct {
+	tracer trace.Tracer
+	meter  metric.Meter
+
+	commandsTotal    metric.Int64Counter
+	commandDuration  metric.Float64Histogram
+	associations     metric.Int64UpDownCounter
+	commandsActive   metric.Int64UpDownCounter
+	pduBytesSent     metric.Int64Counter
+	pduBytesReceived metric.Int64Counter
+	stateTransitions metric.Int64Counter
+
+	// observer, if non-nil, is driven alongside the OpenTelemetry
+	// instruments above by the same call sites; see ServiceUserParams.
+	// Observer / ServiceProviderParams.Observer and the Observer interface
+	// doc comment for why this exists as a separate, OpenTelemetry-free
+	// mechanism.
+	observer Observer
+
+	// associationSpan covers the whole association lifetime, from
+	// startAssociation (the A-ASSOCIATE handshake completing) to
+	// endAssociation (full teardown). Since dicomTelemetry is created fresh
+	// per association (see runStateMachineForServiceProvider/
+	// runStateMachineForServiceUser), this can be a single field rather
+	// than something keyed by association.
+	associationSpan trace.Span
+}
+
+// newDICOMTelemetry creates the instruments for inst.TracerProvider/
+// inst.MeterProvider. Either may be nil, in which case the corresponding
+// instrumentation is skipped. observer may also be nil.
+func newDICOMTelemetry(inst Instrumentation, observer Observer) *dicomTelemetry {
+	t := &dicomTelemetry{observer: observer}
+	if inst.TracerProvider != nil {
+		t.tracer = inst.TracerProvider.Tracer(instrumentationName)
+	}
+	if inst.MeterProvider == nil {
+		return t
+	}
+	t.meter = inst.MeterProvider.Meter(instrumentationName)
+	var err error
+	if t.commandsTotal, err = t.meter.Int64Counter("dicom.commands.total"); err != nil {
+		vlog.Errorf("netdicom: failed to create dicom.commands.total counter: %v", err)
+	}
+	if t.commandDuration, err = t.meter.Float64Histogram("dicom.command.duration_ms"); err != nil {
+		vlog.Errorf("netdicom: failed to create dicom.command.duration_ms histogram: %v", err)
+	}
+	if t.associations, err = t.meter.Int64UpDownCounter("dicom.associations.active"); err != nil {
+		vlog.Errorf("netdicom: failed to create dicom.associations.active gauge: %v", err)
+	}
+	if t.commandsActive, err = t.meter.Int64UpDownCounter("dicom.commands.active"); err != nil {
+		vlog.Errorf("netdicom: failed to create dicom.commands.active gauge: %v", err)
+	}
+	if t.pduBytesSent, err = t.meter.Int64Counter("dicom.pdu.bytes_sent"); err != nil {
+		vlog.Errorf("netdicom: failed to create dicom.pdu.bytes_sent counter: %v", err)
+	}
+	if t.pduBytesReceived, err = t.meter.Int64Counter("dicom.pdu.bytes_received"); err != nil {
+		vlog.Errorf("netdicom: failed to create dicom.pdu.bytes_received counter: %v", err)
+	}
+	if t.stateTransitions, err = t.meter.Int64Counter("dicom.statemachine.transitions"); err != nil {
+		vlog.Errorf("netdicom: failed to create dicom.statemachine.transitions counter: %v", err)
+	}
+	return t
+}
+
+// recordPDUBytesSent records the size of a PDU just written to the wire, and
+// notifies t.observer (if any). It also adds an event to associationSpan (if
+// tracing is configured), since a span per PDU would be too fine-grained to
+// read -- one event per PDU on the enclosing association span is the usual
+// OpenTelemetry idiom for this kind of high-frequency occurrence.
+func (t *dicomTelemetry) recordPDUBytesSent(ctx context.Context, pduType string, n int, dur time.Duration) {
+	if t == nil {
+		return
+	}
+	if t.associationSpan != nil {
+		t.associationSpan.AddEvent("dicom.pdu.sent", trace.WithAttributes(
+			attribute.String("pdu_type", pduType),
+			attribute.Int("pdu_size", n),
+		))
+	}
+	if t.pduBytesSent != nil {
+		t.pduBytesSent.Add(ctx, int64(n))
+	}
+	if t.observer != nil {
+		t.observer.OnPDUSent(pduType, n, dur)
+	}
+}
+
+// recordPDUBytesReceived records the size of a PDU just read off the wire,
+// and notifies t.observer (if any); see recordPDUBytesSent for why this is a
+// span event rather than its own span.
+func (t *dicomTelemetry) recordPDUBytesReceived(ctx context.Context, pduType string, n int) {
+	if t == nil {
+		return
+	}
+	if t.associationSpan != nil {
+		t.associationSpan.AddEvent("dicom.pdu.received", trace.WithAttributes(
+			attribute.String("pdu_type", pduType),
+			attribute.Int("pdu_size", n),
+		))
+	}
+	if t.pduBytesReceived != nil {
+		t.pduBytesReceived.Add(ctx, int64(n))
+	}
+	if t.observer != nil {
+		t.observer.OnPDUReceived(pduType, n)
+	}
+}
+
+// traceParentCarrier adapts a single W3C "traceparent" string to
+// propagation.TextMapCarrier, so propagation.TraceContext can inject/extract
+// it without pulling in HTTP headers -- this package carries the same
+// string inside a pdu.TraceContextSubItem instead (see
+// generateAssociateRequest's traceParent argument and
+// contextManager.peerTraceParent).
+type traceParentCarrier struct{ value string }
+
+func (c *traceParentCarrier) Get(key string) string {
+	if key == "traceparent" {
+		return c.value
+	}
+	return ""
+}
+
+func (c *traceParentCarrier) Set(key, value string) {
+	if key == "traceparent" {
+		c.value = value
+	}
+}
+
+func (c *traceParentCarrier) Keys() []string { return []string{"traceparent"} }
+
+// traceParentFromContext renders ctx's current span context as a W3C
+// traceparent string, for generateAssociateRequest to offer in a
+// pdu.TraceContextSubItem. Returns "" if ctx carries no span (e.g. no
+// Instrumentation.TracerProvider is configured).
+func traceParentFromContext(ctx context.Context) string {
+	var carrier traceParentCarrier
+	propagation.TraceContext{}.Inject(ctx, &carrier)
+	return carrier.value
+}
+
+// contextWithTraceParent returns ctx augmented with the remote span context
+// encoded in traceParent (a W3C traceparent string decoded from a peer's
+// pdu.TraceContextSubItem), so startAssociation's span is a child of the
+// peer's span instead of starting a new, disconnected trace. Returns ctx
+// unchanged if traceParent is "".
+func contextWithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return propagation.TraceContext{}.Extract(ctx, &traceParentCarrier{value: traceParent})
+}
+
+// startAssociation starts associationSpan (if tracing is configured),
+// joining the peer's trace via peerTraceParent when the requestor sent one
+// (see contextWithTraceParent), and tags it with everything
+// OnAssociationEstablished reports plus each negotiated presentation
+// context's abstract/transfer syntax UID and context ID.
+func (t *dicomTelemetry) startAssociation(ctx context.Context, peerAE, peerImplementationClassUID, peerImplementationVersionName, peerTraceParent string, contexts []PresentationContext) {
+	if t == nil || t.tracer == nil {
+		return
+	}
+	ctx = contextWithTraceParent(ctx, peerTraceParent)
+	attrs := []attribute.KeyValue{
+		attribute.String("peer_ae", peerAE),
+		attribute.String("peer_implementation_class_uid", peerImplementationClassUID),
+		attribute.String("peer_implementation_version_name", peerImplementationVersionName),
+	}
+	_, t.associationSpan = t.tracer.Start(ctx, "dicom.association", trace.WithAttributes(attrs...))
+	for _, c := range contexts {
+		t.associationSpan.AddEvent("dicom.presentation_context", trace.WithAttributes(
+			attribute.Int("context_id", int(c.ContextID)),
+			attribute.String("abstract_syntax_uid", c.AbstractSyntaxUID),
+			attribute.String("transfer_syntax_uid", c.TransferSyntaxUID),
+		))
+	}
+}
+
+// endAssociation ends associationSpan (if any), recording cause as a span
+// error when the association didn't close cleanly.
+func (t *dicomTelemetry) endAssociation(cause error) {
+	if t == nil || t.associationSpan == nil {
+		return
+	}
+	if cause != nil {
+		t.associationSpan.RecordError(cause)
+	}
+	t.associationSpan.End()
+	t.associationSpan = nil
+}
+
+// recordStateTransition records one association state-machine transition,
+// tagged with the state it ran from and the action it ran, mirroring what
+// FaultInjector.onStateTransition records for fault-injection tests, and
+// notifies t.observer (if any).
+func (t *dicomTelemetry) recordStateTransition(ctx context.Context, from, to, event, action string) {
+	if t == nil {
+		return
+	}
+	if t.stateTransitions != nil {
+		t.stateTransitions.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("state", from),
+			attribute.String("action", action),
+		))
+	}
+	if t.observer != nil {
+		t.observer.OnStateTransition(from, to, event)
+	}
+}
+
+// observeAssociationEstablished notifies t.observer (if any) that the
+// A-ASSOCIATE handshake completed; see Observer.OnAssociationEstablished.
+// observeAssociationEstablished notifies t.observer (if any) that the
+// A-ASSOCIATE handshake completed, and starts associationSpan (see
+// startAssociation); see Observer.OnAssociationEstablished.
+func (t *dicomTelemetry) observeAssociationEstablished(ctx context.Context, peerAE, peerImplementationClassUID, peerImplementationVersionName, peerTraceParent string, contexts []PresentationContext) {
+	if t == nil {
+		return
+	}
+	t.startAssociation(ctx, peerAE, peerImplementationClassUID, peerImplementationVersionName, peerTraceParent, contexts)
+	if t.observer != nil {
+		t.observer.OnAssociationEstablished(peerAE, contexts)
+	}
+}
+
+// observeAssociationClosed notifies t.observer (if any) that a previously
+// established association has fully torn down, and ends associationSpan
+// (see endAssociation); see Observer.OnAssociationClosed.
+func (t *dicomTelemetry) observeAssociationClosed(cause error) {
+	if t == nil {
+		return
+	}
+	t.endAssociation(cause)
+	if t.observer != nil {
+		t.observer.OnAssociationClosed(cause)
+	}
+}
+
+// dicomSpan tracks the span (if any) and start time for one in-flight DIMSE
+// command, between startCommand and endCommand.
+type dicomSpan struct {
+	span  trace.Span
+	start time.Time
+}
+
+// commandFieldName maps a DIMSE CommandField value (PS3.7 E.1; RQ and RSP
+// share a name) to the span/metric name used for it, e.g. "dicom.c-store".
+func commandFieldName(commandField int) string {
+	switch commandField {
+	case 0x0001, 0x8001:
+		return "dicom.c-store"
+	case 0x0010, 0x8010:
+		return "dicom.c-get"
+	case 0x0020, 0x8020:
+		return "dicom.c-find"
+	case 0x0021, 0x8021:
+		return "dicom.c-move"
+	case 0x0030, 0x8030:
+		return "dicom.c-echo"
+	case int(dimse.CommandFieldC_CANCEL_RQ):
+		return "dicom.c-cancel"
+	case 0x0100, 0x8100:
+		return "dicom.n-event-report"
+	case 0x0110, 0x8110:
+		return "dicom.n-get"
+	case 0x0120, 0x8120:
+		return "dicom.n-set"
+	case 0x0130, 0x8130:
+		return "dicom.n-action"
+	case 0x0140, 0x8140:
+		return "dicom.n-create"
+	case 0x0150, 0x8150:
+		return "dicom.n-delete"
+	default:
+		return fmt.Sprintf("dicom.unknown-0x%04x", commandField)
+	}
+}
+
+// startCommand starts a span (if tracing is configured) named commandName
+// and bumps dicom.commands.active. The returned ctx replaces the caller's
+// ctx for the remaining lifetime of the command; the returned *dicomSpan
+// must be passed to endCommand exactly once.
+func (t *dicomTelemetry) startCommand(ctx context.Context, commandName, callingAE, calledAE, sopClassUID, transferSyntaxUID string, messageID uint16) (context.Context, *dicomSpan) {
+	if t == nil {
+		return ctx, &dicomSpan{start: time.Now()}
+	}
+	ds := &dicomSpan{start: time.Now()}
+	if t.tracer != nil {
+		ctx, ds.span = t.tracer.Start(ctx, commandName, trace.WithAttributes(
+			attribute.String("calling_ae", callingAE),
+			attribute.String("called_ae", calledAE),
+			attribute.String("sop_class_uid", sopClassUID),
+			attribute.String("transfer_syntax_uid", transferSyntaxUID),
+			attribute.Int64("message_id", int64(messageID)),
+		))
+	}
+	if t.commandsActive != nil {
+		t.commandsActive.Add(ctx, 1)
+	}
+	return ctx, ds
+}
+
+// endCommand ends the span (if any) started by startCommand and records
+// dicom.commands.total / dicom.command.duration_ms, tagged with the final
+// DIMSE status.
+func (t *dicomTelemetry) endCommand(ctx context.Context, commandName string, ds *dicomSpan, status dimse.Status) {
+	if t == nil || ds == nil {
+		return
+	}
+	if ds.span != nil {
+		ds.span.SetAttributes(attribute.Int64("dicom.status", int64(status.Status)))
+		ds.span.End()
+	}
+	if t.meter == nil {
+		return
+	}
+	attrs := metric.WithAttributes(
+		attribute.String("command", commandName),
+		attribute.String("status", fmt.Sprintf("0x%04x", uint16(status.Status))),
+	)
+	if t.commandsTotal != nil {
+		t.commandsTotal.Add(ctx, 1, attrs)
+	}
+	if t.commandDuration != nil {
+		t.commandDuration.Record(ctx, float64(time.Since(ds.start).Milliseconds()), attrs)
+	}
+	if t.commandsActive != nil {
+		t.commandsActive.Add(ctx, -1)
+	}
+}
+
+func (t *dicomTelemetry) associationOpened(ctx context.Context) {
+	if t != nil && t.associations != nil {
+		t.associations.Add(ctx, 1)
+	}
+}
+
+func (t *dicomTelemetry) associationClosed(ctx context.Context) {
+	if t != nil && t.associations != nil {
+		t.associations.Add(ctx, -1)
+	}
+}
+
+// extractDIMSEStatus returns the Status embedded in a DIMSE response
+// message, if msg is one of the response types that carries one.
+func extractDIMSEStatus(msg dimse.Message) (dimse.Status, bool) {
+	switch m := msg.(type) {
+	case *dimse.C_STORE_RSP:
+		return m.Status, true
+	case *dimse.C_FIND_RSP:
+		return m.Status, true
+	case *dimse.C_MOVE_RSP:
+		return m.Status, true
+	case *dimse.C_GET_RSP:
+		return m.Status, true
+	case *dimse.C_ECHO_RSP:
+		return m.Status, true
+	case *dimse.N_EVENT_REPORT_RSP:
+		return m.Status, true
+	case *dimse.N_GET_RSP:
+		return m.Status, true
+	case *dimse.N_SET_RSP:
+		return m.Status, true
+	case *dimse.N_ACTION_RSP:
+		return m.Status, true
+	case *dimse.N_CREATE_RSP:
+		return m.Status, true
+	case *dimse.N_DELETE_RSP:
+		return m.Status, true
+	default:
+		return dimse.Status{}, false
+	}
+}
@@ -0,0 +1,138 @@
+package netdicom
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+)
+
+// BCP195CipherSuites returns the cipher suite list recommended by BCP 195
+// ("TLS Recommendations"), which PS3.15 Secure Transport Connection Profiles
+// defers to. It excludes suites without forward secrecy and RC4/3DES/CBC-MD5
+// suites.
+func BCP195CipherSuites() []uint16 {
+	return []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+		tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	}
+}
+
+// DefaultTLSConfig returns a *tls.Config preconfigured per BCP 195: TLS 1.2
+// minimum and the cipher suite list from BCP195CipherSuites. Callers still
+// need to fill in Certificates and/or RootCAs/ClientCAs before passing it as
+// ServiceUserParams.TLSConfig or ServiceProviderParams.TLSConfig. It's
+// equivalent to TLSConfigForProfile(BCP195TLSCipherProfile).
+func DefaultTLSConfig() *tls.Config {
+	return TLSConfigForProfile(BCP195TLSCipherProfile)
+}
+
+// TLSCipherProfile selects one of PS3.15 Annex B's Secure Transport
+// Connection Profiles for TLSConfigForProfile / CipherSuitesForProfile.
+type TLSCipherProfile int
+
+const (
+	// BCP195TLSCipherProfile is this package's default: the forward-secret
+	// cipher suite list BCP 195 ("TLS Recommendations") recommends, which
+	// PS3.15's BCP 195 Transport Connection Profile defers to. See
+	// BCP195CipherSuites.
+	BCP195TLSCipherProfile TLSCipherProfile = iota
+
+	// AESTLSCipherProfile implements PS3.15's AES Transport Connection
+	// Profile (TLS_RSA_WITH_AES_128_CBC_SHA), for peers -- typically older
+	// modality/archive software -- that don't support the forward-secret
+	// suites BCP195TLSCipherProfile requires. Prefer
+	// BCP195TLSCipherProfile unless a specific peer requires this.
+	AESTLSCipherProfile
+)
+
+// CipherSuitesForProfile returns the cipher suite list for the given PS3.15
+// Secure Transport Connection Profile.
+func CipherSuitesForProfile(profile TLSCipherProfile) []uint16 {
+	switch profile {
+	case AESTLSCipherProfile:
+		return []uint16{tls.TLS_RSA_WITH_AES_128_CBC_SHA}
+	default:
+		return BCP195CipherSuites()
+	}
+}
+
+// TLSConfigForProfile returns a *tls.Config for the given PS3.15 Secure
+// Transport Connection Profile: TLS 1.2 minimum and that profile's cipher
+// suite list. Callers still need to fill in Certificates and/or
+// RootCAs/ClientCAs before passing it as ServiceUserParams.TLSConfig or
+// ServiceProviderParams.TLSConfig.
+func TLSConfigForProfile(profile TLSCipherProfile) *tls.Config {
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		CipherSuites: CipherSuitesForProfile(profile),
+	}
+}
+
+// Transport abstracts how ServiceUser establishes the outbound connection to
+// a peer AE. ConnectContext uses ServiceUserParams.Transport if set, so DICOM
+// can run over something other than plain TCP/TLS (DTLS, a proxied socket, a
+// test double) without the state machine itself knowing the difference --
+// everything past Dial's returned net.Conn is transport-agnostic (see
+// PDUChannelFactory).
+type Transport interface {
+	Dial(ctx context.Context, addr string) (net.Conn, error)
+}
+
+// TCPTransport dials plain TCP. It's the Transport ConnectContext uses when
+// ServiceUserParams.Transport and TLSConfig are both nil.
+type TCPTransport struct {
+	Dialer net.Dialer
+}
+
+func (t TCPTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	return t.Dialer.DialContext(ctx, "tcp", addr)
+}
+
+// TLSTransport dials over TLS (PS3.15 Secure Transport Connection Profiles /
+// BCP 195). It's what ServiceUserParams.TLSConfig configures under the hood;
+// set Transport to a TLSTransport directly instead of just TLSConfig when a
+// non-default net.Dialer (connect timeout, local address) is also needed.
+type TLSTransport struct {
+	Config *tls.Config
+	Dialer net.Dialer
+}
+
+func (t TLSTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	d := tls.Dialer{NetDialer: &t.Dialer, Config: t.Config}
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+// ListenTransport abstracts how ServiceProvider accepts inbound connections
+// from peer AEs -- the server-side analog of Transport. RunProviderForListener
+// et al. use ServiceProviderParams.Transport if set.
+type ListenTransport interface {
+	Listen(addr string) (net.Listener, error)
+}
+
+// TCPListenTransport listens on plain TCP. It's the ListenTransport used when
+// ServiceProviderParams.Transport and TLSConfig are both nil.
+type TCPListenTransport struct{}
+
+func (TCPListenTransport) Listen(addr string) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
+
+// TLSListenTransport listens over TLS. It's what ServiceProviderParams.TLSConfig
+// configures under the hood; set Transport to a TLSListenTransport directly
+// instead of just TLSConfig only if a custom underlying net.Listener is also
+// needed.
+type TLSListenTransport struct {
+	Config *tls.Config
+}
+
+func (t TLSListenTransport) Listen(addr string) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewListener(l, t.Config), nil
+}
@@ -0,0 +1,87 @@
+package netdicom
+
+import (
+	"fmt"
+
+	"github.com/yasushi-saito/go-dicom"
+	"github.com/yasushi-saito/go-dicom/dicomuid"
+)
+
+// Transcoder converts ds's pixel data from its current transfer syntax to
+// toTransferSyntaxUID, returning a new dataset encoded in the target syntax.
+// It is invoked from ServiceUser.CStore on every dataset, with the transfer
+// syntax negotiated for the dataset's SOP class, whether or not that differs
+// from ds's on-disk transfer syntax.
+type Transcoder interface {
+	Transcode(ds *dicom.DataSet, toTransferSyntaxUID string) (*dicom.DataSet, error)
+}
+
+// passThroughTranscoder is the default Transcoder: it refuses to transcode,
+// so a C-STORE whose negotiated syntax differs from the dataset's own
+// fails loudly rather than silently sending pixel data in the wrong
+// encoding. Set ServiceUserParams.Transcoder to a Transcoder that actually
+// converts pixel data to allow cross-syntax C-STORE; no such Transcoder
+// ships with this package yet (see jpegBaselineTranscoder's TODO).
+type passThroughTranscoder struct{}
+
+// PassThroughTranscoder returns the default Transcoder: it accepts only a
+// no-op conversion (the dataset is already in toTransferSyntaxUID) and
+// errors otherwise.
+func PassThroughTranscoder() Transcoder {
+	return passThroughTranscoder{}
+}
+
+func (passThroughTranscoder) Transcode(ds *dicom.DataSet, toTransferSyntaxUID string) (*dicom.DataSet, error) {
+	fromTransferSyntaxUID, err := datasetTransferSyntaxUID(ds)
+	if err != nil {
+		return nil, err
+	}
+	if fromTransferSyntaxUID != toTransferSyntaxUID {
+		return nil, fmt.Errorf(
+			"netdicom: no Transcoder configured to convert from %s to %s; set ServiceUserParams.Transcoder",
+			fromTransferSyntaxUID, toTransferSyntaxUID)
+	}
+	return ds, nil
+}
+
+// jpegBaselineTranscoder converts between JPEG Baseline (Process 1) and an
+// uncompressed (Explicit/Implicit VR Little Endian) transfer syntax.
+//
+// TODO(saito) Only the wiring exists so far; PixelData isn't actually
+// recompressed/decompressed yet. Both directions return an error until a
+// JPEG codec is plugged in, so this is kept unexported: there is no way to
+// set ServiceUserParams.Transcoder to it, which would otherwise advertise a
+// conversion the package can't actually perform.
+type jpegBaselineTranscoder struct{}
+
+func (jpegBaselineTranscoder) Transcode(ds *dicom.DataSet, toTransferSyntaxUID string) (*dicom.DataSet, error) {
+	fromTransferSyntaxUID, err := datasetTransferSyntaxUID(ds)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case fromTransferSyntaxUID == jpegBaselineTransferSyntaxUID && isUncompressedTransferSyntaxUID(toTransferSyntaxUID):
+		return nil, fmt.Errorf("netdicom: JPEG Baseline decoding is not yet implemented")
+	case isUncompressedTransferSyntaxUID(fromTransferSyntaxUID) && toTransferSyntaxUID == jpegBaselineTransferSyntaxUID:
+		return nil, fmt.Errorf("netdicom: JPEG Baseline encoding is not yet implemented")
+	default:
+		return nil, fmt.Errorf("netdicom: jpegBaselineTranscoder cannot convert %s to %s",
+			fromTransferSyntaxUID, toTransferSyntaxUID)
+	}
+}
+
+func isUncompressedTransferSyntaxUID(uid string) bool {
+	return uid == dicomuid.ExplicitVRLittleEndian ||
+		uid == dicomuid.ImplicitVRLittleEndian ||
+		uid == explicitVRBigEndianTransferSyntaxUID
+}
+
+// datasetTransferSyntaxUID extracts the transfer syntax UID ds was (or will
+// be) encoded with.
+func datasetTransferSyntaxUID(ds *dicom.DataSet) (string, error) {
+	elem, err := ds.FindElementByTag(dicom.TagTransferSyntaxUID)
+	if err != nil {
+		return "", err
+	}
+	return elem.GetString()
+}
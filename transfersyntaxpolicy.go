@@ -0,0 +1,85 @@
+package netdicom
+
+import "github.com/yasushi-saito/go-dicom/dicomuid"
+
+// Well-known transfer syntax UIDs (PS3.5 Annex A) not already exposed by
+// dicomuid, needed by the built-in TransferSyntaxPolicy implementations
+// below.
+const (
+	explicitVRBigEndianTransferSyntaxUID = "1.2.840.10008.1.2.2"
+	jpegBaselineTransferSyntaxUID        = "1.2.840.10008.1.2.4.50"
+	jpegLosslessTransferSyntaxUID        = "1.2.840.10008.1.2.4.70"
+	jpegLSLosslessTransferSyntaxUID      = "1.2.840.10008.1.2.4.80"
+	rleLosslessTransferSyntaxUID         = "1.2.840.10008.1.2.5"
+)
+
+// TransferSyntaxPolicy decides which of the transfer syntaxes offered for an
+// abstract syntax (SOP class) to accept, on the provider side when an
+// A-ASSOCIATE-RQ's PresentationContextItem lists more than one
+// TransferSyntaxSubItem, and on the user side to order the syntaxes
+// generateAssociateRequest offers. Select must return one of the UIDs in
+// offered.
+type TransferSyntaxPolicy interface {
+	Select(abstractSyntaxUID string, offered []string) string
+}
+
+// preferenceListPolicy selects the first entry of "preferred" that also
+// appears in "offered", falling back to the first offered syntax (i.e. the
+// original, pick-whatever-came-first behavior) if none of "preferred" was
+// offered.
+type preferenceListPolicy struct {
+	preferred []string
+}
+
+func (p *preferenceListPolicy) Select(abstractSyntaxUID string, offered []string) string {
+	for _, want := range p.preferred {
+		for _, have := range offered {
+			if have == want {
+				return have
+			}
+		}
+	}
+	return offered[0]
+}
+
+// PreferOriginalTransferSyntaxPolicy selects whichever transfer syntax was
+// listed first in "offered", the behavior this package had before
+// TransferSyntaxPolicy existed. It is the default when
+// ServiceProviderParams.TransferSyntaxPolicy / ServiceUserParams's
+// equivalent is left nil.
+func PreferOriginalTransferSyntaxPolicy() TransferSyntaxPolicy {
+	return &preferenceListPolicy{}
+}
+
+// PreferExplicitLittleEndianTransferSyntaxPolicy prefers Explicit VR Little
+// Endian (the syntax that's easiest to debug, since every element is
+// self-describing), falling back to whatever was offered first.
+func PreferExplicitLittleEndianTransferSyntaxPolicy() TransferSyntaxPolicy {
+	return &preferenceListPolicy{preferred: []string{dicomuid.ExplicitVRLittleEndian}}
+}
+
+// PreferUncompressedTransferSyntaxPolicy prefers an uncompressed syntax
+// (Explicit VR Little Endian, then Implicit VR Little Endian, then Explicit
+// VR Big Endian), avoiding the CPU cost of a lossy/lossless codec when the
+// peer is willing to accept raw pixel data.
+func PreferUncompressedTransferSyntaxPolicy() TransferSyntaxPolicy {
+	return &preferenceListPolicy{preferred: []string{
+		dicomuid.ExplicitVRLittleEndian,
+		dicomuid.ImplicitVRLittleEndian,
+		explicitVRBigEndianTransferSyntaxUID,
+	}}
+}
+
+// PreferLosslessTransferSyntaxPolicy prefers a lossless-compressed syntax
+// (JPEG Lossless, then JPEG-LS Lossless, then RLE Lossless), falling back to
+// an uncompressed syntax and finally whatever was offered first. Useful
+// when bandwidth matters but the pixel data must round-trip exactly.
+func PreferLosslessTransferSyntaxPolicy() TransferSyntaxPolicy {
+	return &preferenceListPolicy{preferred: []string{
+		jpegLosslessTransferSyntaxUID,
+		jpegLSLosslessTransferSyntaxUID,
+		rleLosslessTransferSyntaxUID,
+		dicomuid.ExplicitVRLittleEndian,
+		dicomuid.ImplicitVRLittleEndian,
+	}}
+}
@@ -0,0 +1,20 @@
+package netdicom
+
+import "go.uber.org/zap"
+
+// zapLogger adapts Logger to a *zap.SugaredLogger.
+type zapLogger struct {
+	l *zap.SugaredLogger
+}
+
+// ZapLogger returns a Logger that writes through l.
+func ZapLogger(l *zap.SugaredLogger) Logger {
+	return zapLogger{l: l}
+}
+
+func (a zapLogger) Debug(msg string, kv ...interface{}) { a.l.Debugw(msg, kv...) }
+func (a zapLogger) Info(msg string, kv ...interface{})  { a.l.Infow(msg, kv...) }
+func (a zapLogger) Warn(msg string, kv ...interface{})  { a.l.Warnw(msg, kv...) }
+func (a zapLogger) Error(msg string, kv ...interface{}) { a.l.Errorw(msg, kv...) }
+
+func (a zapLogger) With(kv ...interface{}) Logger { return ZapLogger(a.l.With(kv...)) }